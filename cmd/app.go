@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-contrib/zap"
@@ -10,9 +11,14 @@ import (
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/jasmaa/galt/internal/handlers"
+	"github.com/jasmaa/galt/internal/keys"
+	"github.com/jasmaa/galt/internal/mailer"
 	"github.com/jasmaa/galt/internal/middleware"
+	"github.com/jasmaa/galt/internal/passhash"
+	"github.com/jasmaa/galt/internal/ratelimit"
 	"github.com/jasmaa/galt/internal/store"
 )
 
@@ -24,16 +30,121 @@ func init() {
 
 func main() {
 
-	hmacSecret := os.Getenv("HMAC_SECRET")
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		s := &store.Store{}
+		s.Open()
+		defer s.Close()
+		if err := runMigrate(s, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		s := &store.Store{}
+		s.Open()
+		defer s.Close()
+		if err := runImport(s, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Load signing keys
+	keyDir := os.Getenv("JWT_KEY_DIR")
+	if len(keyDir) == 0 {
+		keyDir = "keys"
+	}
+	signingAlg := os.Getenv("JWT_SIGNING_ALG")
+	if len(signingAlg) == 0 {
+		signingAlg = keys.AlgEdDSA
+	}
+	keySet, err := keys.NewKeySet(keyDir, signingAlg, handlers.AccessTokenTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		if err := runKeys(keySet, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Reload keys from directory and rotate on schedule if JWT_KEY_ROTATION is set
+	var keyRotation time.Duration
+	if v := os.Getenv("JWT_KEY_ROTATION"); len(v) > 0 {
+		keyRotation, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	go keySet.Run(time.Minute, keyRotation, nil)
 
 	// Setup db
-	s := store.Store{}
-	s.Open()
-	defer s.Close()
+	var s store.Repository
+	if os.Getenv("STORE_BACKEND") == "memory" {
+		s = store.NewMemoryStore()
+	} else {
+		pg := &store.Store{}
+		pg.Open()
+		defer pg.Close()
+		s = pg
+	}
+
+	// Cost of hashing new passwords with bcrypt, raised as hardware gets faster
+	bcryptCost := bcrypt.DefaultCost
+	if v := os.Getenv("BCRYPT_COST"); len(v) > 0 {
+		bcryptCost, err = strconv.Atoi(v)
+		if err != nil || bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			log.Fatalf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	}
+
+	// Hash new passwords with PASSWORD_HASHER while still verifying hashes made by the other
+	var hasher *passhash.Hasher
+	switch os.Getenv("PASSWORD_HASHER") {
+	case "", "bcrypt":
+		hasher = passhash.NewHasher(passhash.Bcrypt{Cost: bcryptCost}, passhash.DefaultArgon2id)
+	case "argon2id":
+		hasher = passhash.NewHasher(passhash.DefaultArgon2id, passhash.Bcrypt{Cost: bcryptCost})
+	default:
+		log.Fatal("PASSWORD_HASHER must be bcrypt or argon2id")
+	}
+
+	// Deleted accounts can be restored by logging in until their grace period is over
+	deletionGracePeriod := 30 * 24 * time.Hour
+	if v := os.Getenv("ACCOUNT_DELETION_GRACE"); len(v) > 0 {
+		deletionGracePeriod, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	go store.RunPurge(s, time.Hour, deletionGracePeriod, nil)
+
+	// Setup mailer, which has no default since mail carries live reset and verification tokens
+	var m mailer.Mailer
+	switch os.Getenv("MAILER_BACKEND") {
+	case "smtp":
+		m = mailer.NewSMTPMailer()
+	case "file":
+		m = &mailer.FileMailer{Dir: "mail", From: os.Getenv("MAIL_FROM")}
+	case "log":
+		log.Print("MAILER_BACKEND=log writes reset and verification tokens to the log, only use it for development")
+		m = &mailer.LogMailer{From: os.Getenv("MAIL_FROM")}
+	default:
+		log.Fatal("MAILER_BACKEND must be smtp, file or log")
+	}
 
 	// Router
 	r := gin.New()
 
+	// Client addresses come from the connection unless CLIENT_IP_HEADER names one set by a trusted proxy
+	r.ForwardedByClientIP = false
+	if header := os.Getenv("CLIENT_IP_HEADER"); len(header) > 0 {
+		r.Use(middleware.ClientIP(header))
+	}
+
 	// Middleware
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
@@ -48,41 +159,70 @@ func main() {
 		c.Next()
 	})
 
-	v1.Use(middleware.AuthUser(hmacSecret))
-
-	v1.POST("/createAccount", handlers.CreateAccount())
-	v1.POST("/login", handlers.Login(hmacSecret))
-
-	v1.GET("/user/:userID", handlers.GetUser())
-	v1.GET("/user", handlers.GetProfile())
-	v1.PUT("/user", handlers.UpdateProfile())
-	v1.DELETE("/user", handlers.DeleteProfile())
-
-	v1.GET("/status/:statusID", handlers.GetStatus())
-	v1.GET("/status", handlers.GetStatusFeed())
-	v1.POST("/status", handlers.PostStatus())
-	v1.PUT("/status/:statusID", handlers.UpdateStatus())
-	v1.DELETE("/status/:statusID", handlers.DeleteStatus())
-	v1.POST("/status/:statusID/like", handlers.LikeStatus())
-	v1.POST("/status/:statusID/unlike", handlers.UnikeStatus())
-	v1.GET("/status/:statusID/comments", handlers.GetComments())
-	v1.POST("/status/:statusID/comment", handlers.PostComment())
-
-	v1.GET("/comment/:commentID", handlers.GetCommentChain())
-	v1.POST("/comment/:commentID", middleware.AuthUser(hmacSecret), handlers.PostReply())
-	/*
-		v1.PUT("/comment/:commentID", middleware.AuthUser(hmacSecret), handlers.UpdateStatus())
-		v1.DELETE("/comment/:commentID", middleware.AuthUser(hmacSecret), handlers.DeleteStatus())
-		v1.POST("/comment/:commentID/like", middleware.AuthUser(hmacSecret), handlers.LikeStatus())
-		v1.POST("/comment/:commentID/unlike", middleware.AuthUser(hmacSecret), handlers.UnikeStatus())
-	*/
-
-	v1.GET("/circle/:circleID", handlers.GetCircle())
-	v1.POST("/circle", handlers.CreateCircle())
-	v1.PUT("/circle/:circleID", handlers.UpdateCircle())
-	v1.DELETE("/circle/:circleID", handlers.DeleteCircle())
-	v1.POST("/circle/:circleID/addUser", handlers.AddUserToCircle())
-	v1.POST("/circle/:circleID/removeUser", handlers.RemoveUserFromCircle())
+	v1.Use(middleware.AuthUser(keySet))
+
+	requireVerifiedEmail := middleware.RequireVerifiedEmail(os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true")
+
+	// Rate limits by user or ip address, stricter for writes than reads
+	limiter := ratelimit.NewMemoryBackend()
+	auth := v1.Group("", middleware.RateLimit(limiter, "auth", ratelimit.Limit{Burst: 20, Period: time.Minute}))
+	reads := v1.Group("", middleware.RateLimit(limiter, "read", ratelimit.Limit{Burst: 300, Period: time.Minute}))
+	writes := v1.Group("", middleware.RateLimit(limiter, "write", ratelimit.Limit{Burst: 60, Period: time.Minute}))
+
+	auth.POST("/createAccount", handlers.CreateAccount(m, hasher))
+	auth.POST("/login", handlers.Login(keySet, hasher))
+	auth.POST("/login/mfa", handlers.LoginMFA(keySet))
+	auth.POST("/token/refresh", handlers.RefreshToken(keySet))
+	auth.POST("/logout", handlers.Logout())
+	auth.POST("/logout/all", handlers.LogoutAll())
+	auth.POST("/password/forgot", handlers.ForgotPassword(m))
+	auth.POST("/password/reset", handlers.ResetPassword(hasher))
+
+	reads.GET("/user/:userID", handlers.GetUser())
+	reads.GET("/user", handlers.GetProfile())
+	writes.PUT("/user", handlers.UpdateProfile(m))
+	writes.DELETE("/user", handlers.DeleteProfile(deletionGracePeriod))
+	writes.PUT("/user/password", handlers.ChangePassword(hasher))
+	writes.POST("/user/email/verify", handlers.VerifyEmail())
+	writes.POST("/user/email/resend", handlers.ResendVerificationEmail(m))
+	writes.POST("/user/2fa/enroll", handlers.EnrollTOTP())
+	writes.POST("/user/2fa/confirm", handlers.ConfirmTOTP())
+	writes.POST("/user/2fa/disable", handlers.DisableTOTP(hasher))
+	writes.POST("/user/import", requireVerifiedEmail, handlers.ImportArchive())
+
+	writes.POST("/export", handlers.RequestExport())
+	reads.GET("/export/:exportID", handlers.GetExport())
+
+	reads.GET("/sessions", handlers.GetSessions())
+	writes.DELETE("/sessions/:sessionID", handlers.DeleteSession())
+
+	reads.GET("/status/:statusID", handlers.GetStatus())
+	reads.GET("/status", handlers.GetStatusFeed())
+	writes.POST("/status", requireVerifiedEmail, handlers.PostStatus())
+	writes.PUT("/status/:statusID", handlers.UpdateStatus())
+	writes.DELETE("/status/:statusID", handlers.DeleteStatus())
+	writes.POST("/status/:statusID/like", handlers.LikeStatus())
+	writes.POST("/status/:statusID/unlike", handlers.UnikeStatus())
+	reads.GET("/status/:statusID/comments", handlers.GetComments())
+	writes.POST("/status/:statusID/comment", requireVerifiedEmail, handlers.PostComment())
+	writes.POST("/status/:statusID/reshare", requireVerifiedEmail, handlers.ReshareStatus())
+	reads.GET("/status/:statusID/reshares", handlers.GetReshares())
+
+	reads.GET("/comment/:commentID", handlers.GetCommentChain())
+	writes.POST("/comment/:commentID", requireVerifiedEmail, handlers.PostReply())
+	writes.PUT("/comment/:commentID", handlers.UpdateComment())
+	writes.DELETE("/comment/:commentID", handlers.DeleteComment())
+	writes.POST("/comment/:commentID/like", handlers.LikeComment())
+	writes.POST("/comment/:commentID/unlike", handlers.UnlikeComment())
+
+	reads.GET("/circle/:circleID", handlers.GetCircle())
+	writes.POST("/circle", handlers.CreateCircle())
+	writes.PUT("/circle/:circleID", handlers.UpdateCircle())
+	writes.DELETE("/circle/:circleID", handlers.DeleteCircle())
+	writes.POST("/circle/:circleID/addUser", handlers.AddUserToCircle())
+	writes.POST("/circle/:circleID/removeUser", handlers.RemoveUserFromCircle())
+
+	r.GET("/.well-known/jwks.json", handlers.GetJWKS(keySet))
 
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{
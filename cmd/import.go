@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/takeout"
+)
+
+const importUsage = "usage: import <username> <archive.zip>"
+
+// runImport runs the import subcommand, adding an export archive to an existing user
+func runImport(s store.Repository, args []string) error {
+
+	if len(args) != 2 {
+		return errors.New(importUsage)
+	}
+
+	user, err := s.GetUserByUsername(args[0])
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	archive, err := takeout.Read(f, info.Size())
+	if err != nil {
+		return err
+	}
+
+	report, err := takeout.Import(s, user.ID, archive)
+	var invalid *takeout.ValidationError
+	if errors.As(err, &invalid) {
+		fields := make([]string, 0, len(invalid.Fields))
+		for field := range invalid.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			fmt.Printf("invalid %s: %s\n", field, invalid.Fields[field])
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(report)
+	for _, member := range report.UnmatchedUsers {
+		fmt.Printf("unmatched user %s (%s)\n", member.Username, member.ID)
+	}
+	for _, statusID := range report.SkippedStatusIDs {
+		fmt.Printf("skipped status %s\n", statusID)
+	}
+	for _, commentID := range report.SkippedCommentIDs {
+		fmt.Printf("skipped comment %s\n", commentID)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jasmaa/galt/internal/keys"
+)
+
+const keysUsage = "usage: keys rotate | prune | list"
+
+// runKeys runs the keys subcommand
+func runKeys(keySet *keys.KeySet, args []string) error {
+
+	if len(args) <= 0 {
+		return errors.New(keysUsage)
+	}
+
+	switch args[0] {
+	case "rotate":
+		key, err := keySet.Rotate()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %s\n", key.ID)
+		return nil
+
+	case "prune":
+		pruned, err := keySet.Prune()
+		for _, kid := range pruned {
+			fmt.Printf("pruned %s\n", kid)
+		}
+		return err
+
+	case "list":
+		signing := keySet.SigningKey()
+		for _, key := range keySet.Keys() {
+			state := "verify"
+			if key == signing {
+				state = "sign"
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", key.ID, key.Method.Alg(), state, key.CreatedTimestamp.Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	}
+
+	return errors.New(keysUsage)
+}
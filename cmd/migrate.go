@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate runs the migrate subcommand
+func runMigrate(s *store.Store, args []string) error {
+
+	if len(args) <= 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := s.MigrateUp()
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return errors.New(migrateUsage)
+			}
+			steps = n
+		}
+		reverted, err := s.MigrateDown(steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := s.GetMigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, m := range statuses {
+			if m.AppliedAt.Valid {
+				fmt.Printf("%04d_%s\tapplied %s\n", m.Version, m.Name, m.AppliedAt.Time.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%04d_%s\tpending\n", m.Version, m.Name)
+			}
+		}
+		return nil
+	}
+
+	return errors.New(migrateUsage)
+}
@@ -0,0 +1,72 @@
+package apierror
+
+import "net/http"
+
+// Codes identify kinds of errors for clients independent of their messages
+const (
+	CodeBadRequest           = "bad_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeGone                 = "gone"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeInvalidInput         = "invalid_input"
+	CodeTooManyRequests      = "too_many_requests"
+	CodeInternal             = "internal_error"
+)
+
+// Body is the envelope every error response is sent in
+type Body struct {
+	Error Error `json:"error"`
+}
+
+// Error describes what went wrong
+//
+// Details are optional and specific to the code, like the invalid fields of a request.
+type Error struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// New creates error response for status
+func New(status int, message string, details interface{}) Body {
+	return Body{
+		Error: Error{
+			Code:    Code(status),
+			Message: message,
+			Details: details,
+		},
+	}
+}
+
+// Code gets error code for status
+func Code(status int) string {
+
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusGone:
+		return CodeGone
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMediaType
+	case http.StatusUnprocessableEntity:
+		return CodeInvalidInput
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	}
+
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
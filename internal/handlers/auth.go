@@ -1,95 +1,382 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"net/http"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jasmaa/galt/internal/keys"
+	"github.com/jasmaa/galt/internal/mailer"
+	"github.com/jasmaa/galt/internal/passhash"
 	"github.com/jasmaa/galt/internal/store"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/jasmaa/galt/internal/validate"
 )
 
+// AccessTokenTTL is how long access tokens are valid
+//
+// Replaced signing keys must keep verifying for at least this long.
+const AccessTokenTTL = 15 * time.Minute
+
+// refreshTokenTTL is how long refresh tokens are valid
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+// newToken creates random token to hand out to the client
+func newToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken hashes refresh or reset token for storage
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens creates access token for session and the next refresh token in its family
+func issueTokens(s store.Repository, keySet *keys.KeySet, userID string, sessionID string) (gin.H, error) {
+
+	now := time.Now()
+
+	// Create JWT token with claims
+	tokenString, err := keySet.Sign(jwt.MapClaims{
+		"userID": userID,
+		"jti":    sessionID,
+		"iat":    now.Unix(),
+		"exp":    now.Add(AccessTokenTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Create refresh token
+	refreshToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.InsertRefreshToken(store.RefreshToken{
+		ID:               uuid.New().String(),
+		UserID:           userID,
+		FamilyID:         sessionID,
+		TokenHash:        hashToken(refreshToken),
+		CreatedTimestamp: now,
+		ExpiresTimestamp: now.Add(refreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":        tokenString,
+		"refreshToken": refreshToken,
+		"expiresIn":    int(AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// startSession starts session for logged in user and issues its first tokens
+func startSession(c *gin.Context, s store.Repository, keySet *keys.KeySet, userID string) (gin.H, error) {
+
+	now := time.Now()
+	session := store.Session{
+		ID:                uuid.New().String(),
+		UserID:            userID,
+		UserAgent:         truncate(c.Request.UserAgent(), 255),
+		IPAddress:         c.ClientIP(),
+		CreatedTimestamp:  now,
+		LastSeenTimestamp: now,
+	}
+	err := s.InsertSession(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return issueTokens(s, keySet, userID, session.ID)
+}
+
+// createAccountRequest is the form to create an account
+type createAccountRequest struct {
+	Username string `form:"username" json:"username"`
+	Password string `form:"password" json:"password"`
+	Email    string `form:"email" json:"email"`
+}
+
+// validate checks account form
+func (req createAccountRequest) validate() validate.Errors {
+
+	errs := validate.Errors{}
+	validate.Username(errs, "username", req.Username)
+	validate.Password(errs, "password", req.Password, req.Username)
+	if len(req.Email) > 0 {
+		validate.Email(errs, "email", req.Email)
+	}
+
+	return errs
+}
+
 // CreateAccount creates user account
-func CreateAccount() gin.HandlerFunc {
+//
+// Email is optional. If given, a verification token is mailed to it.
+func CreateAccount(m mailer.Mailer, hasher *passhash.Hasher) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 
 		userID := uuid.New().String()
-		username := c.PostForm("username")
-		password := c.PostForm("password")
+		var req createAccountRequest
+		if !bindRequest(c, &req) || respondInvalid(c, req.validate()) {
+			return
+		}
 
-		// TODO: input validation
+		email := ""
+		if len(req.Email) > 0 {
+			email, _ = validate.NormalizeEmail(req.Email)
 
-		if len(username) <= 0 || len(password) <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "No username or password entered",
-			})
-			return
+			if _, err := s.GetUserByEmail(email); err == nil {
+				respondError(c, http.StatusConflict, "Email already in use")
+				return
+			}
 		}
 
 		// Hash password
-		hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+		hash, err := hasher.Hash(req.Password)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		err = s.InsertUser(store.User{
+		user := store.User{
 			ID:           userID,
-			Username:     username,
-			PasswordHash: string(hash),
-		})
+			Username:     req.Username,
+			PasswordHash: hash,
+			Email:        email,
+		}
+		err = s.InsertUser(user)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
+		// Account is usable without mail so verification can be resent later
+		if len(email) > 0 {
+			if err := sendVerificationEmail(s, m, user); err != nil {
+				c.Error(err)
+			}
+		}
+
 		c.JSON(http.StatusOK, gin.H{})
 	}
 }
 
+// loginRequest is the form to log in with a password
+type loginRequest struct {
+	Username string `form:"username" json:"username"`
+	Password string `form:"password" json:"password"`
+}
+
 // Login logs in user
-func Login(hmacSecret string) gin.HandlerFunc {
+//
+// Users with two-factor enabled get an MFA token to finish logging in with LoginMFA.
+//
+// Failed logins are counted per username and per ip address. Past a few failures each
+// key has to wait exponentially longer between attempts and is locked out for a while
+// once it reaches its threshold.
+//
+// Passwords hashed with a legacy algorithm or outdated parameters are rehashed once they match.
+// Deactivated users are restored once they have fully logged in.
+func Login(keySet *keys.KeySet, hasher *passhash.Hasher) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
-		username := c.PostForm("username")
-		password := c.PostForm("password")
+		s := c.MustGet("store").(store.Repository)
+		var req loginRequest
+		if !bindRequest(c, &req) {
+			return
+		}
+		username := truncate(req.Username, 255)
+
+		now := time.Now()
+		throttles := loginThrottles(username, c.ClientIP())
+		if wait := loginRetryAfter(s, throttles, now); wait > 0 {
+			setRetryAfter(c, wait)
+			respondError(c, http.StatusTooManyRequests, "Too many login attempts")
+			return
+		}
 
+		// Compare password hashes, against a dummy if there is no user so both fail alike
 		user, err := s.GetUserByUsername(username)
+		passwordHash := hasher.DummyHash()
+		if err == nil {
+			passwordHash = user.PasswordHash
+		}
+		ok, rehash, err := hasher.Verify(passwordHash, req.Password)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid credentials",
+			c.Error(err)
+		}
+		if user == nil || !ok {
+			recordLoginFailure(c, s, throttles, username, now)
+			respondError(c, http.StatusUnauthorized, "Invalid credentials")
+			return
+		}
+
+		// Upgrade hash while the password is at hand, logging in anyway if it fails
+		if rehash {
+			if hash, err := hasher.Hash(req.Password); err != nil {
+				c.Error(err)
+			} else if err := s.SetUserPassword(user.ID, hash); err != nil {
+				c.Error(err)
+			}
+		}
+
+		// Second step is needed before a session starts
+		if user.IsTOTPEnabled {
+			mfaToken, err := issueMFAToken(keySet, user.ID)
+			if err != nil {
+				respondStoreError(c, err)
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"mfaRequired": true,
+				"mfaToken":    mfaToken,
 			})
 			return
 		}
 
-		// Compare password hashes
-		err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+		// Failures only start over once fully logged in so the second step cannot be guessed at freely
+		if err := s.DeleteLoginFailure(throttles[0].key); err != nil {
+			c.Error(err)
+		}
+
+		err = restoreUser(s, user)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid credentials",
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		// Create JWT token with claims
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"userID": user.ID,
-			"iat":    time.Now().Unix(),
-			"exp":    time.Now().Add(time.Hour * time.Duration(24)).Unix(),
-		})
-		tokenString, err := token.SignedString([]byte(hmacSecret))
+		tokens, err := startSession(c, s, keySet, user.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"token": tokenString,
-		})
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// refreshTokenRequest is the form to refresh or end a session with a refresh token
+type refreshTokenRequest struct {
+	RefreshToken string `form:"refreshToken" json:"refreshToken"`
+}
+
+// RefreshToken exchanges refresh token for new access and refresh tokens
+//
+// Refresh tokens are single use. Presenting a used token means it was stolen or replayed
+// so every token in its family is revoked.
+func RefreshToken(keySet *keys.KeySet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		var req refreshTokenRequest
+		if !bindRequest(c, &req) {
+			return
+		}
+
+		token, err := s.GetRefreshTokenByHash(hashToken(req.RefreshToken))
+		if err != nil || token.IsRevoked || time.Now().After(token.ExpiresTimestamp) {
+			respondError(c, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+
+		// Check if session was ended or expired
+		session, err := s.GetSessionByID(token.FamilyID)
+		if err != nil || session.IsExpired(time.Now()) {
+			respondError(c, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+
+		used, err := s.UseRefreshToken(token.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		// Revoke family on reuse
+		if !used {
+			err = s.RevokeRefreshTokenFamily(token.FamilyID)
+			if err != nil {
+				respondStoreError(c, err)
+				return
+			}
+
+			respondError(c, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+
+		tokens, err := issueTokens(s, keySet, token.UserID, token.FamilyID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// Logout ends session of refresh token
+func Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		var req refreshTokenRequest
+		if !bindRequest(c, &req) {
+			return
+		}
+
+		token, err := s.GetRefreshTokenByHash(hashToken(req.RefreshToken))
+		if err != nil {
+			respondError(c, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+
+		if !endSession(c, s, token.FamilyID) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+// LogoutAll ends all sessions of user
+func LogoutAll() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		err := s.RevokeUserRefreshTokens(authUser.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		err = s.DeleteUserSessions(authUser.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
 	}
 }
@@ -7,27 +7,21 @@ import (
 	"net/url"
 	"testing"
 
-	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 
+	"github.com/jasmaa/galt/internal/handlers"
+	"github.com/jasmaa/galt/internal/passhash"
 	"github.com/jasmaa/galt/internal/store"
 )
 
 func TestCreateAccountSuccess(t *testing.T) {
 
 	// Setup
-	s := store.Store{}
-	mock := s.OpenMock()
-	defer s.Close()
+	s := store.NewMemoryStore()
 	r := setupRouter(s)
 
-	mock.ExpectQuery("SELECT (.+) FROM users WHERE username=?").
-		WithArgs("testuser").
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-	mock.ExpectExec("INSERT INTO users").
-		WithArgs(sqlmock.AnyArg(), "testuser", sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-
 	// Create account
 	data := url.Values{}
 	data.Set("username", "testuser")
@@ -43,17 +37,16 @@ func TestCreateAccountSuccess(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("there were unfulfilled expectations: %s", err)
+	user, err := s.GetUserByUsername("testuser")
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, "testpassword", user.PasswordHash)
 	}
 }
 
 func TestCreateAccountFailNoCredentials(t *testing.T) {
 
 	// Setup
-	s := store.Store{}
-	_ = s.OpenMock()
-	defer s.Close()
+	s := store.NewMemoryStore()
 	r := setupRouter(s)
 
 	// Create account
@@ -69,22 +62,18 @@ func TestCreateAccountFailNoCredentials(t *testing.T) {
 	rr := httptest.NewRecorder()
 	r.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	_, err = s.GetUserByUsername("testuser")
+	assert.Error(t, err)
 }
 
 func TestLoginSuccess(t *testing.T) {
 
 	// Setup
-	s := store.Store{}
-	mock := s.OpenMock()
-	defer s.Close()
+	s := setupStore(t)
 	r := setupRouter(s)
 
-	mock.ExpectQuery("SELECT (.+) FROM users WHERE username=?").
-		WithArgs("testuser").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "description", "profile_img_url"}).
-			AddRow("12345", "testuser", "$2b$10$KpZAZIPai8SyT7k8zT582ec5Va9.KrnoMc9D5UnGkDRdVvTp263/q", "", ""))
-
 	// Login
 	data := url.Values{}
 	data.Set("username", "testuser")
@@ -99,24 +88,61 @@ func TestLoginSuccess(t *testing.T) {
 	r.ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotEmpty(t, decodeBody(t, rr)["token"])
+}
+
+func TestLoginRehashesOutdatedHash(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	// Test user was hashed at a higher cost than configured
+	loginTestUser(t, r)
 
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("there were unfulfilled expectations: %s", err)
+	user, _ := s.GetUserByID("12345")
+	cost, err := bcrypt.Cost([]byte(user.PasswordHash))
+	if assert.NoError(t, err) {
+		assert.Equal(t, testBcryptCost, cost)
 	}
+
+	// Rehashed password still logs in
+	loginTestUser(t, r)
+}
+
+func TestLoginUpgradesLegacyAlgorithm(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	v1 := r.Group("/api/v1")
+	v1.Use(func(c *gin.Context) {
+		c.Set("store", s)
+		c.Next()
+	})
+	argon2id := passhash.Argon2id{Time: 1, Memory: 1024, Threads: 1, SaltLength: 16, KeyLength: 32}
+	v1.POST("/login", handlers.Login(testKeySet, passhash.NewHasher(argon2id, passhash.Bcrypt{Cost: testBcryptCost})))
+
+	// Bcrypt hash still logs in and is moved to argon2id
+	loginTestUser(t, r)
+
+	user, _ := s.GetUserByID("12345")
+	ok, rehash, err := passhash.NewHasher(argon2id).Verify(user.PasswordHash, "testpassword")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	loginTestUser(t, r)
 }
 
 func TestLoginFailUnregisteredUser(t *testing.T) {
 
 	// Setup
-	s := store.Store{}
-	mock := s.OpenMock()
-	defer s.Close()
+	s := setupStore(t)
 	r := setupRouter(s)
 
-	mock.ExpectQuery("SELECT (.+) FROM users WHERE username=?").
-		WithArgs("invaliduser").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "description", "profile_img_url"}))
-
 	// Login
 	data := url.Values{}
 	data.Set("username", "invaliduser")
@@ -131,25 +157,14 @@ func TestLoginFailUnregisteredUser(t *testing.T) {
 	r.ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusUnauthorized, rr.Code)
-
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("there were unfulfilled expectations: %s", err)
-	}
 }
 
 func TestLoginFailBadPassword(t *testing.T) {
 
 	// Setup
-	s := store.Store{}
-	mock := s.OpenMock()
-	defer s.Close()
+	s := setupStore(t)
 	r := setupRouter(s)
 
-	mock.ExpectQuery("SELECT (.+) FROM users WHERE username=?").
-		WithArgs("testuser").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "description", "profile_img_url"}).
-			AddRow("12345", "testuser", "$2b$10$KpZAZIPai8SyT7k8zT582ec5Va9.KrnoMc9D5UnGkDRdVvTp263/q", "", ""))
-
 	// Login
 	data := url.Values{}
 	data.Set("username", "testuser")
@@ -164,8 +179,145 @@ func TestLoginFailBadPassword(t *testing.T) {
 	r.ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+// loginTestUser logs in as user 12345 and returns tokens
+func loginTestUser(t *testing.T, r http.Handler) map[string]interface{} {
 
-	if err := mock.ExpectationsWereMet(); err != nil {
-		t.Errorf("there were unfulfilled expectations: %s", err)
+	data := url.Values{}
+	data.Set("username", "testuser")
+	data.Set("password", "testpassword")
+	req, err := http.NewRequest("POST", "/api/v1/login", bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err != nil {
+		t.Fatal(err)
 	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login failed with status %d", rr.Code)
+	}
+
+	return decodeBody(t, rr)
+}
+
+// refreshTestTokens exchanges refresh token
+func refreshTestTokens(t *testing.T, r http.Handler, refreshToken string) *httptest.ResponseRecorder {
+
+	data := url.Values{}
+	data.Set("refreshToken", refreshToken)
+	req, err := http.NewRequest("POST", "/api/v1/token/refresh", bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestRefreshTokenSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	tokens := loginTestUser(t, r)
+
+	// Refresh tokens
+	rr := refreshTestTokens(t, r, tokens["refreshToken"].(string))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body := decodeBody(t, rr)
+	assert.NotEmpty(t, body["token"])
+	assert.NotEqual(t, tokens["refreshToken"], body["refreshToken"])
+
+	// New refresh token works
+	rr = refreshTestTokens(t, r, body["refreshToken"].(string))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	tokens := loginTestUser(t, r)
+	rr := refreshTestTokens(t, r, tokens["refreshToken"].(string))
+	rotated := decodeBody(t, rr)["refreshToken"].(string)
+
+	// Replay used refresh token
+	rr = refreshTestTokens(t, r, tokens["refreshToken"].(string))
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Rotated token was revoked with its family
+	rr = refreshTestTokens(t, r, rotated)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestLogoutSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	tokens := loginTestUser(t, r)
+	other := loginTestUser(t, r)
+
+	// Logout
+	data := url.Values{}
+	data.Set("refreshToken", tokens["refreshToken"].(string))
+	req, err := http.NewRequest("POST", "/api/v1/logout", bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Only the logged out family is revoked
+	rr = refreshTestTokens(t, r, tokens["refreshToken"].(string))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = refreshTestTokens(t, r, other["refreshToken"].(string))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Access token of ended session is rejected
+	req, _ = http.NewRequest("GET", "/api/v1/user", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["token"].(string))
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestLogoutAllSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	tokens := loginTestUser(t, r)
+	other := loginTestUser(t, r)
+
+	// Logout everywhere
+	req, err := http.NewRequest("POST", "/api/v1/logout/all", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["token"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = refreshTestTokens(t, r, tokens["refreshToken"].(string))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = refreshTestTokens(t, r, other["refreshToken"].(string))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
 }
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// bindRequest reads JSON or form body into request struct
+//
+// Responds with 415 for other content types and 400 if the body cannot be read.
+// Requests without a body are read as empty forms.
+func bindRequest(c *gin.Context, req interface{}) bool {
+
+	var b binding.Binding
+	switch c.ContentType() {
+	case binding.MIMEJSON:
+		b = binding.JSON
+	case binding.MIMEPOSTForm, "":
+		b = binding.FormPost
+	case binding.MIMEMultipartPOSTForm:
+		b = binding.FormMultipart
+	default:
+		respondError(c, http.StatusUnsupportedMediaType, "Unsupported content type")
+		return false
+	}
+
+	if err := c.ShouldBindWith(req, b); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// sendTestJSON sends body as JSON with optional auth header
+func sendTestJSON(t *testing.T, r http.Handler, method string, path string, body interface{}, authHeader string) *httptest.ResponseRecorder {
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(method, path, bytes.NewBuffer(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(authHeader) > 0 {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestCreateAccountAndLoginJSON(t *testing.T) {
+
+	// Setup
+	s := store.NewMemoryStore()
+	r := setupRouter(s)
+
+	rr := sendTestJSON(t, r, "POST", "/api/v1/createAccount", gin.H{"username": "jsonuser", "password": "jsonpassword"}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = sendTestJSON(t, r, "POST", "/api/v1/login", gin.H{"username": "jsonuser", "password": "jsonpassword"}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, decodeBody(t, rr), "token")
+}
+
+func TestPostStatusJSON(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	s.InsertCircle(store.Circle{ID: "circle1", UserID: "12345", Name: "Friends"})
+
+	rr := sendTestJSON(t, r, "POST", "/api/v1/status", gin.H{
+		"content":    "Shared with friends",
+		"visibility": store.VisibilityCircles,
+		"circleIDs":  []string{"circle1"},
+	}, testAuthHeader)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body := decodeBody(t, rr)
+	assert.Equal(t, "Shared with friends", body["content"])
+	assert.Equal(t, store.VisibilityCircles, body["visibility"])
+
+	// Fields are validated the same as forms
+	rr = sendTestJSON(t, r, "POST", "/api/v1/status", gin.H{"content": ""}, testAuthHeader)
+	assertFieldErrors(t, rr, "content")
+}
+
+func TestUpdateProfileJSON(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := sendTestJSON(t, r, "PUT", "/api/v1/user", gin.H{"description": "Sent as JSON"}, testAuthHeader)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	user, _ := s.GetUserByID("12345")
+	assert.Equal(t, "Sent as JSON", user.Description)
+}
+
+func TestBindFailUnsupportedContentType(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	req, _ := http.NewRequest("POST", "/api/v1/status", bytes.NewBufferString("content=hello"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Authorization", testAuthHeader)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+}
+
+func TestBindFailMalformedJSON(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	req, _ := http.NewRequest("POST", "/api/v1/status", bytes.NewBufferString(`{"content": 5}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", testAuthHeader)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "Invalid request body", decodeError(t, rr)["message"])
+}
@@ -6,35 +6,53 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/validate"
 )
 
+// circleRequest is the form to create or update a circle
+type circleRequest struct {
+	Name        string `form:"name" json:"name"`
+	Description string `form:"description" json:"description"`
+}
+
+// validate checks circle fields, only requiring name if not partial
+//
+// Partial updates leave empty fields unchanged.
+func (req circleRequest) validate(partial bool) validate.Errors {
+
+	errs := validate.Errors{}
+	validate.Text(errs, "name", req.Name, !partial)
+	validate.Text(errs, "description", req.Description, false)
+
+	return errs
+}
+
+// circleUserRequest is the form to add or remove a user from a circle
+type circleUserRequest struct {
+	UserID string `form:"userID" json:"userID"`
+}
+
 // GetCircle gets circle by id
 func GetCircle() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		circleID := c.Param("circleID")
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		circle, err := s.GetCircleByID(circleID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
 		// Check if user owns circle
 		if authUser.ID != circle.UserID {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "You do not have permission to view this circle",
-			})
+			respondError(c, http.StatusForbidden, "You do not have permission to view this circle")
 			return
 		}
 
@@ -46,31 +64,29 @@ func GetCircle() gin.HandlerFunc {
 func CreateCircle() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		circleID := uuid.New().String()
-		name := c.PostForm("name")
-		description := c.PostForm("description")
+		var req circleRequest
+		if !bindRequest(c, &req) || respondInvalid(c, req.validate(false)) {
+			return
+		}
 
 		// Insert circle
 		circle := store.Circle{
 			ID:          circleID,
 			UserID:      authUser.ID,
-			Name:        name,
-			Description: description,
+			Name:        req.Name,
+			Description: req.Description,
 		}
 		err := s.InsertCircle(circle)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
@@ -82,48 +98,42 @@ func CreateCircle() gin.HandlerFunc {
 func UpdateCircle() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		circleID := c.Param("circleID")
-		name := c.PostForm("name")
-		description := c.PostForm("description")
+		var req circleRequest
+		if !bindRequest(c, &req) || respondInvalid(c, req.validate(true)) {
+			return
+		}
 
 		circle, err := s.GetCircleByID(circleID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
 		// Check if user owns circle
 		if authUser.ID != circle.UserID {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "You do not have permission to edit this circle",
-			})
+			respondError(c, http.StatusForbidden, "You do not have permission to edit this circle")
 			return
 		}
 
 		// Update circle
-		if len(name) > 0 {
-			circle.Name = name
+		if len(req.Name) > 0 {
+			circle.Name = req.Name
 		}
-		if len(description) > 0 {
-			circle.Description = description
+		if len(req.Description) > 0 {
+			circle.Description = req.Description
 		}
 
 		err = s.UpdateCircle(*circle)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
@@ -135,38 +145,30 @@ func UpdateCircle() gin.HandlerFunc {
 func DeleteCircle() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		circleID := c.Param("circleID")
 		circle, err := s.GetCircleByID(circleID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
 		// Check if user owns circle
 		if authUser.ID != circle.UserID {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "You do not have permission to delete this circle",
-			})
+			respondError(c, http.StatusForbidden, "You do not have permission to delete this circle")
 			return
 		}
 
 		// Delete status
 		err = s.DeleteCircleByID(circleID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
@@ -178,56 +180,48 @@ func DeleteCircle() gin.HandlerFunc {
 func AddUserToCircle() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		circleID := c.Param("circleID")
-		userID := c.PostForm("userID")
+		var req circleUserRequest
+		if !bindRequest(c, &req) {
+			return
+		}
+		userID := req.UserID
 
 		// Target user cannot be auth user
 		if authUser.ID == userID {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Cannot add self to circle",
-			})
+			respondError(c, http.StatusBadRequest, "Cannot add self to circle")
 			return
 		}
 
 		circle, err := s.GetCircleByID(circleID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
 		// Check if user owns circle
 		if authUser.ID != circle.UserID {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "You do not have permission to edit this circle",
-			})
+			respondError(c, http.StatusForbidden, "You do not have permission to edit this circle")
 			return
 		}
 
 		// Add target user to circle
 		targetUser, err := s.GetUserByID(userID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
 		err = s.InsertCircleUserPair(targetUser.ID, circle.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
@@ -239,56 +233,48 @@ func AddUserToCircle() gin.HandlerFunc {
 func RemoveUserFromCircle() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		circleID := c.Param("circleID")
-		userID := c.PostForm("userID")
+		var req circleUserRequest
+		if !bindRequest(c, &req) {
+			return
+		}
+		userID := req.UserID
 
 		// Target user cannot be auth user
 		if authUser.ID == userID {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Cannot add self to circle",
-			})
+			respondError(c, http.StatusBadRequest, "Cannot add self to circle")
 			return
 		}
 
 		circle, err := s.GetCircleByID(circleID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
 		// Check if user owns circle
 		if authUser.ID != circle.UserID {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "You do not have permission to edit this circle",
-			})
+			respondError(c, http.StatusForbidden, "You do not have permission to edit this circle")
 			return
 		}
 
 		// Remove target user from circle
 		targetUser, err := s.GetUserByID(userID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
 		err = s.DeleteCircleUserPair(targetUser.ID, circle.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
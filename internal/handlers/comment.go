@@ -3,22 +3,99 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/validate"
+)
+
+// commentRequest is the form to post or edit a comment
+type commentRequest struct {
+	Content string `form:"content" json:"content"`
+}
+
+// validate checks comment content
+func (req commentRequest) validate() validate.Errors {
+
+	errs := validate.Errors{}
+	validate.Text(errs, "content", req.Content, true)
+
+	return errs
+}
+
+// getVisibleComment gets comment and its status if the status is visible to user
+func getVisibleComment(c *gin.Context, s store.Repository, commentID string, authUser *store.User) (*store.Comment, *store.Status, bool) {
+
+	comment, err := s.GetCommentByID(commentID)
+	if err != nil {
+		respondStoreError(c, err)
+		return nil, nil, false
+	}
+
+	status, err := s.GetVisibleStatusByID(comment.StatusID, authUserID(authUser))
+	if err != nil {
+		respondError(c, http.StatusNotFound, "No comment found")
+		return nil, nil, false
+	}
+
+	return comment, status, true
+}
+
+// Comment chain bounds
+const (
+	defaultChainDepth   = 3
+	maxChainDepth       = 10
+	defaultChainReplies = 10
 )
 
 // GetCommentChain gets a comment chain by parent comment
+//
+// Depth sets how many levels of replies are loaded and limit sets how many replies are
+// loaded per comment. Cursor continues the top comment's replies from a moreReplies cursor.
 func GetCommentChain() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		commentID := c.Param("commentID")
 		authUser, _ := c.MustGet("authUser").(*store.User)
 
-		c.JSON(http.StatusOK, buildCommentChainResponse(s, commentID, authUser, 3))
+		depth, err := strconv.Atoi(c.DefaultQuery("depth", strconv.Itoa(defaultChainDepth)))
+		if err != nil || depth < 0 {
+			respondError(c, http.StatusBadRequest, "Invalid depth")
+			return
+		}
+		if depth > maxChainDepth {
+			depth = maxChainDepth
+		}
+
+		limit, cursor, ok := parsePage(c, defaultChainReplies)
+		if !ok {
+			return
+		}
+
+		_, _, ok = getVisibleComment(c, s, commentID, authUser)
+		if !ok {
+			return
+		}
+
+		// Get one extra reply per comment to check for more replies and one extra level to check
+		// whether comments at depth have replies
+		subtree, err := s.GetCommentSubtree(commentID, depth+1, limit+1, cursor)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		response, err := buildCommentChainResponse(s, subtree, depth, limit, authUser)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -26,24 +103,29 @@ func GetCommentChain() gin.HandlerFunc {
 func PostReply() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		commentID := c.Param("commentID")
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		replyID := uuid.New().String()
-		content := c.PostForm("content")
+		var req commentRequest
+		if !bindRequest(c, &req) || respondInvalid(c, req.validate()) {
+			return
+		}
 
 		parentComment, err := s.GetCommentByID(commentID)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
+			return
+		}
+
+		_, err = s.GetVisibleStatusByID(parentComment.StatusID, authUser.ID)
+		if err != nil {
+			respondError(c, http.StatusNotFound, "No comment found")
 			return
 		}
 
@@ -52,18 +134,228 @@ func PostReply() gin.HandlerFunc {
 			UserID:          authUser.ID,
 			StatusID:        parentComment.StatusID,
 			ParentCommentID: sql.NullString{String: parentComment.ID, Valid: true},
-			Content:         content,
+			Content:         req.Content,
 			PostedTimestamp: time.Now(),
 			IsEdited:        false,
 		}
 		err = s.InsertComment(comment)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
+			return
+		}
+
+		// New comment has not been liked yet
+		response, err := buildCommentResponse(s, comment, authUser)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// UpdateComment updates comment
+func UpdateComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		commentID := c.Param("commentID")
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		var req commentRequest
+		if !bindRequest(c, &req) {
+			return
+		}
+
+		comment, _, ok := getVisibleComment(c, s, commentID, authUser)
+		if !ok {
+			return
+		}
+		if comment.IsDeleted {
+			respondError(c, http.StatusNotFound, "No comment found")
+			return
+		}
+
+		// Check if user is poster
+		if comment.UserID != authUser.ID {
+			respondError(c, http.StatusForbidden, "You do not have permission to edit this comment")
+			return
+		}
+
+		if respondInvalid(c, req.validate()) {
+			return
+		}
+
+		// Update comment, keeping its place in the thread
+		comment.Content = req.Content
+		comment.IsEdited = true
+
+		err := s.UpdateComment(*comment)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		response, err := buildCommentResponse(s, *comment, authUser)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// DeleteComment deletes comment
+//
+// Comments that still have replies are blanked out as tombstones so the thread
+// stays intact. Deleting the last reply under a tombstone removes the tombstone.
+func DeleteComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		commentID := c.Param("commentID")
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		comment, status, ok := getVisibleComment(c, s, commentID, authUser)
+		if !ok {
+			return
+		}
+		if comment.IsDeleted {
+			respondError(c, http.StatusNotFound, "No comment found")
+			return
+		}
+
+		// Check if user is poster or owns status
+		if comment.UserID != authUser.ID && status.UserID != authUser.ID {
+			respondError(c, http.StatusForbidden, "You do not have permission to delete this comment")
+			return
+		}
+
+		replyCount, err := s.GetCommentReplyCount(comment.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		// Leave tombstone if comment has replies
+		if replyCount > 0 {
+			comment.Content = ""
+			comment.IsDeleted = true
+			err = s.UpdateComment(*comment)
+			if err != nil {
+				respondStoreError(c, err)
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{})
+			return
+		}
+
+		err = s.DeleteCommentByID(comment.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		// Remove tombstones left without replies
+		parentID := comment.ParentCommentID
+		for parentID.Valid {
+			parent, err := s.GetCommentByID(parentID.String)
+			if err != nil || !parent.IsDeleted {
+				break
+			}
+			replyCount, err := s.GetCommentReplyCount(parent.ID)
+			if err != nil || replyCount > 0 {
+				break
+			}
+			if err := s.DeleteCommentByID(parent.ID); err != nil {
+				break
+			}
+			parentID = parent.ParentCommentID
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+// LikeComment likes comment
+func LikeComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		commentID := c.Param("commentID")
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		comment, _, ok := getVisibleComment(c, s, commentID, authUser)
+		if !ok {
+			return
+		}
+		if comment.IsDeleted {
+			respondError(c, http.StatusNotFound, "No comment found")
+			return
+		}
+
+		// Update comment likes
+		err := s.InsertCommentLikePair(authUser.ID, comment.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		response, err := buildCommentResponse(s, *comment, authUser)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// UnlikeComment unlikes comment
+func UnlikeComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		commentID := c.Param("commentID")
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		comment, _, ok := getVisibleComment(c, s, commentID, authUser)
+		if !ok {
+			return
+		}
+
+		// Update comment likes
+		err := s.DeleteCommentLikePair(authUser.ID, comment.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		response, err := buildCommentResponse(s, *comment, authUser)
+		if err != nil {
+			respondStoreError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, buildCommentResponse(s, *authUser, comment, authUser))
+		c.JSON(http.StatusOK, response)
 	}
 }
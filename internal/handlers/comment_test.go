@@ -0,0 +1,373 @@
+package handlers_test
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// insertTestComment inserts comment for test
+func insertTestComment(t *testing.T, s store.Repository, commentID string, userID string, statusID string, parentID string) {
+
+	err := s.InsertComment(store.Comment{
+		ID:              commentID,
+		UserID:          userID,
+		StatusID:        statusID,
+		ParentCommentID: sql.NullString{String: parentID, Valid: len(parentID) > 0},
+		Content:         "I posted this comment",
+		PostedTimestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateCommentSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "67890", store.VisibilityPublic)
+	insertTestComment(t, s, "fghij", "12345", "abcde", "")
+	original, _ := s.GetCommentByID("fghij")
+
+	// Update comment
+	data := url.Values{}
+	data.Set("content", "I edited this comment")
+	req, err := http.NewRequest("PUT", "/api/v1/comment/fghij", bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	comment, _ := s.GetCommentByID("fghij")
+	assert.Equal(t, "I edited this comment", comment.Content)
+	assert.True(t, comment.IsEdited)
+	assert.True(t, original.PostedTimestamp.Equal(comment.PostedTimestamp))
+}
+
+func TestUpdateCommentFailNotPoster(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "12345", store.VisibilityPublic)
+	insertTestComment(t, s, "fghij", "67890", "abcde", "")
+
+	// Update comment
+	data := url.Values{}
+	data.Set("content", "I edited this comment")
+	req, err := http.NewRequest("PUT", "/api/v1/comment/fghij", bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	comment, _ := s.GetCommentByID("fghij")
+	assert.Equal(t, "I posted this comment", comment.Content)
+}
+
+func TestDeleteCommentByStatusOwner(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "12345", store.VisibilityPublic)
+	insertTestComment(t, s, "fghij", "67890", "abcde", "")
+
+	// Delete comment
+	req, err := http.NewRequest("DELETE", "/api/v1/comment/fghij", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	_, err = s.GetCommentByID("fghij")
+	assert.Error(t, err)
+}
+
+func TestDeleteCommentLeavesTombstone(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "12345", store.VisibilityPublic)
+	insertTestComment(t, s, "fghij", "12345", "abcde", "")
+	insertTestComment(t, s, "klmno", "67890", "abcde", "fghij")
+
+	// Delete comment with reply
+	req, err := http.NewRequest("DELETE", "/api/v1/comment/fghij", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	comment, err := s.GetCommentByID("fghij")
+	if assert.NoError(t, err) {
+		assert.True(t, comment.IsDeleted)
+		assert.Empty(t, comment.Content)
+	}
+
+	// Tombstone is served without poster
+	req, _ = http.NewRequest("GET", "/api/v1/comment/fghij", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body := decodeBody(t, rr)
+	if tombstone, ok := body["comment"].(map[string]interface{}); assert.True(t, ok) {
+		assert.Equal(t, true, tombstone["isDeleted"])
+		assert.Equal(t, "", tombstone["poster"].(map[string]interface{})["id"])
+	}
+
+	// Deleting last reply removes tombstone
+	req, _ = http.NewRequest("DELETE", "/api/v1/comment/klmno", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	_, err = s.GetCommentByID("fghij")
+	assert.Error(t, err)
+}
+
+func TestLikeCommentSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "67890", store.VisibilityPublic)
+	insertTestComment(t, s, "fghij", "67890", "abcde", "")
+
+	// Like comment
+	req, err := http.NewRequest("POST", "/api/v1/comment/fghij/like", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body := decodeBody(t, rr)
+	assert.Equal(t, float64(1), body["likes"])
+
+	// Unlike comment
+	req, _ = http.NewRequest("POST", "/api/v1/comment/fghij/unlike", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body = decodeBody(t, rr)
+	assert.Equal(t, float64(0), body["likes"])
+}
+
+func TestLikeCommentFailNotVisible(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "67890", store.VisibilityPrivate)
+	insertTestComment(t, s, "fghij", "67890", "abcde", "")
+
+	// Like comment
+	req, err := http.NewRequest("POST", "/api/v1/comment/fghij/like", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	count, _ := s.GetCommentLikes("fghij")
+	assert.Equal(t, 0, count)
+}
+
+func TestGetCommentChainIsLiked(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "67890", store.VisibilityPublic)
+	insertTestComment(t, s, "fghij", "67890", "abcde", "")
+	insertTestComment(t, s, "klmno", "67890", "abcde", "fghij")
+	insertTestComment(t, s, "pqrst", "67890", "abcde", "fghij")
+	s.InsertCommentLikePair("12345", "klmno")
+	s.InsertCommentLikePair("67890", "pqrst")
+
+	// Get comment chain
+	req, err := http.NewRequest("GET", "/api/v1/comment/fghij", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body := decodeBody(t, rr)
+	isLiked := make(map[string]interface{})
+	for _, reply := range body["replies"].([]interface{}) {
+		comment := reply.(map[string]interface{})["comment"].(map[string]interface{})
+		isLiked[comment["id"].(string)] = comment["isLiked"]
+	}
+	assert.Equal(t, map[string]interface{}{"klmno": true, "pqrst": false}, isLiked)
+}
+
+func TestGetCommentChainFailNotFound(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	// Get comment chain
+	req, err := http.NewRequest("GET", "/api/v1/comment/fghij", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestGetCommentChainMoreReplies(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "67890", store.VisibilityPublic)
+	insertTestComment(t, s, "root", "67890", "abcde", "")
+	replyIDs := []string{
+		"00000000-0000-0000-0002-000000000001",
+		"00000000-0000-0000-0002-000000000002",
+		"00000000-0000-0000-0002-000000000003",
+	}
+	for _, replyID := range replyIDs {
+		insertTestComment(t, s, replyID, "67890", "abcde", "root")
+	}
+	insertTestComment(t, s, "nested", "67890", "abcde", replyIDs[2])
+
+	// Get first replies only one level deep
+	req, err := http.NewRequest("GET", "/api/v1/comment/root?depth=1&limit=2", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body := decodeBody(t, rr)
+	replies := body["replies"].([]interface{})
+	if assert.Len(t, replies, 2) {
+		assert.Nil(t, replies[0].(map[string]interface{})["replies"])
+	}
+	moreReplies := body["moreReplies"].(string)
+	assert.NotEmpty(t, moreReplies)
+
+	// Continue replies from cursor
+	req, _ = http.NewRequest("GET", "/api/v1/comment/root?depth=1&limit=2&cursor="+url.QueryEscape(moreReplies), nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body = decodeBody(t, rr)
+	assert.Len(t, body["replies"].([]interface{}), 1)
+	assert.Empty(t, body["moreReplies"])
+}
+
+func TestGetCommentChainHasReplies(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "67890", store.VisibilityPublic)
+	insertTestComment(t, s, "root", "67890", "abcde", "")
+	insertTestComment(t, s, "reply", "67890", "abcde", "root")
+	insertTestComment(t, s, "nested", "67890", "abcde", "reply")
+	insertTestComment(t, s, "deepest", "67890", "abcde", "nested")
+
+	// Get chain shallower than the thread
+	req, err := http.NewRequest("GET", "/api/v1/comment/root?depth=2", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body := decodeBody(t, rr)
+	assert.Equal(t, true, body["hasReplies"])
+
+	reply := body["replies"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, true, reply["hasReplies"])
+
+	// Cut off comment has no replies loaded but shows it has some
+	nested := reply["replies"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "nested", nested["comment"].(map[string]interface{})["id"])
+	assert.Nil(t, nested["replies"])
+	assert.Equal(t, true, nested["hasReplies"])
+
+	// Full depth reaches a comment with no replies
+	req, _ = http.NewRequest("GET", "/api/v1/comment/nested?depth=2", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	body = decodeBody(t, rr)
+	deepest := body["replies"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, false, deepest["hasReplies"])
+	assert.Empty(t, deepest["replies"])
+}
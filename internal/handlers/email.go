@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jasmaa/galt/internal/mailer"
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// emailVerificationTokenTTL is how long email verification tokens are valid
+const emailVerificationTokenTTL = 24 * time.Hour
+
+// sendVerificationEmail mails new verification token for user's email, replacing older tokens
+func sendVerificationEmail(s store.Repository, m mailer.Mailer, user store.User) error {
+
+	err := s.DeleteUserEmailVerificationTokens(user.ID)
+	if err != nil {
+		return err
+	}
+
+	verificationToken, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = s.InsertEmailVerificationToken(store.EmailVerificationToken{
+		ID:               uuid.New().String(),
+		UserID:           user.ID,
+		Email:            user.Email,
+		TokenHash:        hashToken(verificationToken),
+		CreatedTimestamp: now,
+		ExpiresTimestamp: now.Add(emailVerificationTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Use this code to verify the email for %s:\n\n%s\n\nIt expires in %d hours.\n",
+			user.Username, verificationToken, int(emailVerificationTokenTTL.Hours()),
+		),
+	})
+}
+
+// verifyEmailRequest is the form to verify an email
+type verifyEmailRequest struct {
+	Token string `form:"token" json:"token"`
+}
+
+// VerifyEmail marks user's email as verified with verification token
+func VerifyEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		var req verifyEmailRequest
+		if !bindRequest(c, &req) {
+			return
+		}
+
+		verificationToken, err := s.GetEmailVerificationTokenByHash(hashToken(req.Token))
+		if err != nil || time.Now().After(verificationToken.ExpiresTimestamp) {
+			respondError(c, http.StatusBadRequest, "Invalid verification token")
+			return
+		}
+
+		// Token only verifies the address it was sent to
+		user, err := s.GetUserByID(verificationToken.UserID)
+		if err != nil || user.Email != verificationToken.Email {
+			respondError(c, http.StatusBadRequest, "Invalid verification token")
+			return
+		}
+
+		user.IsEmailVerified = true
+		err = s.UpdateUser(*user)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		err = s.DeleteUserEmailVerificationTokens(user.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+// ResendVerificationEmail mails a new verification token to user's email
+func ResendVerificationEmail(m mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		if len(authUser.Email) == 0 {
+			respondError(c, http.StatusBadRequest, "No email entered")
+			return
+		}
+		if authUser.IsEmailVerified {
+			respondError(c, http.StatusBadRequest, "Email already verified")
+			return
+		}
+
+		err := sendVerificationEmail(s, m, *authUser)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
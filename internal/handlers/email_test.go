@@ -0,0 +1,180 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/handlers"
+	"github.com/jasmaa/galt/internal/middleware"
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// postTestForm posts form with optional auth header
+func postTestForm(t *testing.T, r http.Handler, path string, data url.Values, authHeader string) *httptest.ResponseRecorder {
+
+	req, err := http.NewRequest("POST", path, bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(authHeader) > 0 {
+		req.Header.Set("Authorization", authHeader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestCreateAccountVerifyEmail(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	// Create account with email
+	rr := postTestForm(t, r, "/api/v1/createAccount", url.Values{
+		"username": {"mario"},
+		"password": {"itsamemario"},
+		"email":    {"Mario@Example.com"},
+	}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	user, err := s.GetUserByUsername("mario")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "mario@example.com", user.Email)
+		assert.False(t, user.IsEmailVerified)
+	}
+
+	// Verify email
+	token := readTestMailToken(t, "mario@example.com")
+	rr = postTestForm(t, r, "/api/v1/user/email/verify", url.Values{"token": {token}}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	user, _ = s.GetUserByUsername("mario")
+	assert.True(t, user.IsEmailVerified)
+
+	// Tokens are single use
+	rr = postTestForm(t, r, "/api/v1/user/email/verify", url.Values{"token": {token}}, "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestCreateAccountFailDuplicateEmail(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	setTestEmail(t, s, "12345", "taken@example.com")
+
+	// Create account with taken email
+	rr := postTestForm(t, r, "/api/v1/createAccount", url.Values{
+		"username": {"luigi"},
+		"password": {"itsamemario"},
+		"email":    {"TAKEN@example.com"},
+	}, "")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	_, err := s.GetUserByUsername("luigi")
+	assert.Error(t, err)
+}
+
+func TestUpdateProfileEmailUnverifies(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	setTestEmail(t, s, "12345", "old@example.com")
+
+	// Get token for old address
+	rr := postTestForm(t, r, "/api/v1/user/email/resend", url.Values{}, testAuthHeader)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	oldToken := readTestMailToken(t, "old@example.com")
+
+	// Change email
+	req, _ := http.NewRequest("PUT", "/api/v1/user", bytes.NewBufferString(url.Values{"email": {"new@example.com"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", testAuthHeader)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Token for old address no longer verifies
+	rr = postTestForm(t, r, "/api/v1/user/email/verify", url.Values{"token": {oldToken}}, "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Token for new address does
+	newToken := readTestMailToken(t, "new@example.com")
+	rr = postTestForm(t, r, "/api/v1/user/email/verify", url.Values{"token": {newToken}}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	user, _ := s.GetUserByID("12345")
+	assert.True(t, user.IsEmailVerified)
+}
+
+func TestResendVerificationEmailFailNoEmail(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := postTestForm(t, r, "/api/v1/user/email/resend", url.Values{}, testAuthHeader)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestForgotPasswordByEmail(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	setTestEmail(t, s, "12345", "forgot-by-email@example.com")
+
+	rr := postTestForm(t, r, "/api/v1/password/forgot", url.Values{"email": {"Forgot-By-Email@example.com"}}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	token := readTestMailToken(t, "forgot-by-email@example.com")
+	rr = resetTestPassword(t, r, token, "newpassword")
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	v1 := r.Group("/api/v1")
+	v1.Use(func(c *gin.Context) {
+		c.Set("store", s)
+		c.Next()
+	})
+	v1.Use(middleware.AuthUser(testKeySet))
+	v1.POST("/status", middleware.RequireVerifiedEmail(true), handlers.PostStatus())
+
+	data := url.Values{
+		"content":    {"Hello world"},
+		"visibility": {store.VisibilityPublic},
+	}
+
+	// Unverified users cannot post
+	rr := postTestForm(t, r, "/api/v1/status", data, testAuthHeader)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// Verified users can
+	user, _ := s.GetUserByID("12345")
+	user.Email = "verified@example.com"
+	user.IsEmailVerified = true
+	if err := s.UpdateUser(*user); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = postTestForm(t, r, "/api/v1/status", data, testAuthHeader)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
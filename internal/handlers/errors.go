@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jasmaa/galt/internal/apierror"
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// respondError responds with error envelope for status
+func respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, apierror.New(status, message, nil))
+}
+
+// respondStoreError responds with status matching kind of store error
+//
+// Unexpected errors are logged and answered with 500. Only store errors have
+// messages meant for clients so others are replaced with a generic one.
+func respondStoreError(c *gin.Context, err error) {
+
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		respondError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrConflict):
+		respondError(c, http.StatusConflict, err.Error())
+	case errors.Is(err, store.ErrForbidden):
+		respondError(c, http.StatusForbidden, err.Error())
+	default:
+		c.Error(err)
+
+		var storeErr *store.Error
+		if errors.As(err, &storeErr) {
+			respondError(c, http.StatusInternalServerError, storeErr.Message)
+		} else {
+			respondError(c, http.StatusInternalServerError, "Internal server error")
+		}
+	}
+}
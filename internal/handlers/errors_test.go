@@ -0,0 +1,85 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+func TestGetStatusFailNotFound(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	req, _ := http.NewRequest("GET", "/api/v1/status/missing", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, map[string]interface{}{"code": "not_found", "message": "No status found"}, decodeError(t, rr))
+}
+
+func TestPostReplyFailParentNotFound(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := postTestForm(t, r, "/api/v1/comment/missing", url.Values{"content": {"Hello"}}, testAuthHeader)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "not_found", decodeError(t, rr)["code"])
+}
+
+func TestCreateAccountFailDuplicateUsername(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := postTestForm(t, r, "/api/v1/createAccount", url.Values{
+		"username": {"testuser"},
+		"password": {"anotherpassword"},
+	}, "")
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "conflict", decodeError(t, rr)["code"])
+}
+
+func TestDeleteStatusFailNotPosterCode(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "67890", store.VisibilityPublic)
+
+	req, _ := http.NewRequest("DELETE", "/api/v1/status/abcde", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, "forbidden", decodeError(t, rr)["code"])
+}
+
+func TestInvalidTokenErrorEnvelope(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	req, _ := http.NewRequest("GET", "/api/v1/user", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, map[string]interface{}{"code": "unauthorized", "message": "Invalid token"}, decodeError(t, rr))
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/takeout"
+)
+
+const (
+	// exportTTL is how long exports can be downloaded before they are deleted
+	exportTTL = 7 * 24 * time.Hour
+
+	// maxImportSize is the largest archive that can be uploaded for import
+	maxImportSize = 32 << 20
+)
+
+type apiExport struct {
+	ID               string    `form:"id" json:"id" binding:"required"`
+	State            string    `form:"state" json:"state" binding:"required"`
+	CreatedTimestamp time.Time `form:"createdTimestamp" json:"createdTimestamp" binding:"required"`
+	ExpiresTimestamp time.Time `form:"expiresTimestamp" json:"expiresTimestamp" binding:"required"`
+}
+
+func buildExportResponse(export store.Export) apiExport {
+	return apiExport{
+		ID:               export.ID,
+		State:            export.State,
+		CreatedTimestamp: export.CreatedTimestamp,
+		ExpiresTimestamp: export.ExpiresTimestamp,
+	}
+}
+
+// buildExport builds archive of user data and stores it with export
+//
+// Runs in the background after the request that started it has been answered.
+func buildExport(s store.Repository, export store.Export) {
+
+	state := store.ExportReady
+	var buf bytes.Buffer
+
+	archive, err := takeout.Build(s, export.UserID, time.Now())
+	if err == nil {
+		err = takeout.Write(&buf, archive)
+	}
+	if err != nil {
+		log.Printf("Error building export %s: %v", export.ID, err)
+		state = store.ExportFailed
+		buf.Reset()
+	}
+
+	if err := s.FinishExport(export.ID, state, buf.Bytes()); err != nil {
+		log.Printf("Error finishing export %s: %v", export.ID, err)
+	}
+}
+
+// RequestExport starts building an archive of the user's data
+//
+// Responds before the archive is built. Poll GetExport until it is ready to download. Users can only
+// have one export building at a time.
+func RequestExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		now := time.Now()
+		export := store.Export{
+			ID:               uuid.New().String(),
+			UserID:           authUser.ID,
+			State:            store.ExportPending,
+			CreatedTimestamp: now,
+			ExpiresTimestamp: now.Add(exportTTL),
+		}
+		err := s.InsertExport(export)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		go buildExport(s, export)
+
+		c.JSON(http.StatusAccepted, buildExportResponse(export))
+	}
+}
+
+// GetExport downloads export once it is ready
+//
+// Responds with the export's state while it is still being built.
+func GetExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		// Exports of other users are hidden rather than forbidden
+		export, err := s.GetExportByID(c.Param("exportID"))
+		if err != nil || export.UserID != authUser.ID {
+			respondError(c, http.StatusNotFound, "No export found")
+			return
+		}
+
+		if !time.Now().Before(export.ExpiresTimestamp) {
+			respondError(c, http.StatusGone, "Export expired")
+			return
+		}
+
+		switch export.State {
+		case store.ExportPending:
+			c.JSON(http.StatusAccepted, buildExportResponse(*export))
+		case store.ExportReady:
+			c.Header("Content-Disposition", `attachment; filename="galt-export-`+export.CreatedTimestamp.Format("20060102")+`.zip"`)
+			c.Data(http.StatusOK, "application/zip", export.Archive)
+		default:
+			respondError(c, http.StatusInternalServerError, "Export failed")
+		}
+	}
+}
+
+// ImportArchive adds data from an uploaded export archive to the user
+//
+// Everything gets new ids but keeps when it was posted. Responds with a report of what could not be
+// imported, including circle members with no user of the same username here.
+func ImportArchive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+		header, err := c.FormFile("archive")
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Archive required")
+			return
+		}
+		f, err := header.Open()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Archive required")
+			return
+		}
+		defer f.Close()
+
+		archive, err := takeout.Read(f, header.Size)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		report, err := takeout.Import(s, authUser.ID, archive)
+		var invalid *takeout.ValidationError
+		if errors.As(err, &invalid) {
+			respondInvalid(c, invalid.Fields)
+			return
+		}
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,294 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/takeout"
+)
+
+// getTestExport gets export as test user
+func getTestExport(t *testing.T, r http.Handler, exportID string) *httptest.ResponseRecorder {
+
+	req, err := http.NewRequest("GET", "/api/v1/export/"+exportID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", testAuthHeader)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// waitTestExport polls export until it is no longer pending
+func waitTestExport(t *testing.T, r http.Handler, exportID string) *httptest.ResponseRecorder {
+
+	for i := 0; i < 100; i++ {
+		rr := getTestExport(t, r, exportID)
+		if rr.Code != http.StatusAccepted {
+			return rr
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Export still pending")
+
+	return nil
+}
+
+// insertTestExport inserts export for user expiring at time
+func insertTestExport(t *testing.T, s store.Repository, exportID string, userID string, state string, expires time.Time) {
+
+	err := s.InsertExport(store.Export{
+		ID:               exportID,
+		UserID:           userID,
+		State:            state,
+		Archive:          []byte("archive"),
+		CreatedTimestamp: expires.Add(-time.Hour),
+		ExpiresTimestamp: expires,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "12345", store.VisibilityPublic)
+	insertTestStatus(t, s, "fghij", "67890", store.VisibilityPublic)
+	if err := s.InsertStatusLikePair("12345", "fghij"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertCircle(store.Circle{ID: "circle1", UserID: "12345", Name: "Friends"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.InsertCircleUserPair("67890", "circle1"); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := sendTestJSON(t, r, "POST", "/api/v1/export", nil, testAuthHeader)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	body := decodeBody(t, rr)
+	assert.Equal(t, store.ExportPending, body["state"])
+
+	rr = waitTestExport(t, r, body["id"].(string))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "attachment")
+
+	// Archive holds data and an index
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = ioutil.ReadAll(rc)
+		rc.Close()
+	}
+
+	var archive takeout.Archive
+	if err := json.Unmarshal(files[takeout.DataFile], &archive); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "testuser", archive.Profile.Username)
+	if assert.Len(t, archive.Statuses, 1) {
+		assert.Equal(t, "abcde", archive.Statuses[0].ID)
+	}
+	assert.Equal(t, []string{"fghij"}, archive.Likes.StatusIDs)
+	if assert.Len(t, archive.Circles, 1) {
+		assert.Equal(t, []takeout.Member{{ID: "67890", Username: "otheruser"}}, archive.Circles[0].Members)
+	}
+	assert.Contains(t, string(files[takeout.IndexFile]), "Friends")
+}
+
+func TestExportFailOtherUser(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestExport(t, s, "export1", "67890", store.ExportReady, time.Now().Add(time.Hour))
+
+	rr := getTestExport(t, r, "export1")
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestExportFailExpired(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestExport(t, s, "export1", "12345", store.ExportReady, time.Now().Add(-time.Minute))
+
+	rr := getTestExport(t, r, "export1")
+
+	assert.Equal(t, http.StatusGone, rr.Code)
+	assert.Equal(t, "gone", decodeError(t, rr)["code"])
+}
+
+func TestExportFailBuildFailed(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestExport(t, s, "export1", "12345", store.ExportFailed, time.Now().Add(time.Hour))
+
+	rr := getTestExport(t, r, "export1")
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestExportFailAlreadyPending(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestExport(t, s, "export1", "12345", store.ExportPending, time.Now().Add(time.Hour))
+
+	rr := sendTestJSON(t, r, "POST", "/api/v1/export", nil, testAuthHeader)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestExportFailNotAuthorized(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := sendTestJSON(t, r, "POST", "/api/v1/export", nil, "")
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+// postTestArchive uploads archive for import as test user
+func postTestArchive(t *testing.T, r http.Handler, archive []byte) *httptest.ResponseRecorder {
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("archive", "export.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(archive)
+	mw.Close()
+
+	req, err := http.NewRequest("POST", "/api/v1/user/import", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", testAuthHeader)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// writeTestArchive writes archive with status and circle
+func writeTestArchive(t *testing.T, content string, posted time.Time) []byte {
+
+	archive := &takeout.Archive{
+		Version: takeout.Version,
+		Profile: takeout.Profile{ID: "old", Username: "olduser"},
+		Statuses: []takeout.Status{
+			{ID: "status1", Content: content, PostedTimestamp: posted, Visibility: store.VisibilityPublic},
+		},
+		Circles: []takeout.Circle{
+			{ID: "circle1", Name: "Friends", Members: []takeout.Member{
+				{ID: "old2", Username: "otheruser"},
+				{ID: "old3", Username: "missinguser"},
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := takeout.Write(&buf, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestImportSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	posted := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	rr := postTestArchive(t, r, writeTestArchive(t, "Hello", posted))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := decodeBody(t, rr)
+	assert.Equal(t, float64(1), body["statuses"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"id": "old3", "username": "missinguser"}}, body["unmatchedUsers"])
+
+	statuses, _ := s.GetUserStatuses("12345")
+	if assert.Len(t, statuses, 1) {
+		assert.NotEqual(t, "status1", statuses[0].ID)
+		assert.True(t, posted.Equal(statuses[0].PostedTimestamp))
+	}
+	circles, _ := s.GetUserCircles("12345")
+	if assert.Len(t, circles, 1) {
+		members, _ := s.GetCircleUserIDs(circles[0].ID)
+		assert.Equal(t, []string{"67890"}, members)
+	}
+}
+
+func TestImportFailInvalidArchive(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := postTestArchive(t, r, []byte("not a zip"))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "Invalid archive", decodeError(t, rr)["message"])
+}
+
+func TestImportFailInvalidContent(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := postTestArchive(t, r, writeTestArchive(t, " ", time.Now()))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assertFieldErrors(t, rr, "statuses[0].content")
+	statuses, _ := s.GetUserStatuses("12345")
+	assert.Empty(t, statuses)
+}
+
+func TestImportFailNoArchive(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := sendTestJSON(t, r, "POST", "/api/v1/user/import", nil, testAuthHeader)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
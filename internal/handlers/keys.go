@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jasmaa/galt/internal/keys"
+)
+
+// GetJWKS gets public keys that verify access tokens
+func GetJWKS(keySet *keys.KeySet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, gin.H{
+			"keys": keySet.JWKS(),
+		})
+	}
+}
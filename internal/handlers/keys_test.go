@@ -0,0 +1,44 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetJWKSSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	tokens := loginTestUser(t, r)
+
+	// Get keys
+	req, err := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Login token is signed by a published key
+	token, _, err := new(jwt.Parser).ParseUnverified(tokens["token"].(string), jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := decodeBody(t, rr)["keys"].([]interface{})
+	if assert.Len(t, jwks, 1) {
+		jwk := jwks[0].(map[string]interface{})
+		assert.Equal(t, token.Header["kid"], jwk["kid"])
+		assert.Equal(t, "EdDSA", jwk["alg"])
+		assert.Equal(t, "OKP", jwk["kty"])
+		assert.NotContains(t, jwk, "d")
+	}
+}
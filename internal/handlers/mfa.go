@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jasmaa/galt/internal/keys"
+	"github.com/jasmaa/galt/internal/passhash"
+	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/totp"
+)
+
+const (
+	// mfaTokenTTL is how long users have to enter their code after their password
+	mfaTokenTTL = 5 * time.Minute
+
+	// mfaTokenType marks tokens that only allow the second login step
+	mfaTokenType = "mfa"
+
+	totpIssuer        = "Galt"
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+// Reasons a second login step fails, used to leave its transaction
+var (
+	errMFATokenUsed = errors.New("MFA token already used")
+	errInvalidCode  = errors.New("invalid code")
+)
+
+// recoveryCodeEncoding writes recovery codes in lowercase base32
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// issueMFAToken creates token that lets user finish logging in with a code
+func issueMFAToken(keySet *keys.KeySet, userID string) (string, error) {
+
+	now := time.Now()
+
+	return keySet.Sign(jwt.MapClaims{
+		"userID": userID,
+		"jti":    uuid.New().String(),
+		"typ":    mfaTokenType,
+		"iat":    now.Unix(),
+		"exp":    now.Add(mfaTokenTTL).Unix(),
+	})
+}
+
+// generateRecoveryCodes creates recovery codes formatted like abcde-fghjk
+func generateRecoveryCodes() ([]string, error) {
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := recoveryCodeEncoding.EncodeToString(raw)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	return codes, nil
+}
+
+// hashRecoveryCode hashes recovery code ignoring case, spaces and dashes
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return hashToken(code)
+}
+
+// checkSecondFactor checks TOTP or recovery code, using it up
+func checkSecondFactor(s store.Repository, user store.User, code string) (bool, error) {
+
+	code = strings.TrimSpace(code)
+
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), totpSkew); ok {
+		return s.UseTOTPStep(user.ID, step)
+	}
+
+	return s.UseRecoveryCode(user.ID, hashRecoveryCode(code))
+}
+
+// loginMFARequest is the form to finish logging in with a second factor
+type loginMFARequest struct {
+	MFAToken string `form:"mfaToken" json:"mfaToken"`
+	Code     string `form:"code" json:"code"`
+}
+
+// LoginMFA finishes logging in user with TOTP or recovery code
+//
+// Wrong codes count as failed logins so they are throttled like wrong passwords. Each MFA token can
+// only finish one login.
+func LoginMFA(keySet *keys.KeySet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		var req loginMFARequest
+		if !bindRequest(c, &req) {
+			return
+		}
+
+		token, _ := jwt.Parse(req.MFAToken, keySet.Keyfunc)
+		if token == nil || !token.Valid {
+			respondError(c, http.StatusUnauthorized, "Invalid MFA token")
+			return
+		}
+
+		claims, _ := token.Claims.(jwt.MapClaims)
+		userID, _ := claims["userID"].(string)
+		tokenID, _ := claims["jti"].(string)
+		expires, _ := claims["exp"].(float64)
+		if claims["typ"] != mfaTokenType || len(tokenID) == 0 {
+			respondError(c, http.StatusUnauthorized, "Invalid MFA token")
+			return
+		}
+
+		user, err := s.GetUserByID(userID)
+		if err != nil || !user.IsTOTPEnabled {
+			respondError(c, http.StatusUnauthorized, "Invalid MFA token")
+			return
+		}
+
+		now := time.Now()
+		throttles := loginThrottles(user.Username, c.ClientIP())
+		if wait := loginRetryAfter(s, throttles, now); wait > 0 {
+			setRetryAfter(c, wait)
+			respondError(c, http.StatusTooManyRequests, "Too many login attempts")
+			return
+		}
+
+		// Claim token before checking the code so a replayed token cannot use up a code. A wrong
+		// code rolls the claim back so the user can try again.
+		err = s.WithTx(func(tx store.Repository) error {
+
+			used, err := tx.UseMFAToken(store.UsedMFAToken{
+				ID:               tokenID,
+				UserID:           user.ID,
+				ExpiresTimestamp: time.Unix(int64(expires), 0),
+			})
+			if err != nil {
+				return err
+			}
+			if !used {
+				return errMFATokenUsed
+			}
+
+			ok, err := checkSecondFactor(tx, *user, req.Code)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errInvalidCode
+			}
+
+			return nil
+		})
+		if errors.Is(err, errMFATokenUsed) {
+			respondError(c, http.StatusUnauthorized, "Invalid MFA token")
+			return
+		}
+		if errors.Is(err, errInvalidCode) {
+			recordLoginFailure(c, s, throttles, user.Username, now)
+			respondError(c, http.StatusUnauthorized, "Invalid code")
+			return
+		}
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		if err := s.DeleteLoginFailure(throttles[0].key); err != nil {
+			c.Error(err)
+		}
+
+		err = restoreUser(s, user)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		tokens, err := startSession(c, s, keySet, user.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// EnrollTOTP starts two-factor enrollment with a new secret
+//
+// The secret is not required at login until confirmed with ConfirmTOTP.
+func EnrollTOTP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		if authUser.IsTOTPEnabled {
+			respondError(c, http.StatusBadRequest, "Two-factor already enabled")
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		err = s.SetUserTOTP(authUser.ID, secret, false)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":     secret,
+			"otpauthURI": totp.URI(totpIssuer, authUser.Username, secret),
+		})
+	}
+}
+
+// confirmTOTPRequest is the form to confirm two-factor enrollment
+type confirmTOTPRequest struct {
+	Code string `form:"code" json:"code"`
+}
+
+// ConfirmTOTP enables two-factor once user proves their app has the secret
+//
+// Responds with recovery codes. They are only shown this once.
+func ConfirmTOTP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		var req confirmTOTPRequest
+		if !bindRequest(c, &req) {
+			return
+		}
+		code := strings.TrimSpace(req.Code)
+
+		if authUser.IsTOTPEnabled {
+			respondError(c, http.StatusBadRequest, "Two-factor already enabled")
+			return
+		}
+		if len(authUser.TOTPSecret) == 0 {
+			respondError(c, http.StatusBadRequest, "Two-factor enrollment not started")
+			return
+		}
+
+		step, ok := totp.Validate(authUser.TOTPSecret, code, time.Now(), totpSkew)
+		if !ok {
+			respondError(c, http.StatusBadRequest, "Invalid code")
+			return
+		}
+
+		err := s.SetUserTOTP(authUser.ID, authUser.TOTPSecret, true)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		// Code used to confirm cannot also log in
+		_, err = s.UseTOTPStep(authUser.ID, step)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		codes, err := generateRecoveryCodes()
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		hashes := make([]string, len(codes))
+		for i, code := range codes {
+			hashes[i] = hashRecoveryCode(code)
+		}
+
+		err = s.ReplaceRecoveryCodes(authUser.ID, hashes)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"recoveryCodes": codes,
+		})
+	}
+}
+
+// disableTOTPRequest is the form to turn off two-factor
+type disableTOTPRequest struct {
+	Password string `form:"password" json:"password"`
+}
+
+// DisableTOTP turns off two-factor after user re-enters their password
+//
+// Wrong passwords count as failed logins so a stolen session cannot be used to guess the password.
+func DisableTOTP(hasher *passhash.Hasher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		var req disableTOTPRequest
+		if !bindRequest(c, &req) {
+			return
+		}
+
+		if !authUser.IsTOTPEnabled {
+			respondError(c, http.StatusBadRequest, "Two-factor not enabled")
+			return
+		}
+
+		now := time.Now()
+		throttles := loginThrottles(authUser.Username, c.ClientIP())
+		if wait := loginRetryAfter(s, throttles, now); wait > 0 {
+			setRetryAfter(c, wait)
+			respondError(c, http.StatusTooManyRequests, "Too many login attempts")
+			return
+		}
+
+		ok, _, err := hasher.Verify(authUser.PasswordHash, req.Password)
+		if err != nil {
+			c.Error(err)
+		}
+		if !ok {
+			recordLoginFailure(c, s, throttles, authUser.Username, now)
+			respondError(c, http.StatusUnauthorized, "Invalid credentials")
+			return
+		}
+
+		err = s.SetUserTOTP(authUser.ID, "", false)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		err = s.DeleteUserRecoveryCodes(authUser.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
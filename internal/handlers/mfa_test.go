@@ -0,0 +1,219 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/totp"
+)
+
+// enableTestTOTP enrolls and confirms two-factor for test user, returning secret and recovery codes
+func enableTestTOTP(t *testing.T, r http.Handler) (string, []interface{}) {
+
+	rr := postTestForm(t, r, "/api/v1/user/2fa/enroll", url.Values{}, testAuthHeader)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("enroll failed with status %d", rr.Code)
+	}
+	secret := decodeBody(t, rr)["secret"].(string)
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = postTestForm(t, r, "/api/v1/user/2fa/confirm", url.Values{"code": {code}}, testAuthHeader)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("confirm failed with status %d", rr.Code)
+	}
+
+	return secret, decodeBody(t, rr)["recoveryCodes"].([]interface{})
+}
+
+// loginTestUserMFAToken logs in test user with password, expecting an MFA token
+func loginTestUserMFAToken(t *testing.T, r http.Handler) string {
+
+	body := loginTestUser(t, r)
+	assert.Equal(t, true, body["mfaRequired"])
+	assert.NotContains(t, body, "token")
+
+	return body["mfaToken"].(string)
+}
+
+func TestEnrollTOTP(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := postTestForm(t, r, "/api/v1/user/2fa/enroll", url.Values{}, testAuthHeader)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body := decodeBody(t, rr)
+	assert.Contains(t, body["otpauthURI"], "otpauth://totp/Galt:testuser?")
+
+	// Not required until confirmed
+	user, _ := s.GetUserByID("12345")
+	assert.Equal(t, body["secret"], user.TOTPSecret)
+	assert.False(t, user.IsTOTPEnabled)
+	assert.NotContains(t, loginTestUser(t, r), "mfaRequired")
+
+	// Wrong code does not confirm
+	rr = postTestForm(t, r, "/api/v1/user/2fa/confirm", url.Values{"code": {"000000"}}, testAuthHeader)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLoginMFASuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	secret, recoveryCodes := enableTestTOTP(t, r)
+	assert.Len(t, recoveryCodes, 10)
+
+	mfaToken := loginTestUserMFAToken(t, r)
+
+	// MFA token does not authorize requests
+	req, _ := http.NewRequest("GET", "/api/v1/user", nil)
+	req.Header.Set("Authorization", "Bearer "+mfaToken)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Code used to confirm cannot be replayed
+	code, _ := totp.Code(secret, totp.Step(time.Now()))
+	rr = postTestForm(t, r, "/api/v1/login/mfa", url.Values{"mfaToken": {mfaToken}, "code": {code}}, "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Next code logs in
+	code, _ = totp.Code(secret, totp.Step(time.Now())+1)
+	rr = postTestForm(t, r, "/api/v1/login/mfa", url.Values{"mfaToken": {mfaToken}, "code": {code}}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, _ = http.NewRequest("GET", "/api/v1/user", nil)
+	req.Header.Set("Authorization", "Bearer "+decodeBody(t, rr)["token"].(string))
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestLoginMFARecoveryCode(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	_, recoveryCodes := enableTestTOTP(t, r)
+	recoveryCode := recoveryCodes[0].(string)
+
+	mfaToken := loginTestUserMFAToken(t, r)
+
+	// Recovery codes work once
+	rr := postTestForm(t, r, "/api/v1/login/mfa", url.Values{"mfaToken": {mfaToken}, "code": {recoveryCode}}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = postTestForm(t, r, "/api/v1/login/mfa", url.Values{"mfaToken": {mfaToken}, "code": {recoveryCode}}, "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	count, _ := s.GetRecoveryCodeCount("12345")
+	assert.Equal(t, 9, count)
+}
+
+func TestLoginMFAFailReusedToken(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	_, recoveryCodes := enableTestTOTP(t, r)
+
+	mfaToken := loginTestUserMFAToken(t, r)
+
+	// Token finishes one login even with another valid code
+	rr := postTestForm(t, r, "/api/v1/login/mfa", url.Values{"mfaToken": {mfaToken}, "code": {recoveryCodes[0].(string)}}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = postTestForm(t, r, "/api/v1/login/mfa", url.Values{"mfaToken": {mfaToken}, "code": {recoveryCodes[1].(string)}}, "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "Invalid MFA token", decodeError(t, rr)["message"])
+
+	// Replayed token does not use up the other code
+	count, _ := s.GetRecoveryCodeCount("12345")
+	assert.Equal(t, 9, count)
+}
+
+func TestLoginMFABackoff(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	_, recoveryCodes := enableTestTOTP(t, r)
+
+	mfaToken := loginTestUserMFAToken(t, r)
+
+	// Wrong codes are throttled like wrong passwords
+	for i := 0; i < 3; i++ {
+		rr := postTestForm(t, r, "/api/v1/login/mfa", url.Values{"mfaToken": {mfaToken}, "code": {"000000"}}, "")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	}
+	rr := postTestForm(t, r, "/api/v1/login/mfa", url.Values{"mfaToken": {mfaToken}, "code": {recoveryCodes[0].(string)}}, "")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+}
+
+func TestLoginMFAFailAccessToken(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	_, recoveryCodes := enableTestTOTP(t, r)
+
+	// Access token is not an MFA token
+	rr := postTestForm(t, r, "/api/v1/login/mfa", url.Values{
+		"mfaToken": {testAuthHeader[len("Bearer "):]},
+		"code":     {recoveryCodes[0].(string)},
+	}, "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestDisableTOTP(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	enableTestTOTP(t, r)
+
+	// Needs password
+	rr := postTestForm(t, r, "/api/v1/user/2fa/disable", url.Values{"password": {"wrongpassword"}}, testAuthHeader)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = postTestForm(t, r, "/api/v1/user/2fa/disable", url.Values{"password": {"testpassword"}}, testAuthHeader)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	user, _ := s.GetUserByID("12345")
+	assert.Equal(t, store.User{ID: "12345", Username: "testuser", PasswordHash: testPasswordHash}, *user)
+	count, _ := s.GetRecoveryCodeCount("12345")
+	assert.Equal(t, 0, count)
+
+	assert.Contains(t, loginTestUser(t, r), "token")
+}
+
+func TestDisableTOTPBackoff(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	enableTestTOTP(t, r)
+
+	// Wrong passwords are throttled like failed logins
+	for i := 0; i < 3; i++ {
+		rr := postTestForm(t, r, "/api/v1/user/2fa/disable", url.Values{"password": {"wrongpassword"}}, testAuthHeader)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	}
+	rr := postTestForm(t, r, "/api/v1/user/2fa/disable", url.Values{"password": {"testpassword"}}, testAuthHeader)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	user, _ := s.GetUserByID("12345")
+	assert.True(t, user.IsTOTPEnabled)
+}
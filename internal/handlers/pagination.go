@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// Page sizes for paginated lists
+const (
+	defaultPageSize = 30
+	maxPageSize     = 100
+)
+
+// parsePage reads page size and cursor from query
+//
+// Page size is capped at maxPageSize. An empty cursor starts from the newest item.
+func parsePage(c *gin.Context, defaultLimit int) (int, *store.Cursor, bool) {
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit <= 0 {
+		respondError(c, http.StatusBadRequest, "Invalid limit")
+		return 0, nil, false
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	encoded := c.Query("cursor")
+	if len(encoded) == 0 {
+		return limit, nil, true
+	}
+
+	cursor, err := store.DecodeCursor(encoded)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return 0, nil, false
+	}
+
+	return limit, cursor, true
+}
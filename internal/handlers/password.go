@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jasmaa/galt/internal/mailer"
+	"github.com/jasmaa/galt/internal/passhash"
+	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/validate"
+)
+
+// passwordResetTokenTTL is how long password reset tokens are valid
+const passwordResetTokenTTL = time.Hour
+
+// forgotPasswordRequest is the form to ask for a password reset by username or email
+type forgotPasswordRequest struct {
+	Username string `form:"username" json:"username"`
+	Email    string `form:"email" json:"email"`
+}
+
+// sendPasswordReset mails new password reset token to user
+func sendPasswordReset(s store.Repository, m mailer.Mailer, user store.User) {
+
+	resetToken, err := newToken()
+	if err != nil {
+		log.Printf("Error creating password reset token for %s: %v", user.ID, err)
+		return
+	}
+
+	now := time.Now()
+	err = s.InsertPasswordResetToken(store.PasswordResetToken{
+		ID:               uuid.New().String(),
+		UserID:           user.ID,
+		TokenHash:        hashToken(resetToken),
+		CreatedTimestamp: now,
+		ExpiresTimestamp: now.Add(passwordResetTokenTTL),
+	})
+	if err != nil {
+		log.Printf("Error inserting password reset token for %s: %v", user.ID, err)
+		return
+	}
+
+	err = m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Use this code to reset the password for %s:\n\n%s\n\nIt expires in %d minutes. If you did not ask to reset your password, you can ignore this email.\n",
+			user.Username, resetToken, int(passwordResetTokenTTL.Minutes()),
+		),
+	})
+	if err != nil {
+		log.Printf("Error mailing password reset token for %s: %v", user.ID, err)
+	}
+}
+
+// ForgotPassword emails password reset token to user found by username or email
+//
+// Responds the same whether or not the user exists so accounts cannot be probed. The token is
+// made and mailed in the background so known users do not take longer to respond.
+func ForgotPassword(m mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		var req forgotPasswordRequest
+		if !bindRequest(c, &req) {
+			return
+		}
+
+		var user *store.User
+		var err error
+		if len(req.Username) > 0 {
+			user, err = s.GetUserByUsername(req.Username)
+		} else {
+			email, _ := validate.NormalizeEmail(req.Email)
+			user, err = s.GetUserByEmail(email)
+		}
+		if err == nil && len(user.Email) > 0 {
+			go sendPasswordReset(s, m, *user)
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+// resetPasswordRequest is the form to set a new password with a reset token
+type resetPasswordRequest struct {
+	Token    string `form:"token" json:"token"`
+	Password string `form:"password" json:"password"`
+}
+
+// validate checks new password
+//
+// The token is checked against the store instead.
+func (req resetPasswordRequest) validate() validate.Errors {
+
+	errs := validate.Errors{}
+	validate.Password(errs, "password", req.Password, "")
+
+	return errs
+}
+
+// ResetPassword sets new password with password reset token
+//
+// Every session is ended since the old password may have been compromised.
+func ResetPassword(hasher *passhash.Hasher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		var req resetPasswordRequest
+		if !bindRequest(c, &req) || respondInvalid(c, req.validate()) {
+			return
+		}
+
+		resetToken, err := s.GetPasswordResetTokenByHash(hashToken(req.Token))
+		if err != nil || resetToken.IsUsed || time.Now().After(resetToken.ExpiresTimestamp) {
+			respondError(c, http.StatusBadRequest, "Invalid reset token")
+			return
+		}
+
+		used, err := s.UsePasswordResetToken(resetToken.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+		if !used {
+			respondError(c, http.StatusBadRequest, "Invalid reset token")
+			return
+		}
+
+		user, err := s.GetUserByID(resetToken.UserID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Invalid reset token")
+			return
+		}
+
+		// Hash password
+		hash, err := hasher.Hash(req.Password)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		err = s.SetUserPassword(user.ID, hash)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		// Outstanding reset tokens can no longer be used
+		err = s.DeleteUserPasswordResetTokens(user.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		err = s.RevokeUserRefreshTokens(user.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		err = s.DeleteUserSessions(user.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+// changePasswordRequest is the form to change password while logged in
+type changePasswordRequest struct {
+	CurrentPassword string `form:"currentPassword" json:"currentPassword"`
+	NewPassword     string `form:"newPassword" json:"newPassword"`
+}
+
+// validate checks new password against policy for user
+//
+// The current password is checked against the stored hash instead.
+func (req changePasswordRequest) validate(username string) validate.Errors {
+
+	errs := validate.Errors{}
+	if len(req.CurrentPassword) == 0 {
+		errs.Add("currentPassword", "Required")
+	}
+	validate.Password(errs, "newPassword", req.NewPassword, username)
+	if req.NewPassword == req.CurrentPassword {
+		errs.Add("newPassword", "Must differ from current password")
+	}
+
+	return errs
+}
+
+// ChangePassword sets new password after user re-enters their current one
+//
+// Every other session is ended. Wrong current passwords count as failed logins so a
+// stolen session cannot be used to guess the password.
+func ChangePassword(hasher *passhash.Hasher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		var req changePasswordRequest
+		if !bindRequest(c, &req) || respondInvalid(c, req.validate(authUser.Username)) {
+			return
+		}
+
+		now := time.Now()
+		throttles := loginThrottles(authUser.Username, c.ClientIP())
+		if wait := loginRetryAfter(s, throttles, now); wait > 0 {
+			setRetryAfter(c, wait)
+			respondError(c, http.StatusTooManyRequests, "Too many login attempts")
+			return
+		}
+
+		ok, _, err := hasher.Verify(authUser.PasswordHash, req.CurrentPassword)
+		if err != nil {
+			c.Error(err)
+		}
+		if !ok {
+			recordLoginFailure(c, s, throttles, authUser.Username, now)
+			respondError(c, http.StatusUnauthorized, "Invalid credentials")
+			return
+		}
+
+		hash, err := hasher.Hash(req.NewPassword)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		err = s.SetUserPassword(authUser.ID, hash)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		// Reset tokens mailed for the old password can no longer be used
+		err = s.DeleteUserPasswordResetTokens(authUser.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		if !endOtherSessions(c, s, authUser.ID, c.GetString("authSessionID")) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
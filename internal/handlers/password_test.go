@@ -0,0 +1,230 @@
+package handlers_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// forgotTestPassword asks for password reset for username
+func forgotTestPassword(t *testing.T, r http.Handler, username string) *httptest.ResponseRecorder {
+
+	data := url.Values{}
+	data.Set("username", username)
+	req, err := http.NewRequest("POST", "/api/v1/password/forgot", bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// resetTestPassword resets password with reset token
+func resetTestPassword(t *testing.T, r http.Handler, token string, password string) *httptest.ResponseRecorder {
+
+	data := url.Values{}
+	data.Set("token", token)
+	data.Set("password", password)
+	req, err := http.NewRequest("POST", "/api/v1/password/reset", bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// setTestEmail sets email of user
+func setTestEmail(t *testing.T, s store.Repository, userID string, email string) {
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Email = email
+	if err := s.UpdateUser(*user); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResetPasswordSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	setTestEmail(t, s, "12345", "reset-success@example.com")
+
+	// Ask for reset
+	rr := forgotTestPassword(t, r, "testuser")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	token := readTestMailToken(t, "reset-success@example.com")
+
+	// Reset password
+	rr = resetTestPassword(t, r, token, "newpassword")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	user, _ := s.GetUserByID("12345")
+	assert.NotEqual(t, testPasswordHash, user.PasswordHash)
+
+	// Existing sessions are ended
+	req, _ := http.NewRequest("GET", "/api/v1/user", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Tokens are single use
+	rr = resetTestPassword(t, r, token, "otherpassword")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestForgotPasswordUnknownUser(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	// Same response as a real user
+	rr := forgotTestPassword(t, r, "nobody")
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestResetPasswordFailExpiredToken(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	sum := sha256.Sum256([]byte("expiredtoken"))
+	err := s.InsertPasswordResetToken(store.PasswordResetToken{
+		ID:               "reset12345",
+		UserID:           "12345",
+		TokenHash:        hex.EncodeToString(sum[:]),
+		CreatedTimestamp: time.Now().Add(-2 * time.Hour),
+		ExpiresTimestamp: time.Now().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reset with expired token
+	rr := resetTestPassword(t, r, "expiredtoken", "newpassword")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	user, _ := s.GetUserByID("12345")
+	assert.Equal(t, testPasswordHash, user.PasswordHash)
+}
+
+func TestResetPasswordFailNoPassword(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := resetTestPassword(t, r, "sometoken", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+// changeTestPassword changes password of user 12345 in session session12345
+func changeTestPassword(t *testing.T, r http.Handler, currentPassword string, newPassword string) *httptest.ResponseRecorder {
+	return sendTestJSON(t, r, "PUT", "/api/v1/user/password", map[string]string{
+		"currentPassword": currentPassword,
+		"newPassword":     newPassword,
+	}, testAuthHeader)
+}
+
+func TestChangePasswordSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	other := loginTestUser(t, r)
+
+	rr := changeTestPassword(t, r, "testpassword", "newpassword")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// New password is hashed at configured cost
+	user, _ := s.GetUserByID("12345")
+	cost, err := bcrypt.Cost([]byte(user.PasswordHash))
+	if assert.NoError(t, err) {
+		assert.Equal(t, testBcryptCost, cost)
+	}
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("newpassword")))
+
+	// Current session stays logged in
+	req, _ := http.NewRequest("GET", "/api/v1/user", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Other sessions are ended
+	req, _ = http.NewRequest("GET", "/api/v1/user", nil)
+	req.Header.Set("Authorization", "Bearer "+other["token"].(string))
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = refreshTestTokens(t, r, other["refreshToken"].(string))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestChangePasswordFailWrongCurrentPassword(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := changeTestPassword(t, r, "wrongpassword", "newpassword")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	user, _ := s.GetUserByID("12345")
+	assert.Equal(t, testPasswordHash, user.PasswordHash)
+
+	// Counts as a failed login
+	failure, err := s.GetLoginFailure("user:testuser")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, failure.FailureCount)
+	}
+}
+
+func TestChangePasswordFailPolicy(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := changeTestPassword(t, r, "testpassword", "testpassword")
+	assertFieldErrors(t, rr, "newPassword")
+
+	rr = changeTestPassword(t, r, "testpassword", "short")
+	assertFieldErrors(t, rr, "newPassword")
+
+	rr = changeTestPassword(t, r, "testpassword", "TestUser")
+	assertFieldErrors(t, rr, "newPassword")
+
+	rr = changeTestPassword(t, r, "", "newpassword")
+	assertFieldErrors(t, rr, "currentPassword")
+
+	user, _ := s.GetUserByID("12345")
+	assert.Equal(t, testPasswordHash, user.PasswordHash)
+}
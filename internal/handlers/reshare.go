@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/validate"
+)
+
+// reshareRequest is the form to reshare a status
+type reshareRequest struct {
+	Content    string   `form:"content" json:"content"`
+	Visibility string   `form:"visibility" json:"visibility"`
+	CircleIDs  []string `form:"circleIDs" json:"circleIDs"`
+}
+
+// validate checks optional commentary
+func (req reshareRequest) validate() validate.Errors {
+
+	errs := validate.Errors{}
+	validate.Text(errs, "content", req.Content, false)
+
+	return errs
+}
+
+// ReshareStatus reshares a status with optional commentary
+func ReshareStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		statusID := c.Param("statusID")
+		original, err := s.GetVisibleStatusByID(statusID, authUser.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		// Reshare the original post when resharing a reshare
+		if original.ResharedStatusID.Valid {
+			original, err = s.GetVisibleStatusByID(original.ResharedStatusID.String, authUser.ID)
+			if err != nil {
+				respondStoreError(c, err)
+				return
+			}
+		}
+
+		reshareID := uuid.New().String()
+		var req reshareRequest
+		if !bindRequest(c, &req) || respondInvalid(c, req.validate()) {
+			return
+		}
+
+		visibility, circleIDs, ok := parseAudience(c, s, authUser, req.Visibility, req.CircleIDs)
+		if !ok {
+			return
+		}
+
+		// Insert reshare and share with circles
+		reshare := store.Status{
+			ID:               reshareID,
+			UserID:           authUser.ID,
+			Content:          req.Content,
+			PostedTimestamp:  time.Now(),
+			IsEdited:         false,
+			Visibility:       visibility,
+			ResharedStatusID: sql.NullString{String: original.ID, Valid: true},
+		}
+		err = insertStatus(s, reshare, circleIDs)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		response, err := buildStatusResponse(s, reshare, authUser)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// GetReshares gets reshares of a status
+func GetReshares() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, _ := c.MustGet("authUser").(*store.User)
+
+		statusID := c.Param("statusID")
+
+		_, err := s.GetVisibleStatusByID(statusID, authUserID(authUser))
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		limit, cursor, ok := parsePage(c, defaultPageSize)
+		if !ok {
+			return
+		}
+
+		// Get one extra reshare to check for another page
+		reshares, err := s.GetStatusReshares(statusID, authUserID(authUser), limit+1, cursor)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		hasMore := len(reshares) > limit
+		nextCursor := ""
+		if hasMore {
+			reshares = reshares[:limit]
+			last := reshares[limit-1]
+			nextCursor = store.Cursor{PostedTimestamp: last.PostedTimestamp, ID: last.ID}.Encode()
+		}
+
+		apiReshares, err := buildStatusResponses(s, reshares, authUser)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"reshares":   apiReshares,
+			"nextCursor": nextCursor,
+			"hasMore":    hasMore,
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package handlers_test
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+func TestReshareStatusSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "67890", store.VisibilityPublic)
+
+	// Reshare status
+	data := url.Values{}
+	data.Set("content", "Look at this!")
+	req, err := http.NewRequest("POST", "/api/v1/status/abcde/reshare", bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	body := decodeBody(t, rr)
+	assert.Equal(t, "Look at this!", body["content"])
+	if original, ok := body["resharedStatus"].(map[string]interface{}); assert.True(t, ok) {
+		assert.Equal(t, "abcde", original["id"])
+		assert.Equal(t, float64(1), original["reshares"])
+	}
+}
+
+func TestReshareStatusFailNotVisible(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "67890", store.VisibilityPrivate)
+
+	// Reshare status
+	data := url.Values{}
+	data.Set("content", "Look at this!")
+	req, err := http.NewRequest("POST", "/api/v1/status/abcde/reshare", bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	count, _ := s.GetStatusReshareCount("abcde")
+	assert.Equal(t, 0, count)
+}
+
+func TestGetResharesPages(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "abcde", "67890", store.VisibilityPublic)
+	reshareIDs := []string{"00000000-0000-0000-0001-000000000002", "00000000-0000-0000-0001-000000000001"}
+	for i, reshareID := range reshareIDs {
+		err := s.InsertStatus(store.Status{
+			ID:               reshareID,
+			UserID:           "12345",
+			PostedTimestamp:  time.Now().Add(-time.Duration(i) * time.Minute),
+			Visibility:       store.VisibilityPublic,
+			ResharedStatusID: sql.NullString{String: "abcde", Valid: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Page through reshares one at a time
+	cursor := ""
+	for i, reshareID := range reshareIDs {
+		req, _ := http.NewRequest("GET", "/api/v1/status/abcde/reshares?limit=1&cursor="+url.QueryEscape(cursor), nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		body := decodeBody(t, rr)
+		reshares := body["reshares"].([]interface{})
+		if assert.Len(t, reshares, 1) {
+			assert.Equal(t, reshareID, reshares[0].(map[string]interface{})["id"])
+		}
+		assert.Equal(t, i < len(reshareIDs)-1, body["hasMore"])
+		cursor = body["nextCursor"].(string)
+	}
+	assert.Empty(t, cursor)
+}
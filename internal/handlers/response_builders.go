@@ -14,6 +14,15 @@ type apiUser struct {
 }
 
 func buildUserResponse(user store.User) apiUser {
+
+	// Deactivated users look deleted while they can still be restored
+	if user.DeactivatedTimestamp.Valid {
+		return apiUser{
+			ID:       store.DeletedUserID,
+			Username: store.DeletedUsername,
+		}
+	}
+
 	return apiUser{
 		ID:            user.ID,
 		Username:      user.Username,
@@ -22,69 +31,194 @@ func buildUserResponse(user store.User) apiUser {
 	}
 }
 
+type apiProfile struct {
+	ID            string `form:"id" json:"id" binding:"required"`
+	Username      string `form:"username" json:"username" binding:"required"`
+	Description   string `form:"description" json:"description" binding:"required"`
+	ProfileImgURL string `form:"profileImgURL" json:"profileImgURL" binding:"required"`
+	Email         string `form:"email" json:"email" binding:"required"`
+}
+
+// buildProfileResponse builds user response with private fields for the user themselves
+func buildProfileResponse(user store.User) apiProfile {
+	return apiProfile{
+		ID:            user.ID,
+		Username:      user.Username,
+		Description:   user.Description,
+		ProfileImgURL: user.ProfileImgURL,
+		Email:         user.Email,
+	}
+}
+
 type apiStatusNonAuth struct {
-	ID              string    `form:"id" json:"id" binding:"required"`
-	Poster          apiUser   `form:"poster" json:"poster" binding:"required"`
-	Content         string    `form:"content" json:"content" binding:"required"`
-	Likes           int       `form:"likes" json:"likes" binding:"required"`
-	Reshares        int       `form:"reshares" json:"reshares" binding:"required"`
-	PostedTimestamp time.Time `form:"postedTimestamp" json:"postedTimestamp" binding:"required"`
-	IsEdited        bool      `form:"isEdited" json:"isEdited" binding:"required"`
+	ID              string      `form:"id" json:"id" binding:"required"`
+	Poster          apiUser     `form:"poster" json:"poster" binding:"required"`
+	Content         string      `form:"content" json:"content" binding:"required"`
+	Likes           int         `form:"likes" json:"likes" binding:"required"`
+	Reshares        int         `form:"reshares" json:"reshares" binding:"required"`
+	PostedTimestamp time.Time   `form:"postedTimestamp" json:"postedTimestamp" binding:"required"`
+	IsEdited        bool        `form:"isEdited" json:"isEdited" binding:"required"`
+	Visibility      string      `form:"visibility" json:"visibility" binding:"required"`
+	ResharedStatus  interface{} `form:"resharedStatus" json:"resharedStatus"`
 }
 
 type apiStatusAuth struct {
-	ID              string    `form:"id" json:"id" binding:"required"`
-	Poster          apiUser   `form:"poster" json:"poster" binding:"required"`
-	Content         string    `form:"content" json:"content" binding:"required"`
-	Likes           int       `form:"likes" json:"likes" binding:"required"`
-	IsLiked         bool      `form:"isLiked" json:"isLiked" binding:"required"`
-	Reshares        int       `form:"reshares" json:"reshares" binding:"required"`
-	PostedTimestamp time.Time `form:"postedTimestamp" json:"postedTimestamp" binding:"required"`
-	IsEdited        bool      `form:"isEdited" json:"isEdited" binding:"required"`
+	ID              string      `form:"id" json:"id" binding:"required"`
+	Poster          apiUser     `form:"poster" json:"poster" binding:"required"`
+	Content         string      `form:"content" json:"content" binding:"required"`
+	Likes           int         `form:"likes" json:"likes" binding:"required"`
+	IsLiked         bool        `form:"isLiked" json:"isLiked" binding:"required"`
+	Reshares        int         `form:"reshares" json:"reshares" binding:"required"`
+	PostedTimestamp time.Time   `form:"postedTimestamp" json:"postedTimestamp" binding:"required"`
+	IsEdited        bool        `form:"isEdited" json:"isEdited" binding:"required"`
+	Visibility      string      `form:"visibility" json:"visibility" binding:"required"`
+	ResharedStatus  interface{} `form:"resharedStatus" json:"resharedStatus"`
 }
 
-func buildStatusResponse(s store.Store, poster store.User, status store.Status, authUser *store.User) interface{} {
+// statusLookups holds data for rendering statuses that was looked up in batch
+type statusLookups struct {
+	posters   map[string]store.User
+	likes     map[string]int
+	liked     map[string]bool
+	reshares  map[string]int
+	originals map[string]store.Status
+}
 
-	statusLikes, _ := s.GetStatusLikes(status.ID)
+// loadStatusLookups looks up posters, counts and reshared originals for statuses
+//
+// Lookups are batched so the number of queries does not grow with the number of statuses.
+func loadStatusLookups(s store.Repository, statuses []store.Status, authUser *store.User) (statusLookups, error) {
 
-	// Return authenticated response
+	originalIDs := make([]string, 0)
+	for _, status := range statuses {
+		if status.ResharedStatusID.Valid {
+			originalIDs = append(originalIDs, status.ResharedStatusID.String)
+		}
+	}
+	originals, err := s.GetVisibleStatusesByIDs(originalIDs, authUserID(authUser))
+	if err != nil {
+		return statusLookups{}, err
+	}
+
+	all := append([]store.Status{}, statuses...)
+	for _, original := range originals {
+		all = append(all, original)
+	}
+
+	statusIDs := make([]string, len(all))
+	userIDs := make([]string, len(all))
+	for i, status := range all {
+		statusIDs[i] = status.ID
+		userIDs[i] = status.UserID
+	}
+
+	posters, err := s.GetUsersByIDs(userIDs)
+	if err != nil {
+		return statusLookups{}, err
+	}
+	likes, err := s.GetStatusLikeCounts(statusIDs)
+	if err != nil {
+		return statusLookups{}, err
+	}
+	reshares, err := s.GetStatusReshareCounts(statusIDs)
+	if err != nil {
+		return statusLookups{}, err
+	}
+
+	var liked map[string]bool
 	if authUser != nil {
+		liked, err = s.GetUserLikedStatuses(authUser.ID, statusIDs)
+		if err != nil {
+			return statusLookups{}, err
+		}
+	}
+
+	return statusLookups{
+		posters:   posters,
+		likes:     likes,
+		liked:     liked,
+		reshares:  reshares,
+		originals: originals,
+	}, nil
+}
+
+func buildStatusResponse(s store.Repository, status store.Status, authUser *store.User) (interface{}, error) {
 
-		isLiked, _ := s.GetIsUserLikedStatus(authUser.ID, status.ID)
+	apiStatuses, err := buildStatusResponses(s, []store.Status{status}, authUser)
+	if err != nil {
+		return nil, err
+	}
+
+	return apiStatuses[0], nil
+}
+
+func buildStatusResponses(s store.Repository, statuses []store.Status, authUser *store.User) ([]interface{}, error) {
+
+	lookups, err := loadStatusLookups(s, statuses, authUser)
+	if err != nil {
+		return nil, err
+	}
 
+	apiStatuses := make([]interface{}, len(statuses))
+	for i, status := range statuses {
+		apiStatuses[i] = buildStatusResponseFromLookups(lookups, status, authUser)
+	}
+
+	return apiStatuses, nil
+}
+
+func buildStatusResponseFromLookups(lookups statusLookups, status store.Status, authUser *store.User) interface{} {
+
+	poster := lookups.posters[status.UserID]
+	resharedStatus := buildResharedStatusResponse(lookups, status, authUser)
+
+	// Return authenticated response
+	if authUser != nil {
 		return apiStatusAuth{
-			ID: status.ID,
-			Poster: apiUser{
-				ID:            poster.ID,
-				Username:      poster.Username,
-				Description:   poster.Description,
-				ProfileImgURL: poster.ProfileImgURL,
-			},
+			ID:              status.ID,
+			Poster:          buildUserResponse(poster),
 			Content:         status.Content,
-			Likes:           statusLikes,
-			IsLiked:         isLiked,
-			Reshares:        -2, // filler value for now
+			Likes:           lookups.likes[status.ID],
+			IsLiked:         lookups.liked[status.ID],
+			Reshares:        lookups.reshares[status.ID],
 			PostedTimestamp: status.PostedTimestamp,
 			IsEdited:        status.IsEdited,
+			Visibility:      status.Visibility,
+			ResharedStatus:  resharedStatus,
 		}
 	}
 
 	return apiStatusNonAuth{
-		ID: status.ID,
-		Poster: apiUser{
-			ID:            poster.ID,
-			Username:      poster.Username,
-			Description:   poster.Description,
-			ProfileImgURL: poster.ProfileImgURL,
-		},
+		ID:              status.ID,
+		Poster:          buildUserResponse(poster),
 		Content:         status.Content,
-		Likes:           statusLikes,
-		Reshares:        -1, // filler value for now
+		Likes:           lookups.likes[status.ID],
+		Reshares:        lookups.reshares[status.ID],
 		PostedTimestamp: status.PostedTimestamp,
 		IsEdited:        status.IsEdited,
+		Visibility:      status.Visibility,
+		ResharedStatus:  resharedStatus,
 	}
 }
 
+// buildResharedStatusResponse builds response for the original of a reshare
+//
+// Returns nil if status is not a reshare or original is hidden from the viewer.
+func buildResharedStatusResponse(lookups statusLookups, status store.Status, authUser *store.User) interface{} {
+
+	if !status.ResharedStatusID.Valid {
+		return nil
+	}
+
+	original, ok := lookups.originals[status.ResharedStatusID.String]
+	if !ok {
+		return nil
+	}
+
+	// Reshares always point to an original post so this does not recurse further
+	return buildStatusResponseFromLookups(lookups, original, authUser)
+}
+
 type apiCommentNonAuth struct {
 	ID              string    `form:"id" json:"id" binding:"required"`
 	Poster          apiUser   `form:"poster" json:"poster" binding:"required"`
@@ -92,6 +226,7 @@ type apiCommentNonAuth struct {
 	Likes           int       `form:"likes" json:"likes" binding:"required"`
 	PostedTimestamp time.Time `form:"postedTimestamp" json:"postedTimestamp" binding:"required"`
 	IsEdited        bool      `form:"isEdited" json:"isEdited" binding:"required"`
+	IsDeleted       bool      `form:"isDeleted" json:"isDeleted" binding:"required"`
 }
 
 type apiCommentAuth struct {
@@ -102,74 +237,162 @@ type apiCommentAuth struct {
 	IsLiked         bool      `form:"isLiked" json:"isLiked" binding:"required"`
 	PostedTimestamp time.Time `form:"postedTimestamp" json:"postedTimestamp" binding:"required"`
 	IsEdited        bool      `form:"isEdited" json:"isEdited" binding:"required"`
+	IsDeleted       bool      `form:"isDeleted" json:"isDeleted" binding:"required"`
+}
+
+// commentLookups holds data for rendering comments that was looked up in batch
+type commentLookups struct {
+	posters map[string]store.User
+	likes   map[string]int
+	liked   map[string]bool
+}
+
+// loadCommentLookups looks up posters and likes for comments
+//
+// Lookups are batched so the number of queries does not grow with the number of comments.
+func loadCommentLookups(s store.Repository, comments []store.Comment, authUser *store.User) (commentLookups, error) {
+
+	commentIDs := make([]string, len(comments))
+	userIDs := make([]string, len(comments))
+	for i, comment := range comments {
+		commentIDs[i] = comment.ID
+		userIDs[i] = comment.UserID
+	}
+
+	posters, err := s.GetUsersByIDs(userIDs)
+	if err != nil {
+		return commentLookups{}, err
+	}
+	likes, err := s.GetCommentLikeCounts(commentIDs)
+	if err != nil {
+		return commentLookups{}, err
+	}
+
+	var liked map[string]bool
+	if authUser != nil {
+		liked, err = s.GetUserLikedComments(authUser.ID, commentIDs)
+		if err != nil {
+			return commentLookups{}, err
+		}
+	}
+
+	return commentLookups{
+		posters: posters,
+		likes:   likes,
+		liked:   liked,
+	}, nil
+}
+
+func buildCommentResponse(s store.Repository, comment store.Comment, authUser *store.User) (interface{}, error) {
+
+	apiComments, err := buildCommentResponses(s, []store.Comment{comment}, authUser)
+	if err != nil {
+		return nil, err
+	}
+
+	return apiComments[0], nil
 }
 
-func buildCommentResponse(s store.Store, poster store.User, comment store.Comment, authUser *store.User) interface{} {
+func buildCommentResponses(s store.Repository, comments []store.Comment, authUser *store.User) ([]interface{}, error) {
+
+	lookups, err := loadCommentLookups(s, comments, authUser)
+	if err != nil {
+		return nil, err
+	}
 
-	commentLikes, _ := s.GetCommentLikes(comment.ID)
+	apiComments := make([]interface{}, len(comments))
+	for i, comment := range comments {
+		apiComments[i] = buildCommentResponseFromLookups(lookups, comment, authUser)
+	}
+
+	return apiComments, nil
+}
+
+func buildCommentResponseFromLookups(lookups commentLookups, comment store.Comment, authUser *store.User) interface{} {
+
+	poster := lookups.posters[comment.UserID]
+
+	// Hide poster of deleted comments
+	if comment.IsDeleted {
+		poster = store.User{}
+	}
 
 	if authUser != nil {
 		return apiCommentAuth{
-			ID: comment.ID,
-			Poster: apiUser{
-				ID:            poster.ID,
-				Username:      poster.Username,
-				Description:   poster.Description,
-				ProfileImgURL: poster.ProfileImgURL,
-			},
+			ID:              comment.ID,
+			Poster:          buildUserResponse(poster),
 			Content:         comment.Content,
-			Likes:           commentLikes,
-			IsLiked:         false, // filler value
+			Likes:           lookups.likes[comment.ID],
+			IsLiked:         lookups.liked[comment.ID],
 			PostedTimestamp: comment.PostedTimestamp,
 			IsEdited:        comment.IsEdited,
+			IsDeleted:       comment.IsDeleted,
 		}
 	}
 
 	return apiCommentNonAuth{
-		ID: comment.ID,
-		Poster: apiUser{
-			ID:            poster.ID,
-			Username:      poster.Username,
-			Description:   poster.Description,
-			ProfileImgURL: poster.ProfileImgURL,
-		},
+		ID:              comment.ID,
+		Poster:          buildUserResponse(poster),
 		Content:         comment.Content,
-		Likes:           commentLikes,
+		Likes:           lookups.likes[comment.ID],
 		PostedTimestamp: comment.PostedTimestamp,
 		IsEdited:        comment.IsEdited,
+		IsDeleted:       comment.IsDeleted,
 	}
 }
 
 type apiCommentChain struct {
-	Comment interface{}       `form:"comment" json:"comment" binding:"required"`
-	Replies []apiCommentChain `form:"replies" json:"replies" binding:"required"`
+	Comment     interface{}       `form:"comment" json:"comment" binding:"required"`
+	Replies     []apiCommentChain `form:"replies" json:"replies" binding:"required"`
+	MoreReplies string            `form:"moreReplies" json:"moreReplies" binding:"required"`
+	HasReplies  bool              `form:"hasReplies" json:"hasReplies" binding:"required"`
 }
 
-// TODO: add limit and offset for given levels
-func buildCommentChainResponse(s store.Store, commentID string, authUser *store.User, level int) apiCommentChain {
+// buildCommentChainResponse builds comment chain from a subtree fetched one level past depth with one
+// extra reply per comment
+//
+// Replies past limit are dropped and marked with a moreReplies cursor. Comments at depth have
+// no replies loaded but are marked with hasReplies if they have any.
+func buildCommentChainResponse(s store.Repository, subtree []store.Comment, depth int, limit int, authUser *store.User) (apiCommentChain, error) {
 
-	comment, _ := s.GetCommentByID(commentID)
-	poster, _ := s.GetUserByID(comment.UserID)
+	replies := make(map[string][]store.Comment)
+	for _, comment := range subtree[1:] {
+		parentID := comment.ParentCommentID.String
+		replies[parentID] = append(replies[parentID], comment)
+	}
 
-	commentResponse := buildCommentResponse(s, *poster, *comment, authUser)
+	lookups, err := loadCommentLookups(s, subtree, authUser)
+	if err != nil {
+		return apiCommentChain{}, err
+	}
 
-	if level <= 0 {
-		return apiCommentChain{
-			Comment: commentResponse,
-			Replies: nil,
-		}
+	return buildCommentChainNode(lookups, replies, subtree[0], depth, limit, authUser), nil
+}
+
+// buildCommentChainNode builds response for comment and its replies
+func buildCommentChainNode(lookups commentLookups, replies map[string][]store.Comment, comment store.Comment, depth int, limit int, authUser *store.User) apiCommentChain {
+
+	chain := apiCommentChain{
+		Comment:    buildCommentResponseFromLookups(lookups, comment, authUser),
+		HasReplies: len(replies[comment.ID]) > 0,
+	}
+	if depth <= 0 {
+		return chain
 	}
 
-	comments, _ := s.GetCommentReplies(commentID)
-	commentChains := make([]apiCommentChain, len(comments))
-	for i, comment := range comments {
-		commentChains[i] = buildCommentChainResponse(s, comment.ID, authUser, level-1)
+	children := replies[comment.ID]
+	if len(children) > limit {
+		children = children[:limit]
+		last := children[limit-1]
+		chain.MoreReplies = store.Cursor{PostedTimestamp: last.PostedTimestamp, ID: last.ID}.Encode()
 	}
 
-	return apiCommentChain{
-		Comment: commentResponse,
-		Replies: commentChains,
+	chain.Replies = make([]apiCommentChain, len(children))
+	for i, child := range children {
+		chain.Replies[i] = buildCommentChainNode(lookups, replies, child, depth-1, limit, authUser)
 	}
+
+	return chain
 }
 
 type apiCircle struct {
@@ -179,7 +402,7 @@ type apiCircle struct {
 	UserCount   int    `form:"userCount" json:"userCount" binding:"required"`
 }
 
-func buildCircleResponse(s store.Store, circle store.Circle) apiCircle {
+func buildCircleResponse(s store.Repository, circle store.Circle) apiCircle {
 
 	userCount, _ := s.GetCircleUserCount(circle.ID)
 
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+type apiSession struct {
+	ID                string    `form:"id" json:"id" binding:"required"`
+	UserAgent         string    `form:"userAgent" json:"userAgent" binding:"required"`
+	IPAddress         string    `form:"ipAddress" json:"ipAddress" binding:"required"`
+	CreatedTimestamp  time.Time `form:"createdTimestamp" json:"createdTimestamp" binding:"required"`
+	LastSeenTimestamp time.Time `form:"lastSeenTimestamp" json:"lastSeenTimestamp" binding:"required"`
+	IsCurrent         bool      `form:"isCurrent" json:"isCurrent" binding:"required"`
+}
+
+// truncate shortens string to at most n bytes
+func truncate(str string, n int) string {
+	if len(str) > n {
+		return str[:n]
+	}
+	return str
+}
+
+// endSession deletes session and revokes its refresh tokens
+func endSession(c *gin.Context, s store.Repository, sessionID string) bool {
+
+	err := s.RevokeRefreshTokenFamily(sessionID)
+	if err != nil {
+		respondStoreError(c, err)
+		return false
+	}
+
+	err = s.DeleteSessionByID(sessionID)
+	if err != nil {
+		respondStoreError(c, err)
+		return false
+	}
+
+	return true
+}
+
+// endOtherSessions ends every session of user except the current one
+func endOtherSessions(c *gin.Context, s store.Repository, userID string, currentSessionID string) bool {
+
+	sessions, err := s.GetUserSessions(userID)
+	if err != nil {
+		respondStoreError(c, err)
+		return false
+	}
+
+	for _, session := range sessions {
+		if session.ID == currentSessionID {
+			continue
+		}
+		if !endSession(c, s, session.ID) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetSessions gets sessions of user
+func GetSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		sessions, err := s.GetUserSessions(authUser.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		currentSessionID := c.GetString("authSessionID")
+		apiSessions := make([]apiSession, len(sessions))
+		for i, session := range sessions {
+			apiSessions[i] = apiSession{
+				ID:                session.ID,
+				UserAgent:         session.UserAgent,
+				IPAddress:         session.IPAddress,
+				CreatedTimestamp:  session.CreatedTimestamp,
+				LastSeenTimestamp: session.LastSeenTimestamp,
+				IsCurrent:         session.ID == currentSessionID,
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"sessions": apiSessions,
+		})
+	}
+}
+
+// DeleteSession ends a session of user
+func DeleteSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		s := c.MustGet("store").(store.Repository)
+		sessionID := c.Param("sessionID")
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		session, err := s.GetSessionByID(sessionID)
+		if err != nil || session.UserID != authUser.ID {
+			respondError(c, http.StatusNotFound, "No session found")
+			return
+		}
+
+		if !endSession(c, s, session.ID) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
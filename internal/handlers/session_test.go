@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+func TestGetSessionsSuccess(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	tokens := loginTestUser(t, r)
+
+	// Get sessions
+	req, err := http.NewRequest("GET", "/api/v1/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["token"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	sessions := decodeBody(t, rr)["sessions"].([]interface{})
+	if assert.Len(t, sessions, 2) {
+		current := sessions[0].(map[string]interface{})
+		assert.Equal(t, true, current["isCurrent"])
+		assert.Equal(t, false, sessions[1].(map[string]interface{})["isCurrent"])
+	}
+}
+
+func TestDeleteSessionLocksOutToken(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	tokens := loginTestUser(t, r)
+
+	// End test session from new login
+	req, err := http.NewRequest("DELETE", "/api/v1/sessions/session12345", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["token"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Token of ended session is rejected
+	req, _ = http.NewRequest("GET", "/api/v1/user", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestDeleteSessionFailOtherUser(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	s.InsertSession(store.Session{
+		ID:                "session67890",
+		UserID:            "67890",
+		CreatedTimestamp:  time.Now(),
+		LastSeenTimestamp: time.Now(),
+	})
+
+	// End other user's session
+	req, err := http.NewRequest("DELETE", "/api/v1/sessions/session67890", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	_, err = s.GetSessionByID("session67890")
+	assert.NoError(t, err)
+}
+
+func TestExpiredSessionLocksOutToken(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	if err := s.TouchSession("session12345", "", time.Now().Add(-store.SessionIdleTimeout)); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/user", nil)
+	req.Header.Set("Authorization", testAuthHeader)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
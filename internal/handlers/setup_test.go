@@ -1,33 +1,90 @@
 package handlers_test
 
 import (
-	"database/sql/driver"
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
 	"time"
 
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/jasmaa/galt/internal/handlers"
+	"github.com/jasmaa/galt/internal/keys"
+	"github.com/jasmaa/galt/internal/mailer"
 	"github.com/jasmaa/galt/internal/middleware"
+	"github.com/jasmaa/galt/internal/passhash"
 	"github.com/jasmaa/galt/internal/store"
 )
 
-type AnyTime struct{}
+// testKeySet signs and verifies tokens in tests
+var testKeySet *keys.KeySet
 
-// Match satisfies sqlmock.Argument interface
-func (a AnyTime) Match(v driver.Value) bool {
-	_, ok := v.(time.Time)
-	return ok
+// testAuthHeader authorizes requests as user 12345 in session session12345
+var testAuthHeader string
+
+// testMailer writes mail sent in tests to a temp dir
+var testMailer *mailer.FileMailer
+
+// TestMain sets up signing keys for tests
+func TestMain(m *testing.M) {
+
+	dir, err := os.MkdirTemp("", "galt-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	testMailer = &mailer.FileMailer{Dir: filepath.Join(dir, "mail"), From: "galt@example.com"}
+
+	testKeySet, err = keys.NewKeySet(filepath.Join(dir, "keys"), keys.AlgEdDSA, handlers.AccessTokenTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	token, err := testKeySet.Sign(jwt.MapClaims{
+		"userID": "12345",
+		"jti":    "session12345",
+		"iat":    1516239022,
+		"exp":    9999999999,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	testAuthHeader = "Bearer " + token
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
 }
 
+// testPasswordHash is the hash of "testpassword"
+const testPasswordHash = "$2b$10$KpZAZIPai8SyT7k8zT582ec5Va9.KrnoMc9D5UnGkDRdVvTp263/q"
+
+// testBcryptCost keeps hashing new passwords fast in tests
+const testBcryptCost = bcrypt.MinCost
+
+// testHasher hashes passwords in tests
+var testHasher = passhash.NewHasher(passhash.Bcrypt{Cost: testBcryptCost})
+
+// testGracePeriod is how long deleted accounts can be restored in tests
+const testGracePeriod = 24 * time.Hour
+
 // setupRouter sets up router for test
-func setupRouter(s store.Store) *gin.Engine {
+func setupRouter(s store.Repository) *gin.Engine {
 
 	gin.SetMode(gin.ReleaseMode)
 
-	hmacSecret := "secret_key"
-
 	// Router
 	r := gin.New()
+	r.ForwardedByClientIP = false
+
+	r.GET("/.well-known/jwks.json", handlers.GetJWKS(testKeySet))
 
 	// Handlers
 	v1 := r.Group("/api/v1")
@@ -37,16 +94,36 @@ func setupRouter(s store.Store) *gin.Engine {
 		c.Next()
 	})
 
-	v1.Use(middleware.AuthUser(hmacSecret))
+	v1.Use(middleware.AuthUser(testKeySet))
 
-	v1.POST("/createAccount", handlers.CreateAccount())
-	v1.POST("/login", handlers.Login(hmacSecret))
+	v1.POST("/createAccount", handlers.CreateAccount(testMailer, testHasher))
+	v1.POST("/login", handlers.Login(testKeySet, testHasher))
+	v1.POST("/login/mfa", handlers.LoginMFA(testKeySet))
+	v1.POST("/token/refresh", handlers.RefreshToken(testKeySet))
+	v1.POST("/logout", handlers.Logout())
+	v1.POST("/logout/all", handlers.LogoutAll())
+	v1.POST("/password/forgot", handlers.ForgotPassword(testMailer))
+	v1.POST("/password/reset", handlers.ResetPassword(testHasher))
 
 	v1.GET("/user/:userID", handlers.GetUser())
 	v1.GET("/user", handlers.GetProfile())
-	v1.PUT("/user", handlers.UpdateProfile())
-	v1.DELETE("/user", handlers.DeleteProfile())
+	v1.PUT("/user", handlers.UpdateProfile(testMailer))
+	v1.DELETE("/user", handlers.DeleteProfile(testGracePeriod))
+	v1.PUT("/user/password", handlers.ChangePassword(testHasher))
+	v1.POST("/user/email/verify", handlers.VerifyEmail())
+	v1.POST("/user/email/resend", handlers.ResendVerificationEmail(testMailer))
+	v1.POST("/user/2fa/enroll", handlers.EnrollTOTP())
+	v1.POST("/user/2fa/confirm", handlers.ConfirmTOTP())
+	v1.POST("/user/2fa/disable", handlers.DisableTOTP(testHasher))
+	v1.POST("/user/import", handlers.ImportArchive())
+
+	v1.POST("/export", handlers.RequestExport())
+	v1.GET("/export/:exportID", handlers.GetExport())
 
+	v1.GET("/sessions", handlers.GetSessions())
+	v1.DELETE("/sessions/:sessionID", handlers.DeleteSession())
+
+	v1.GET("/status", handlers.GetStatusFeed())
 	v1.GET("/status/:statusID", handlers.GetStatus())
 	v1.POST("/status", handlers.PostStatus())
 	v1.PUT("/status/:statusID", handlers.UpdateStatus())
@@ -55,6 +132,131 @@ func setupRouter(s store.Store) *gin.Engine {
 	v1.POST("/status/:statusID/unlike", handlers.UnikeStatus())
 	v1.GET("/status/:statusID/comments", handlers.GetComments())
 	v1.POST("/status/:statusID/comment", handlers.PostComment())
+	v1.POST("/status/:statusID/reshare", handlers.ReshareStatus())
+	v1.GET("/status/:statusID/reshares", handlers.GetReshares())
+
+	v1.GET("/comment/:commentID", handlers.GetCommentChain())
+	v1.POST("/comment/:commentID", handlers.PostReply())
+	v1.PUT("/comment/:commentID", handlers.UpdateComment())
+	v1.DELETE("/comment/:commentID", handlers.DeleteComment())
+	v1.POST("/comment/:commentID/like", handlers.LikeComment())
+	v1.POST("/comment/:commentID/unlike", handlers.UnlikeComment())
+
+	v1.GET("/circle/:circleID", handlers.GetCircle())
+	v1.POST("/circle", handlers.CreateCircle())
+	v1.PUT("/circle/:circleID", handlers.UpdateCircle())
+	v1.DELETE("/circle/:circleID", handlers.DeleteCircle())
+	v1.POST("/circle/:circleID/addUser", handlers.AddUserToCircle())
+	v1.POST("/circle/:circleID/removeUser", handlers.RemoveUserFromCircle())
 
 	return r
 }
+
+// setupStore sets up in-memory store with test users 12345 and 67890 and a session for 12345
+func setupStore(t *testing.T) *store.MemoryStore {
+
+	s := store.NewMemoryStore()
+
+	for _, user := range []store.User{
+		{ID: "12345", Username: "testuser", PasswordHash: testPasswordHash},
+		{ID: "67890", Username: "otheruser", PasswordHash: testPasswordHash},
+	} {
+		if err := s.InsertUser(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := s.InsertSession(store.Session{
+		ID:                "session12345",
+		UserID:            "12345",
+		CreatedTimestamp:  time.Now(),
+		LastSeenTimestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// insertTestStatus inserts status for test
+func insertTestStatus(t *testing.T, s store.Repository, statusID string, userID string, visibility string) {
+
+	err := s.InsertStatus(store.Status{
+		ID:              statusID,
+		UserID:          userID,
+		Content:         "I posted this status",
+		PostedTimestamp: time.Now(),
+		Visibility:      visibility,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestMail reads body of the last mail sent to address
+//
+// Waits a little for mail sent in the background.
+func readTestMail(t *testing.T, to string) string {
+
+	for attempt := 0; attempt < 100; attempt++ {
+		files, err := filepath.Glob(filepath.Join(testMailer.Dir, "*.eml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Names sort in the order sent
+		for i := len(files) - 1; i >= 0; i-- {
+			data, err := os.ReadFile(files[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := string(data)
+			if strings.Contains(msg, "To: "+to+"\r\n") {
+				return msg[strings.Index(msg, "\r\n\r\n")+4:]
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("no mail sent to %s", to)
+	return ""
+}
+
+// mailTokenPattern matches token on its own line in mail body
+var mailTokenPattern = regexp.MustCompile(`\n([\w-]{43})\r?\n`)
+
+// readTestMailToken reads token from the last mail sent to address
+func readTestMailToken(t *testing.T, to string) string {
+
+	res := mailTokenPattern.FindStringSubmatch(readTestMail(t, to))
+	if len(res) != 2 {
+		t.Fatalf("no token in mail sent to %s", to)
+	}
+
+	return res[1]
+}
+
+// decodeBody decodes JSON response body
+func decodeBody(t *testing.T, rr *httptest.ResponseRecorder) map[string]interface{} {
+
+	body := make(map[string]interface{})
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	return body
+}
+
+// decodeError decodes error envelope of response
+func decodeError(t *testing.T, rr *httptest.ResponseRecorder) map[string]interface{} {
+
+	body := decodeBody(t, rr)
+	apiErr, ok := body["error"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("no error in response: %s", rr.Body.String())
+	}
+
+	return apiErr
+}
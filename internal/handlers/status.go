@@ -3,41 +3,122 @@ package handlers
 import (
 	"database/sql"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
 	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/validate"
 )
 
+// authUserID gets id of authenticated user or empty string if anonymous
+func authUserID(authUser *store.User) string {
+	if authUser == nil {
+		return ""
+	}
+	return authUser.ID
+}
+
+// parseAudience validates the audience of a new status, defaulting to public
+func parseAudience(c *gin.Context, s store.Repository, authUser *store.User, visibility string, circleIDs []string) (string, []string, bool) {
+
+	if len(visibility) == 0 {
+		visibility = store.VisibilityPublic
+	}
+
+	if !store.IsValidVisibility(visibility) {
+		respondError(c, http.StatusBadRequest, "Invalid visibility")
+		return "", nil, false
+	}
+	if visibility != store.VisibilityCircles {
+		return visibility, nil, true
+	}
+	if len(circleIDs) <= 0 {
+		respondError(c, http.StatusBadRequest, "No circles selected")
+		return "", nil, false
+	}
+
+	// Check if user owns circles, dropping repeats so each is only shared with once
+	seen := make(map[string]bool)
+	uniqueIDs := make([]string, 0, len(circleIDs))
+	for _, circleID := range circleIDs {
+		if seen[circleID] {
+			continue
+		}
+		seen[circleID] = true
+
+		circle, err := s.GetCircleByID(circleID)
+		if err != nil || circle.UserID != authUser.ID {
+			respondError(c, http.StatusBadRequest, "Invalid circle")
+			return "", nil, false
+		}
+		uniqueIDs = append(uniqueIDs, circleID)
+	}
+
+	return visibility, uniqueIDs, true
+}
+
+// insertStatus inserts status and shares it with circles in one transaction
+func insertStatus(s store.Repository, status store.Status, circleIDs []string) error {
+	return s.WithTx(func(tx store.Repository) error {
+
+		err := tx.InsertStatus(status)
+		if err != nil {
+			return err
+		}
+
+		for _, circleID := range circleIDs {
+			err := tx.InsertStatusCirclePair(status.ID, circleID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// statusRequest is the form to post or edit a status
+//
+// Audience can only be set when posting.
+type statusRequest struct {
+	Content    string   `form:"content" json:"content"`
+	Visibility string   `form:"visibility" json:"visibility"`
+	CircleIDs  []string `form:"circleIDs" json:"circleIDs"`
+}
+
+// validate checks status content
+func (req statusRequest) validate() validate.Errors {
+
+	errs := validate.Errors{}
+	validate.Text(errs, "content", req.Content, true)
+
+	return errs
+}
+
 // GetStatus gets status by id
 func GetStatus() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		statusID := c.Param("statusID")
 
 		authUser, _ := c.MustGet("authUser").(*store.User)
 
-		status, err := s.GetStatusByID(statusID)
+		status, err := s.GetVisibleStatusByID(statusID, authUserID(authUser))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		poster, err := s.GetUserByID(status.UserID)
+		response, err := buildStatusResponse(s, *status, authUser)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, buildStatusResponse(s, *poster, *status, authUser))
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -45,47 +126,43 @@ func GetStatus() gin.HandlerFunc {
 func GetStatusFeed() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
-		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
-		if err != nil {
-			offset = 0
-		} else if offset < 0 {
-			offset = 0
+		limit, cursor, ok := parsePage(c, defaultPageSize)
+		if !ok {
+			return
 		}
 
-		statuses, err := s.GetStatusFeed(authUser.ID, 30, offset)
+		// Get one extra status to check for another page
+		statuses, err := s.GetStatusFeed(authUser.ID, limit+1, cursor)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		apiStatuses := make([]interface{}, len(statuses))
-		for i, status := range statuses {
-
-			poster, err := s.GetUserByID(status.UserID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": err.Error(),
-				})
-				return
-			}
+		hasMore := len(statuses) > limit
+		nextCursor := ""
+		if hasMore {
+			statuses = statuses[:limit]
+			last := statuses[limit-1]
+			nextCursor = store.Cursor{PostedTimestamp: last.PostedTimestamp, ID: last.ID}.Encode()
+		}
 
-			apiStatuses[i] = buildStatusResponse(s, *poster, status, authUser)
+		apiStatuses, err := buildStatusResponses(s, statuses, authUser)
+		if err != nil {
+			respondStoreError(c, err)
+			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"statuses": apiStatuses,
-			"offset":   offset + 30,
+			"statuses":   apiStatuses,
+			"nextCursor": nextCursor,
+			"hasMore":    hasMore,
 		})
 	}
 }
@@ -94,37 +171,48 @@ func GetStatusFeed() gin.HandlerFunc {
 func PostStatus() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		statusID := uuid.New().String()
-		content := c.PostForm("content")
+		var req statusRequest
+		if !bindRequest(c, &req) || respondInvalid(c, req.validate()) {
+			return
+		}
 
 		// TODO: Add content filtering here??
 
-		// Insert status
+		visibility, circleIDs, ok := parseAudience(c, s, authUser, req.Visibility, req.CircleIDs)
+		if !ok {
+			return
+		}
+
+		// Insert status and share with circles
 		status := store.Status{
 			ID:              statusID,
 			UserID:          authUser.ID,
-			Content:         content,
+			Content:         req.Content,
 			PostedTimestamp: time.Now(),
 			IsEdited:        false,
+			Visibility:      visibility,
+		}
+		err := insertStatus(s, status, circleIDs)
+		if err != nil {
+			respondStoreError(c, err)
+			return
 		}
-		err := s.InsertStatus(status)
+
+		response, err := buildStatusResponse(s, status, authUser)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, buildStatusResponse(s, *authUser, status, authUser))
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -132,50 +220,53 @@ func PostStatus() gin.HandlerFunc {
 func UpdateStatus() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		statusID := c.Param("statusID")
-		content := c.PostForm("content")
+		var req statusRequest
+		if !bindRequest(c, &req) {
+			return
+		}
 
-		status, err := s.GetStatusByID(statusID)
+		status, err := s.GetVisibleStatusByID(statusID, authUser.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
 		// Check if user is poster
 		if status.UserID != authUser.ID {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "You do not have permission to edit this status",
-			})
+			respondError(c, http.StatusForbidden, "You do not have permission to edit this status")
 			return
 		}
 
-		// TODO: validate content
+		if respondInvalid(c, req.validate()) {
+			return
+		}
 
 		// Update status
-		status.Content = content
+		status.Content = req.Content
 		status.PostedTimestamp = time.Now()
 		status.IsEdited = true
 
 		err = s.UpdateStatus(*status)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, buildStatusResponse(s, *authUser, *status, authUser))
+		response, err := buildStatusResponse(s, *status, authUser)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -183,42 +274,34 @@ func UpdateStatus() gin.HandlerFunc {
 func LikeStatus() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		statusID := c.Param("statusID")
-		status, err := s.GetStatusByID(statusID)
+		status, err := s.GetVisibleStatusByID(statusID, authUser.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		poster, err := s.GetUserByID(status.UserID)
+		// Update status likes
+		err = s.InsertStatusLikePair(authUser.ID, statusID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		// Update status likes
-		err = s.InsertStatusLikePair(authUser.ID, statusID)
+		response, err := buildStatusResponse(s, *status, authUser)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, buildStatusResponse(s, *poster, *status, authUser))
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -226,42 +309,34 @@ func LikeStatus() gin.HandlerFunc {
 func UnikeStatus() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		statusID := c.Param("statusID")
-		status, err := s.GetStatusByID(statusID)
+		status, err := s.GetVisibleStatusByID(statusID, authUser.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		poster, err := s.GetUserByID(status.UserID)
+		// Update status likes
+		err = s.DeleteStatusLikePair(authUser.ID, statusID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		// Update status likes
-		err = s.DeleteStatusLikePair(authUser.ID, statusID)
+		response, err := buildStatusResponse(s, *status, authUser)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, buildStatusResponse(s, *poster, *status, authUser))
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -269,42 +344,40 @@ func UnikeStatus() gin.HandlerFunc {
 func DeleteStatus() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		statusID := c.Param("statusID")
-		status, err := s.GetStatusByID(statusID)
+		status, err := s.GetVisibleStatusByID(statusID, authUser.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
 		// Check if user is poster
 		if status.UserID != authUser.ID {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "You do not have permission to delete this status",
-			})
+			respondError(c, http.StatusForbidden, "You do not have permission to delete this status")
 			return
 		}
 
 		// Delete status
 		err = s.DeleteStatusByID(statusID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
+			return
+		}
+
+		response, err := buildStatusResponse(s, *status, authUser)
+		if err != nil {
+			respondStoreError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, buildStatusResponse(s, *authUser, *status, authUser))
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -312,44 +385,47 @@ func DeleteStatus() gin.HandlerFunc {
 func GetComments() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, _ := c.MustGet("authUser").(*store.User)
 
 		statusID := c.Param("statusID")
 
-		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		_, err := s.GetVisibleStatusByID(statusID, authUserID(authUser))
 		if err != nil {
-			offset = 0
-		} else if offset < 0 {
-			offset = 0
+			respondStoreError(c, err)
+			return
 		}
 
-		comments, err := s.GetCommentsFromStatus(statusID, 30, offset)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+		limit, cursor, ok := parsePage(c, defaultPageSize)
+		if !ok {
 			return
 		}
 
-		// TODO: do join instead??? or make client find user info instead??
-		apiComments := make([]interface{}, len(comments))
-		for i, comment := range comments {
+		// Get one extra comment to check for another page
+		comments, err := s.GetCommentsFromStatus(statusID, limit+1, cursor)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
 
-			poster, err := s.GetUserByID(comment.UserID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": err.Error(),
-				})
-				return
-			}
+		hasMore := len(comments) > limit
+		nextCursor := ""
+		if hasMore {
+			comments = comments[:limit]
+			last := comments[limit-1]
+			nextCursor = store.Cursor{PostedTimestamp: last.PostedTimestamp, ID: last.ID}.Encode()
+		}
 
-			apiComments[i] = buildCommentResponse(s, *poster, comment, authUser)
+		apiComments, err := buildCommentResponses(s, comments, authUser)
+		if err != nil {
+			respondStoreError(c, err)
+			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"comments": apiComments,
-			"offset":   offset + 30,
+			"comments":   apiComments,
+			"nextCursor": nextCursor,
+			"hasMore":    hasMore,
 		})
 	}
 }
@@ -358,36 +434,47 @@ func GetComments() gin.HandlerFunc {
 func PostComment() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
 		commentID := uuid.New().String()
-		content := c.PostForm("content")
 		statusID := c.Param("statusID")
+		var req commentRequest
+		if !bindRequest(c, &req) || respondInvalid(c, req.validate()) {
+			return
+		}
+
+		_, err := s.GetVisibleStatusByID(statusID, authUser.ID)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
 
 		comment := store.Comment{
 			ID:              commentID,
 			UserID:          authUser.ID,
 			StatusID:        statusID,
 			ParentCommentID: sql.NullString{},
-			Content:         content,
+			Content:         req.Content,
 			PostedTimestamp: time.Now(),
 			IsEdited:        false,
 		}
-		err := s.InsertComment(comment)
+		err = s.InsertComment(comment)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		response, err := buildCommentResponse(s, comment, authUser)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, buildCommentResponse(s, *authUser, comment, authUser))
+		c.JSON(http.StatusOK, response)
 	}
 }
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jasmaa/galt/internal/store"
+)
+
+const (
+	// loginFailureWindow is how long failed logins are remembered after the last one
+	loginFailureWindow = time.Hour
+
+	// loginBackoffBase is the wait once backoff starts, doubling after each further failure
+	loginBackoffBase = time.Second
+
+	// loginBackoffMax caps the wait between attempts
+	loginBackoffMax = time.Minute
+
+	// loginLockoutTTL is how long a key is locked out once it reaches its threshold
+	loginLockoutTTL = 15 * time.Minute
+
+	// userBackoffAfter and userLockoutThreshold are how many failures start backoff and lock out a username
+	userBackoffAfter     = 3
+	userLockoutThreshold = 10
+
+	// ipBackoffAfter and ipLockoutThreshold are how many failures start backoff and lock out an ip address
+	//
+	// Higher than for usernames since many users can share an address.
+	ipBackoffAfter     = 20
+	ipLockoutThreshold = 100
+)
+
+// loginThrottle is a key failed logins are counted against
+type loginThrottle struct {
+	key          string
+	backoffAfter int
+	threshold    int
+}
+
+// loginThrottles gets keys that failed logins for username from ip address are counted against
+//
+// Usernames are tracked whether or not the user exists so responses do not reveal which ones do.
+func loginThrottles(username string, ipAddress string) []loginThrottle {
+	return []loginThrottle{
+		{key: "user:" + username, backoffAfter: userBackoffAfter, threshold: userLockoutThreshold},
+		{key: "ip:" + ipAddress, backoffAfter: ipBackoffAfter, threshold: ipLockoutThreshold},
+	}
+}
+
+// backoff gets how long to wait before the next attempt after failures
+func (throttle loginThrottle) backoff(failures int) time.Duration {
+
+	if failures < throttle.backoffAfter {
+		return 0
+	}
+
+	backoff := loginBackoffBase
+	for i := throttle.backoffAfter; i < failures && backoff < loginBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > loginBackoffMax {
+		backoff = loginBackoffMax
+	}
+
+	return backoff
+}
+
+// loginRetryAfter gets how long until login may be attempted again, zero if it may be now
+func loginRetryAfter(s store.Repository, throttles []loginThrottle, now time.Time) time.Duration {
+
+	var wait time.Duration
+	for _, throttle := range throttles {
+		failure, err := s.GetLoginFailure(throttle.key)
+		if err != nil {
+			continue
+		}
+
+		until := failure.LastFailureTimestamp.Add(throttle.backoff(failure.FailureCount))
+		if failure.LockedUntilTimestamp.After(until) {
+			until = failure.LockedUntilTimestamp
+		}
+		if d := until.Sub(now); d > wait {
+			wait = d
+		}
+	}
+
+	return wait
+}
+
+// recordLoginFailure counts failed login against throttles, locking out any that reach their threshold
+func recordLoginFailure(c *gin.Context, s store.Repository, throttles []loginThrottle, username string, now time.Time) {
+
+	for _, throttle := range throttles {
+		count, err := s.RecordLoginFailure(throttle.key, now, now.Add(-loginFailureWindow))
+		if err != nil {
+			c.Error(err)
+			continue
+		}
+		if count < throttle.threshold {
+			continue
+		}
+
+		err = s.LockLogin(store.LoginLockout{
+			ID:               uuid.New().String(),
+			Key:              throttle.key,
+			Username:         username,
+			IPAddress:        c.ClientIP(),
+			FailureCount:     count,
+			CreatedTimestamp: now,
+			ExpiresTimestamp: now.Add(loginLockoutTTL),
+		})
+		if err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// setRetryAfter sets Retry-After header in whole seconds, rounding up
+func setRetryAfter(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,108 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failTestLogin attempts login with a wrong password
+func failTestLogin(t *testing.T, r http.Handler, username string) int {
+	rr := postTestForm(t, r, "/api/v1/login", url.Values{"username": {username}, "password": {"wrongpassword"}}, "")
+	return rr.Code
+}
+
+func TestLoginBackoff(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	for _, username := range []string{"testuser", "nosuchuser"} {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusUnauthorized, failTestLogin(t, r, username))
+		}
+
+		// Known and unknown usernames are throttled alike
+		rr := postTestForm(t, r, "/api/v1/login", url.Values{"username": {username}, "password": {"testpassword"}}, "")
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+		assert.Equal(t, map[string]interface{}{"code": "too_many_requests", "message": "Too many login attempts"}, decodeError(t, rr))
+	}
+
+	// Other usernames are not held back
+	assert.Contains(t, postTestForm(t, r, "/api/v1/login", url.Values{"username": {"otheruser"}, "password": {"testpassword"}}, "").Body.String(), "token")
+}
+
+func TestLoginLockout(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	// Earlier failures whose backoff has passed
+	past := time.Now().Add(-2 * time.Minute)
+	for i := 0; i < 9; i++ {
+		s.RecordLoginFailure("user:testuser", past, past.Add(-time.Hour))
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, failTestLogin(t, r, "testuser"))
+
+	rr := postTestForm(t, r, "/api/v1/login", url.Values{"username": {"testuser"}, "password": {"testpassword"}}, "")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Contains(t, []string{"899", "900"}, rr.Header().Get("Retry-After"))
+
+	lockouts, err := s.GetLoginLockouts(past)
+	assert.NoError(t, err)
+	if assert.Len(t, lockouts, 1) {
+		assert.Equal(t, "user:testuser", lockouts[0].Key)
+		assert.Equal(t, "testuser", lockouts[0].Username)
+		assert.Equal(t, 10, lockouts[0].FailureCount)
+	}
+}
+
+func TestLoginSuccessClearsFailures(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	failTestLogin(t, r, "testuser")
+	failTestLogin(t, r, "testuser")
+	loginTestUser(t, r)
+
+	_, err := s.GetLoginFailure("user:testuser")
+	assert.Error(t, err)
+
+	// Address is still counted, test requests have no remote address
+	failure, err := s.GetLoginFailure("ip:")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, failure.FailureCount)
+	}
+}
+
+func TestLoginMFAClearsFailures(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	_, recoveryCodes := enableTestTOTP(t, r)
+
+	failTestLogin(t, r, "testuser")
+	failTestLogin(t, r, "testuser")
+
+	// Password alone does not clear failures
+	mfaToken := loginTestUserMFAToken(t, r)
+	failure, err := s.GetLoginFailure("user:testuser")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, failure.FailureCount)
+	}
+
+	rr := postTestForm(t, r, "/api/v1/login/mfa", url.Values{"mfaToken": {mfaToken}, "code": {recoveryCodes[0].(string)}}, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	_, err = s.GetLoginFailure("user:testuser")
+	assert.Error(t, err)
+}
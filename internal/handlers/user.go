@@ -1,24 +1,30 @@
 package handlers
 
 import (
+	"database/sql"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jasmaa/galt/internal/mailer"
 	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/validate"
 )
 
 // GetUser gets user by id
 func GetUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		userID := c.Param("userID")
 
 		user, err := s.GetUserByID(userID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
+			return
+		}
+		if user.DeactivatedTimestamp.Valid {
+			respondError(c, http.StatusNotFound, "No user found")
 			return
 		}
 
@@ -32,77 +38,149 @@ func GetProfile() gin.HandlerFunc {
 
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
-		c.JSON(http.StatusOK, buildUserResponse(*authUser))
+		c.JSON(http.StatusOK, buildProfileResponse(*authUser))
+	}
+}
+
+// updateProfileRequest is the form to update a profile, leaving empty fields unchanged
+type updateProfileRequest struct {
+	Username      string `form:"username" json:"username"`
+	Description   string `form:"description" json:"description"`
+	ProfileImgURL string `form:"profileImgURL" json:"profileImgURL"`
+	Email         string `form:"email" json:"email"`
+}
+
+// validate checks fields being changed
+func (req updateProfileRequest) validate() validate.Errors {
+
+	errs := validate.Errors{}
+	if len(req.Username) > 0 {
+		validate.Username(errs, "username", req.Username)
 	}
+	validate.Text(errs, "description", req.Description, false)
+	if len(req.ProfileImgURL) > 0 {
+		validate.URL(errs, "profileImgURL", req.ProfileImgURL)
+	}
+	if len(req.Email) > 0 {
+		validate.Email(errs, "email", req.Email)
+	}
+
+	return errs
 }
 
 // UpdateProfile updates user profile
-func UpdateProfile() gin.HandlerFunc {
+//
+// Changing email unverifies it and mails a verification token to the new address.
+func UpdateProfile(m mailer.Mailer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
 			return
 		}
 
-		username := c.PostForm("username")
-		description := c.PostForm("description")
-		profileImgURL := c.PostForm("profileImgURL")
+		var req updateProfileRequest
+		if !bindRequest(c, &req) || respondInvalid(c, req.validate()) {
+			return
+		}
 
 		// Update user
-		if len(username) > 0 {
-			authUser.Username = username
+		if len(req.Username) > 0 {
+			authUser.Username = req.Username
+		}
+		if len(req.Description) > 0 {
+			authUser.Description = req.Description
 		}
-		if len(description) > 0 {
-			authUser.Description = description
+		if len(req.ProfileImgURL) > 0 {
+			authUser.ProfileImgURL = req.ProfileImgURL
 		}
-		if len(profileImgURL) > 0 {
-			authUser.ProfileImgURL = profileImgURL
+		emailChanged := false
+		if len(req.Email) > 0 {
+			normalized, _ := validate.NormalizeEmail(req.Email)
+
+			if normalized != authUser.Email {
+				if _, err := s.GetUserByEmail(normalized); err == nil {
+					respondError(c, http.StatusConflict, "Email already in use")
+					return
+				}
+
+				authUser.Email = normalized
+				authUser.IsEmailVerified = false
+				emailChanged = true
+			}
 		}
 
 		err := s.UpdateUser(*authUser)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, buildUserResponse(*authUser))
+		if emailChanged {
+			if err := sendVerificationEmail(s, m, *authUser); err != nil {
+				c.Error(err)
+			}
+		}
+
+		c.JSON(http.StatusOK, buildProfileResponse(*authUser))
 	}
 }
 
-// DeleteProfile deletes user account
-func DeleteProfile() gin.HandlerFunc {
+// restoreUser cancels deletion of a deactivated user that logged back in
+func restoreUser(s store.Repository, user *store.User) error {
+
+	if !user.DeactivatedTimestamp.Valid {
+		return nil
+	}
+
+	if err := s.RestoreUser(user.ID); err != nil {
+		return err
+	}
+	user.DeactivatedTimestamp = sql.NullTime{}
+
+	return nil
+}
+
+// DeleteProfile deactivates user account and logs out everywhere
+//
+// The account is purged once the grace period has passed unless the user logs in again first.
+func DeleteProfile(gracePeriod time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		s := c.MustGet("store").(store.Store)
+		s := c.MustGet("store").(store.Repository)
 		authUser, ok := c.MustGet("authUser").(*store.User)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Not authorized",
-			})
+			respondError(c, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		now := time.Now()
+		err := s.DeactivateUser(authUser.ID, now)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		err = s.RevokeUserRefreshTokens(authUser.ID)
+		if err != nil {
+			respondStoreError(c, err)
 			return
 		}
 
-		err := s.DeleteUserByID(authUser.ID)
+		err = s.DeleteUserSessions(authUser.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": err.Error(),
-			})
+			respondStoreError(c, err)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{})
+		c.JSON(http.StatusOK, gin.H{
+			"purgeTimestamp": now.Add(gracePeriod),
+		})
 	}
 }
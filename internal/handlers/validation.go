@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jasmaa/galt/internal/apierror"
+	"github.com/jasmaa/galt/internal/validate"
+)
+
+// respondInvalid responds with field errors, returning false if there are none
+func respondInvalid(c *gin.Context, errs validate.Errors) bool {
+
+	if len(errs) == 0 {
+		return false
+	}
+
+	c.JSON(http.StatusUnprocessableEntity, apierror.New(http.StatusUnprocessableEntity, "Invalid input", errs))
+
+	return true
+}
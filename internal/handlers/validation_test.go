@@ -0,0 +1,121 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// assertFieldErrors checks response is 422 with errors on exactly the given fields
+func assertFieldErrors(t *testing.T, rr *httptest.ResponseRecorder, fields ...string) {
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	apiErr := decodeError(t, rr)
+	assert.Equal(t, "invalid_input", apiErr["code"])
+	assert.Equal(t, "Invalid input", apiErr["message"])
+
+	got := []string{}
+	for field := range apiErr["details"].(map[string]interface{}) {
+		got = append(got, field)
+	}
+	assert.ElementsMatch(t, fields, got)
+}
+
+func TestCreateAccountFailInvalidFields(t *testing.T) {
+
+	// Setup
+	s := store.NewMemoryStore()
+	r := setupRouter(s)
+
+	rr := postTestForm(t, r, "/api/v1/createAccount", url.Values{
+		"username": {"no spaces"},
+		"password": {"short"},
+		"email":    {"not an email"},
+	}, "")
+	assertFieldErrors(t, rr, "username", "password", "email")
+
+	// Password cannot be the username
+	rr = postTestForm(t, r, "/api/v1/createAccount", url.Values{
+		"username": {"gooduser"},
+		"password": {"GoodUser"},
+	}, "")
+	assertFieldErrors(t, rr, "password")
+
+	_, err := s.GetUserByUsername("gooduser")
+	assert.Error(t, err)
+}
+
+func TestUpdateProfileFailInvalidURL(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	data := url.Values{
+		"profileImgURL": {"javascript:alert(1)"},
+		"description":   {strings.Repeat("a", 256)},
+	}
+	req, _ := http.NewRequest("PUT", "/api/v1/user", bytes.NewBufferString(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", testAuthHeader)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assertFieldErrors(t, rr, "profileImgURL", "description")
+
+	user, _ := s.GetUserByID("12345")
+	assert.Equal(t, "", user.ProfileImgURL)
+}
+
+func TestPostStatusFailInvalidContent(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	// Too long, counted in characters rather than bytes
+	rr := postTestForm(t, r, "/api/v1/status", url.Values{"content": {strings.Repeat("é", 256)}}, testAuthHeader)
+	assertFieldErrors(t, rr, "content")
+
+	rr = postTestForm(t, r, "/api/v1/status", url.Values{"content": {strings.Repeat("é", 255)}}, testAuthHeader)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Blank
+	rr = postTestForm(t, r, "/api/v1/status", url.Values{"content": {"   "}}, testAuthHeader)
+	assertFieldErrors(t, rr, "content")
+}
+
+func TestPostCommentFailEmpty(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+	insertTestStatus(t, s, "status12345", "12345", store.VisibilityPublic)
+
+	rr := postTestForm(t, r, "/api/v1/status/status12345/comment", url.Values{}, testAuthHeader)
+	assertFieldErrors(t, rr, "content")
+
+	comments, _ := s.GetCommentsFromStatus("status12345", 10, nil)
+	assert.Empty(t, comments)
+}
+
+func TestCreateCircleFailNoName(t *testing.T) {
+
+	// Setup
+	s := setupStore(t)
+	r := setupRouter(s)
+
+	rr := postTestForm(t, r, "/api/v1/circle", url.Values{"description": {"Friends"}}, testAuthHeader)
+	assertFieldErrors(t, rr, "name")
+
+	rr = postTestForm(t, r, "/api/v1/circle", url.Values{"name": {"Friends"}}, testAuthHeader)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,506 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+// Signing algorithms
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+const (
+	keyFileExt    = ".pem"
+	createdHeader = "Created"
+	rsaKeyBits    = 2048
+
+	// reloadOnMissInterval limits reloads caused by tokens with unknown key ids
+	reloadOnMissInterval = 10 * time.Second
+)
+
+// Key is a token signing key or a verification only key
+type Key struct {
+	ID               string
+	Method           jwt.SigningMethod
+	PrivateKey       crypto.Signer
+	PublicKey        crypto.PublicKey
+	CreatedTimestamp time.Time
+
+	path string
+}
+
+// KeySet holds keys from a key directory
+//
+// Each key is a PEM file named by its key id. The newest private key signs tokens.
+// Once a newer private key replaces it, a key keeps verifying for tokenTTL so tokens
+// it signed can expire on their own.
+type KeySet struct {
+	dir      string
+	alg      string
+	tokenTTL time.Duration
+
+	mu         sync.RWMutex
+	signing    *Key
+	keys       map[string]*Key
+	lastReload time.Time
+}
+
+// NewKeySet loads keys from dir and creates a signing key with alg if there is none
+func NewKeySet(dir string, alg string, tokenTTL time.Duration) (*KeySet, error) {
+
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		return nil, fmt.Errorf("Unsupported signing algorithm %q", alg)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{
+		dir:      dir,
+		alg:      alg,
+		tokenTTL: tokenTTL,
+	}
+
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+
+	if ks.SigningKey() == nil {
+		if _, err := ks.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ks, nil
+}
+
+// Reload reloads keys from key directory
+//
+// The current keys are kept if any key file cannot be read.
+func (ks *KeySet) Reload() error {
+
+	loaded, err := loadDir(ks.dir)
+	if err != nil {
+		return err
+	}
+
+	signing, active, _ := partitionKeys(loaded, ks.tokenTTL, time.Now())
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.signing = signing
+	ks.keys = active
+	ks.lastReload = time.Now()
+
+	return nil
+}
+
+// SigningKey gets key used to sign new tokens
+func (ks *KeySet) SigningKey() *Key {
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return ks.signing
+}
+
+// Keys gets keys that still verify, newest first
+func (ks *KeySet) Keys() []*Key {
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := make([]*Key, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	sortKeys(keys)
+
+	// Reverse to newest first
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+
+	return keys
+}
+
+// Sign signs claims with signing key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+
+	key := ks.SigningKey()
+	if key == nil {
+		return "", errors.New("No signing key")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.PrivateKey)
+}
+
+// Keyfunc finds verification key for token by its kid header
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+
+	kid, _ := token.Header["kid"].(string)
+
+	key := ks.lookup(kid)
+
+	// Key may have been created by another instance sharing the key directory
+	if key == nil && ks.claimReload() {
+		if err := ks.Reload(); err != nil {
+			log.Printf("Error reloading keys: %v", err)
+		}
+		key = ks.lookup(kid)
+	}
+
+	if key == nil {
+		return nil, errors.New("Unknown signing key")
+	}
+
+	// Validate alg
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("Unexpected signing method")
+	}
+
+	return key.PublicKey, nil
+}
+
+// Rotate creates a new signing key in key directory
+//
+// The previous signing key keeps verifying until tokens it signed have expired.
+func (ks *KeySet) Rotate() (*Key, error) {
+
+	key, err := generateKey(ks.alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeKeyFile(ks.dir, key); err != nil {
+		return nil, err
+	}
+
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Prune deletes key files of keys that no longer verify
+func (ks *KeySet) Prune() ([]string, error) {
+
+	loaded, err := loadDir(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, retired := partitionKeys(loaded, ks.tokenTTL, time.Now())
+
+	pruned := make([]string, 0, len(retired))
+	for _, key := range retired {
+		if err := os.Remove(key.path); err != nil && !os.IsNotExist(err) {
+			return pruned, err
+		}
+		pruned = append(pruned, key.ID)
+	}
+
+	return pruned, nil
+}
+
+// Run reloads keys and prunes retired ones every interval until stop is closed
+//
+// If rotateAfter is positive, the signing key is rotated once it is older than rotateAfter.
+// Only one instance sharing a key directory should rotate.
+func (ks *KeySet) Run(interval time.Duration, rotateAfter time.Duration, stop <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ks.maintain(rotateAfter)
+		}
+	}
+}
+
+// maintain runs one round of scheduled key maintenance
+func (ks *KeySet) maintain(rotateAfter time.Duration) {
+
+	if err := ks.Reload(); err != nil {
+		log.Printf("Error reloading keys: %v", err)
+		return
+	}
+
+	if key := ks.SigningKey(); rotateAfter > 0 && (key == nil || time.Since(key.CreatedTimestamp) > rotateAfter) {
+		if key, err := ks.Rotate(); err != nil {
+			log.Printf("Error rotating keys: %v", err)
+		} else {
+			log.Printf("Rotated signing key to %s", key.ID)
+		}
+	}
+
+	if pruned, err := ks.Prune(); err != nil {
+		log.Printf("Error pruning keys: %v", err)
+	} else if len(pruned) > 0 {
+		log.Printf("Pruned retired keys %s", strings.Join(pruned, ", "))
+	}
+}
+
+// lookup gets active key by id
+func (ks *KeySet) lookup(kid string) *Key {
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return ks.keys[kid]
+}
+
+// claimReload reports whether caller may reload now and records the reload
+func (ks *KeySet) claimReload() bool {
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if time.Since(ks.lastReload) < reloadOnMissInterval {
+		return false
+	}
+	ks.lastReload = time.Now()
+
+	return true
+}
+
+// partitionKeys splits keys into signing key, keys that still verify and retired keys
+//
+// A key retires tokenTTL after the next newer private key was created.
+func partitionKeys(keys []*Key, tokenTTL time.Duration, now time.Time) (*Key, map[string]*Key, []*Key) {
+
+	sortKeys(keys)
+
+	var signing *Key
+	active := make(map[string]*Key)
+	retired := []*Key{}
+
+	// Walk newest first tracking when each key was replaced
+	var replacedAt time.Time
+	for i := len(keys) - 1; i >= 0; i-- {
+		key := keys[i]
+
+		if !replacedAt.IsZero() && now.After(replacedAt.Add(tokenTTL)) {
+			retired = append(retired, key)
+		} else {
+			active[key.ID] = key
+		}
+
+		if key.PrivateKey != nil {
+			if signing == nil {
+				signing = key
+			}
+			replacedAt = key.CreatedTimestamp
+		}
+	}
+
+	return signing, active, retired
+}
+
+// sortKeys sorts keys oldest first
+func sortKeys(keys []*Key) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedTimestamp.Equal(keys[j].CreatedTimestamp) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].CreatedTimestamp.Before(keys[j].CreatedTimestamp)
+	})
+}
+
+// generateKey generates private key for alg
+func generateKey(alg string) (*Key, error) {
+
+	key := &Key{
+		ID:               uuid.New().String(),
+		CreatedTimestamp: time.Now().UTC(),
+	}
+
+	switch alg {
+	case AlgRS256:
+		privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		key.Method = jwt.SigningMethodRS256
+		key.PrivateKey = privateKey
+		key.PublicKey = &privateKey.PublicKey
+
+	case AlgEdDSA:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.Method = SigningMethodEdDSA
+		key.PrivateKey = privateKey
+		key.PublicKey = publicKey
+
+	default:
+		return nil, fmt.Errorf("Unsupported signing algorithm %q", alg)
+	}
+
+	return key, nil
+}
+
+// writeKeyFile writes private key to key directory
+func writeKeyFile(dir string, key *Key) error {
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	block := &pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{createdHeader: key.CreatedTimestamp.Format(time.RFC3339Nano)},
+		Bytes:   der,
+	}
+
+	// Write to temp file first so other instances never read a partial key
+	f, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := pem.Encode(f, block); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	key.path = filepath.Join(dir, key.ID+keyFileExt)
+
+	return os.Rename(f.Name(), key.path)
+}
+
+// loadDir reads all key files in dir
+func loadDir(dir string) ([]*Key, error) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []*Key{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != keyFileExt {
+			continue
+		}
+
+		key, err := readKeyFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// readKeyFile reads PEM encoded private or public key
+//
+// Creation time comes from the Created header or else the file modification time.
+func readKeyFile(path string) (*Key, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: No PEM block found", path)
+	}
+
+	key := &Key{
+		ID:   strings.TrimSuffix(filepath.Base(path), keyFileExt),
+		path: path,
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: Unsupported key type", path)
+		}
+		key.PrivateKey = signer
+		key.PublicKey = signer.Public()
+
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		key.PrivateKey = parsed
+		key.PublicKey = &parsed.PublicKey
+
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		key.PublicKey = parsed
+
+	default:
+		return nil, fmt.Errorf("%s: Unsupported PEM block %q", path, block.Type)
+	}
+
+	switch key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%s: Unsupported key type", path)
+	}
+
+	if created, ok := block.Headers[createdHeader]; ok {
+		key.CreatedTimestamp, err = time.Parse(time.RFC3339Nano, created)
+		if err != nil {
+			return nil, fmt.Errorf("%s: Invalid %s header", path, createdHeader)
+		}
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		key.CreatedTimestamp = info.ModTime()
+	}
+
+	return key, nil
+}
@@ -0,0 +1,220 @@
+package keys_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/keys"
+)
+
+const testTokenTTL = 15 * time.Minute
+
+// writeTestKey writes Ed25519 key file created at created
+func writeTestKey(t *testing.T, dir string, kid string, created time.Time, private bool) {
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := &pem.Block{
+		Headers: map[string]string{"Created": created.Format(time.RFC3339Nano)},
+	}
+	if private {
+		block.Type = "PRIVATE KEY"
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(privateKey)
+	} else {
+		block.Type = "PUBLIC KEY"
+		block.Bytes, err = x509.MarshalPKIXPublicKey(publicKey)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// parse parses token with key set
+func parse(ks *keys.KeySet, tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, ks.Keyfunc)
+}
+
+func TestSignAndVerify(t *testing.T) {
+
+	for _, alg := range []string{keys.AlgEdDSA, keys.AlgRS256} {
+		t.Run(alg, func(t *testing.T) {
+
+			ks, err := keys.NewKeySet(t.TempDir(), alg, testTokenTTL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tokenString, err := ks.Sign(jwt.MapClaims{"userID": "12345"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := parse(ks, tokenString)
+			assert.NoError(t, err)
+			assert.True(t, token.Valid)
+			assert.Equal(t, alg, token.Method.Alg())
+			assert.Equal(t, ks.SigningKey().ID, token.Header["kid"])
+		})
+	}
+}
+
+func TestVerifyFailOtherKeySet(t *testing.T) {
+
+	ks, err := keys.NewKeySet(t.TempDir(), keys.AlgEdDSA, testTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := keys.NewKeySet(t.TempDir(), keys.AlgEdDSA, testTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenString, err := other.Sign(jwt.MapClaims{"userID": "12345"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = parse(ks, tokenString)
+	assert.Error(t, err)
+}
+
+func TestVerifyFailUnexpectedMethod(t *testing.T) {
+
+	ks, err := keys.NewKeySet(t.TempDir(), keys.AlgEdDSA, testTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HMAC token naming a real kid must not verify
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"userID": "12345"})
+	token.Header["kid"] = ks.SigningKey().ID
+	tokenString, err := token.SignedString([]byte("secret_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = parse(ks, tokenString)
+	assert.Error(t, err)
+}
+
+func TestRotateKeepsOldKeyVerifying(t *testing.T) {
+
+	ks, err := keys.NewKeySet(t.TempDir(), keys.AlgEdDSA, testTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldKey := ks.SigningKey()
+	tokenString, err := ks.Sign(jwt.MapClaims{"userID": "12345"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := ks.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, newKey.ID, ks.SigningKey().ID)
+	assert.NotEqual(t, oldKey.ID, newKey.ID)
+
+	_, err = parse(ks, tokenString)
+	assert.NoError(t, err)
+
+	pruned, err := ks.Prune()
+	assert.NoError(t, err)
+	assert.Empty(t, pruned)
+	assert.Len(t, ks.JWKS(), 2)
+}
+
+func TestRetiredKeysStopVerifying(t *testing.T) {
+
+	dir := t.TempDir()
+	now := time.Now()
+
+	// old was replaced by middle too long ago, middle was replaced by current recently
+	writeTestKey(t, dir, "old", now.Add(-2*time.Hour), true)
+	writeTestKey(t, dir, "middle", now.Add(-time.Hour), true)
+	writeTestKey(t, dir, "current", now.Add(-time.Minute), true)
+
+	ks, err := keys.NewKeySet(dir, keys.AlgEdDSA, testTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "current", ks.SigningKey().ID)
+
+	kids := []string{}
+	for _, jwk := range ks.JWKS() {
+		kids = append(kids, jwk.KeyID)
+	}
+	assert.Equal(t, []string{"current", "middle"}, kids)
+
+	pruned, err := ks.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old"}, pruned)
+
+	_, err = os.Stat(filepath.Join(dir, "old.pem"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPublicKeyOnlyVerifies(t *testing.T) {
+
+	dir := t.TempDir()
+	now := time.Now()
+
+	writeTestKey(t, dir, "current", now.Add(-time.Minute), true)
+	writeTestKey(t, dir, "external", now, false)
+
+	ks, err := keys.NewKeySet(dir, keys.AlgEdDSA, testTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "current", ks.SigningKey().ID)
+	assert.Len(t, ks.JWKS(), 2)
+}
+
+func TestReloadPicksUpSharedKeys(t *testing.T) {
+
+	dir := t.TempDir()
+
+	ks, err := keys.NewKeySet(dir, keys.AlgEdDSA, testTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := keys.NewKeySet(dir, keys.AlgEdDSA, testTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := other.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, ks.Reload())
+	assert.Equal(t, newKey.ID, ks.SigningKey().ID)
+}
+
+func TestNewKeySetFailUnsupportedAlg(t *testing.T) {
+
+	_, err := keys.NewKeySet(t.TempDir(), "HS256", testTokenTTL)
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes each message to a file in Dir for local development and tests
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes message to a new .eml file
+//
+// File names start with the send time so they sort in the order sent.
+func (m *FileMailer) Send(msg Message) error {
+
+	body, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), hex.EncodeToString(suffix))
+
+	return os.WriteFile(filepath.Join(m.Dir, name), body, 0600)
+}
+
+// LogMailer logs messages instead of sending them
+type LogMailer struct {
+	From string
+}
+
+// Send logs message
+func (m *LogMailer) Send(msg Message) error {
+
+	body, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Mail to %s\n%s", msg.To, body)
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package mailer_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/mailer"
+)
+
+func TestFileMailerSend(t *testing.T) {
+
+	dir := t.TempDir()
+	m := &mailer.FileMailer{Dir: dir, From: "galt@example.com"}
+
+	err := m.Send(mailer.Message{
+		To:      "alice@example.com",
+		Subject: "Hello",
+		Body:    "Hi Alice\nBye",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, files, 1) {
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Contains(t, string(data), "From: galt@example.com\r\n")
+		assert.Contains(t, string(data), "To: alice@example.com\r\n")
+		assert.Contains(t, string(data), "Subject: Hello\r\n")
+		assert.Contains(t, string(data), "\r\n\r\nHi Alice\r\nBye")
+	}
+}
+
+func TestSendFailHeaderInjection(t *testing.T) {
+
+	dir := t.TempDir()
+	m := &mailer.FileMailer{Dir: dir, From: "galt@example.com"}
+
+	err := m.Send(mailer.Message{
+		To:      "alice@example.com\r\nBcc: eve@example.com",
+		Subject: "Hello",
+		Body:    "Hi",
+	})
+	assert.Error(t, err)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Empty(t, files)
+}
@@ -1,18 +1,26 @@
 package middleware
 
 import (
-	"errors"
 	"net/http"
 	"regexp"
+	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 
+	"github.com/jasmaa/galt/internal/apierror"
+	"github.com/jasmaa/galt/internal/keys"
 	"github.com/jasmaa/galt/internal/store"
 )
 
+// sessionTouchInterval is how stale last seen time of a session can get
+const sessionTouchInterval = time.Minute
+
 // AuthUser authorizes user
-func AuthUser(hmacSecret string) gin.HandlerFunc {
+//
+// Tokens must belong to an active session so ended sessions are locked out immediately. Sessions
+// left unused or kept past their max age expire even if their tokens have not.
+func AuthUser(keySet *keys.KeySet) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		// Extract token
@@ -27,53 +35,54 @@ func AuthUser(hmacSecret string) gin.HandlerFunc {
 		r := regexp.MustCompile(`Bearer ([\w-]+\.[\w-]+\.[\w-]+)`)
 		res := r.FindStringSubmatch(authHeader)
 		if len(res) != 2 {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token",
-			})
+			c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, "Invalid token", nil))
 			c.Abort()
 			return
 		}
 
 		tokenString := res[1]
 
-		token, _ := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-
-			// Validate alg
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("Unexpected signing method")
-			}
-
-			return []byte(hmacSecret), nil
-		})
+		token, _ := jwt.Parse(tokenString, keySet.Keyfunc)
 
 		if token == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token",
-			})
+			c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, "Invalid token", nil))
 			c.Abort()
 			return
 		}
 
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 
+			s := c.MustGet("store").(store.Repository)
+			authUserID, _ := claims["userID"].(string)
+			sessionID, _ := claims["jti"].(string)
+
+			// Check session is still active. Only access tokens have one.
+			now := time.Now()
+			session, err := s.GetSessionByID(sessionID)
+			if err != nil || session.UserID != authUserID || claims["typ"] != nil || session.IsExpired(now) {
+				c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, "Invalid token", nil))
+				c.Abort()
+				return
+			}
+
 			// Get authenticated user
-			s := c.MustGet("store").(store.Store)
-			authUserID := claims["userID"].(string)
 			authUser, err := s.GetUserByID(authUserID)
 			if err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{
-					"error": "Invalid token",
-				})
+				c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, "Invalid token", nil))
 				c.Abort()
 				return
 			}
 
+			// Record activity without writing on every request
+			if now.Sub(session.LastSeenTimestamp) > sessionTouchInterval || session.IPAddress != c.ClientIP() {
+				s.TouchSession(session.ID, c.ClientIP(), now)
+			}
+
 			c.Set("authUser", authUser)
+			c.Set("authSessionID", session.ID)
 			c.Next()
 		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token",
-			})
+			c.JSON(http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, "Invalid token", nil))
 			c.Abort()
 		}
 	}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIP takes the client ip address from header set by a trusted reverse proxy
+//
+// Clients can send the header themselves so the proxy must overwrite it rather than append to it.
+// The address replaces the request's remote address, so the router must not also trust forwarding
+// headers. Requests without a valid address in header keep the one they came from.
+func ClientIP(header string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if ip := net.ParseIP(strings.TrimSpace(c.GetHeader(header))); ip != nil {
+			c.Request.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/middleware"
+)
+
+// doClientIPRequest gets client ip address seen by router with headers
+func doClientIPRequest(r http.Handler, headers map[string]string) string {
+
+	req, _ := http.NewRequest("GET", "/ip", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	return rr.Body.String()
+}
+
+func TestClientIP(t *testing.T) {
+
+	gin.SetMode(gin.ReleaseMode)
+	ip := func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) }
+
+	// Forwarding headers are ignored without a trusted proxy
+	r := gin.New()
+	r.ForwardedByClientIP = false
+	r.GET("/ip", ip)
+	assert.Equal(t, "192.0.2.1", doClientIPRequest(r, map[string]string{"X-Forwarded-For": "203.0.113.9"}))
+
+	// Only the configured header is trusted, and only with a valid address
+	r = gin.New()
+	r.ForwardedByClientIP = false
+	r.Use(middleware.ClientIP("X-Real-IP"))
+	r.GET("/ip", ip)
+	assert.Equal(t, "203.0.113.9", doClientIPRequest(r, map[string]string{"X-Real-IP": "203.0.113.9"}))
+	assert.Equal(t, "192.0.2.1", doClientIPRequest(r, map[string]string{"X-Forwarded-For": "203.0.113.9"}))
+	assert.Equal(t, "192.0.2.1", doClientIPRequest(r, map[string]string{"X-Real-IP": "not an ip"}))
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jasmaa/galt/internal/apierror"
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// RequireVerifiedEmail stops users without a verified email when enabled
+//
+// Requests without a user are passed on so handlers reject them as usual.
+func RequireVerifiedEmail(enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		authUser, ok := c.MustGet("authUser").(*store.User)
+		if ok && !authUser.IsEmailVerified {
+			c.JSON(http.StatusForbidden, apierror.New(http.StatusForbidden, "Email not verified", nil))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jasmaa/galt/internal/apierror"
+	"github.com/jasmaa/galt/internal/ratelimit"
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// RateLimit limits requests in group to budget of limit
+//
+// Requests are counted against the authenticated user, or the client ip address if
+// there is none, so it must run after AuthUser. Each group has its own buckets.
+func RateLimit(backend ratelimit.Backend, group string, limit ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		key := group + ":ip:" + c.ClientIP()
+		if authUser, ok := c.MustGet("authUser").(*store.User); ok {
+			key = group + ":user:" + authUser.ID
+		}
+
+		// Let requests through rather than fail when backend is down
+		res, err := backend.Take(key, limit, time.Now())
+		if err != nil {
+			c.Error(err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("X-RateLimit-Reset", seconds(res.ResetAfter))
+
+		if !res.Allowed {
+			c.Header("Retry-After", seconds(res.RetryAfter))
+			c.JSON(http.StatusTooManyRequests, apierror.New(http.StatusTooManyRequests, "Too many requests", nil))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// seconds formats duration in whole seconds, rounding up
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,82 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/middleware"
+	"github.com/jasmaa/galt/internal/ratelimit"
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// setupRateLimitRouter sets up router with a read and a write group, authenticating as user in X-User
+func setupRateLimitRouter(backend ratelimit.Backend) *gin.Engine {
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+
+	r.Use(func(c *gin.Context) {
+		if userID := c.GetHeader("X-User"); len(userID) > 0 {
+			c.Set("authUser", &store.User{ID: userID})
+		} else {
+			c.Set("authUser", nil)
+		}
+		c.Next()
+	})
+
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) }
+	r.GET("/read", middleware.RateLimit(backend, "read", ratelimit.Limit{Burst: 3, Period: time.Minute}), ok)
+	r.POST("/write", middleware.RateLimit(backend, "write", ratelimit.Limit{Burst: 1, Period: time.Minute}), ok)
+
+	return r
+}
+
+// doRateLimitRequest makes request as user, anonymously if userID is empty
+func doRateLimitRequest(r http.Handler, method string, path string, userID string) *httptest.ResponseRecorder {
+
+	req, _ := http.NewRequest(method, path, nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if len(userID) > 0 {
+		req.Header.Set("X-User", userID)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+
+	r := setupRateLimitRouter(ratelimit.NewMemoryBackend())
+
+	rr := doRateLimitRequest(r, "GET", "/read", "12345")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "3", rr.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "2", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "20", rr.Header().Get("X-RateLimit-Reset"))
+	assert.Empty(t, rr.Header().Get("Retry-After"))
+}
+
+func TestRateLimitExceeded(t *testing.T) {
+
+	r := setupRateLimitRouter(ratelimit.NewMemoryBackend())
+
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(r, "POST", "/write", "12345").Code)
+
+	rr := doRateLimitRequest(r, "POST", "/write", "12345")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "0", rr.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+
+	// Groups, users and anonymous clients have separate budgets
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(r, "GET", "/read", "12345").Code)
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(r, "POST", "/write", "67890").Code)
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(r, "POST", "/write", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRateLimitRequest(r, "POST", "/write", "").Code)
+}
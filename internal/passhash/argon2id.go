@@ -0,0 +1,120 @@
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2idPrefix starts every argon2id hash
+const argon2idPrefix = "$argon2id$"
+
+// errMalformedHash is returned for hashes that have the right prefix but cannot be parsed
+var errMalformedHash = errors.New("malformed password hash")
+
+// Argon2id hashes passwords with argon2id
+//
+// Hashes use the PHC string format, like $argon2id$v=19$m=65536,t=3,p=2$salt$key with
+// memory in KiB and unpadded base64 salt and key.
+type Argon2id struct {
+	Time       uint32
+	Memory     uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// DefaultArgon2id has parameters suited to logins on a typical server
+var DefaultArgon2id = Argon2id{
+	Time:       3,
+	Memory:     64 * 1024,
+	Threads:    2,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+// argon2idHash is a parsed argon2id hash
+type argon2idHash struct {
+	params Argon2id
+	salt   []byte
+	key    []byte
+}
+
+// Hash hashes password
+func (a Argon2id) Hash(password string) (string, error) {
+
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLength)
+
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, a.Memory, a.Time, a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Matches checks for argon2id prefix
+func (a Argon2id) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+// Verify checks password against hash using the parameters it was made with
+func (a Argon2id) Verify(encoded string, password string) (bool, error) {
+
+	hash, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	p := hash.params
+	key := argon2.IDKey([]byte(password), hash.salt, p.Time, p.Memory, p.Threads, p.KeyLength)
+
+	return subtle.ConstantTimeCompare(key, hash.key) == 1, nil
+}
+
+// IsCurrent checks if hash was made with the same parameters
+func (a Argon2id) IsCurrent(encoded string) bool {
+	hash, err := parseArgon2id(encoded)
+	return err == nil && hash.params == a
+}
+
+// parseArgon2id parses argon2id hash
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errMalformedHash
+	}
+
+	hash := argon2idHash{}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.params.Memory, &hash.params.Time, &hash.params.Threads)
+	if err != nil {
+		return nil, errMalformedHash
+	}
+
+	hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, errMalformedHash
+	}
+	hash.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hash.key) == 0 {
+		return nil, errMalformedHash
+	}
+	hash.params.SaltLength = uint32(len(hash.salt))
+	hash.params.KeyLength = uint32(len(hash.key))
+
+	return &hash, nil
+}
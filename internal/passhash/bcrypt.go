@@ -0,0 +1,51 @@
+package passhash
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt hashes passwords with bcrypt at cost
+//
+// Hashes look like $2a$10$... with the cost after the version.
+type Bcrypt struct {
+	Cost int
+}
+
+// Hash hashes password
+func (b Bcrypt) Hash(password string) (string, error) {
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Matches checks for any bcrypt version prefix
+func (b Bcrypt) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// Verify checks password against hash
+func (b Bcrypt) Verify(encoded string, password string) (bool, error) {
+
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// IsCurrent checks if hash was made at cost
+func (b Bcrypt) IsCurrent(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost == b.Cost
+}
@@ -0,0 +1,83 @@
+package passhash
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrUnknownAlgorithm is returned for hashes no configured algorithm encoded
+var ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+
+// Algorithm hashes passwords into self-describing encoded hashes
+//
+// Encoded hashes start with a prefix naming their algorithm and carry their parameters
+// so they can be verified after the configuration changes.
+type Algorithm interface {
+	// Hash hashes password with a new random salt
+	Hash(password string) (string, error)
+
+	// Matches checks if encoded hash was made by this algorithm
+	Matches(encoded string) bool
+
+	// Verify checks password against encoded hash
+	Verify(encoded string, password string) (bool, error)
+
+	// IsCurrent checks if encoded hash uses this algorithm's current parameters
+	IsCurrent(encoded string) bool
+}
+
+// Hasher hashes new passwords with the preferred algorithm and verifies hashes from any known one
+type Hasher struct {
+	preferred  Algorithm
+	algorithms []Algorithm
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+// NewHasher creates hasher preferring an algorithm that still verifies hashes from legacy ones
+func NewHasher(preferred Algorithm, legacy ...Algorithm) *Hasher {
+	return &Hasher{
+		preferred:  preferred,
+		algorithms: append([]Algorithm{preferred}, legacy...),
+	}
+}
+
+// Hash hashes password with preferred algorithm
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+// Verify checks password against encoded hash
+//
+// Also reports whether a matching password should be rehashed because its hash was made
+// by a legacy algorithm or with outdated parameters.
+func (h *Hasher) Verify(encoded string, password string) (ok bool, rehash bool, err error) {
+
+	for _, algorithm := range h.algorithms {
+		if !algorithm.Matches(encoded) {
+			continue
+		}
+
+		ok, err = algorithm.Verify(encoded, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+
+		return true, algorithm != h.preferred || !algorithm.IsCurrent(encoded), nil
+	}
+
+	return false, false, ErrUnknownAlgorithm
+}
+
+// DummyHash gets hash of no real password made with preferred algorithm
+//
+// Verifying against it when there is no user takes as long as a wrong password.
+func (h *Hasher) DummyHash() string {
+
+	h.dummyOnce.Do(func() {
+		h.dummy, _ = h.preferred.Hash("dummy password")
+	})
+
+	return h.dummy
+}
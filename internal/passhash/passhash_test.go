@@ -0,0 +1,107 @@
+package passhash_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jasmaa/galt/internal/passhash"
+)
+
+// testArgon2id keeps argon2id cheap in tests
+var testArgon2id = passhash.Argon2id{Time: 1, Memory: 1024, Threads: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+
+	hasher := passhash.NewHasher(testArgon2id)
+
+	hash, err := hasher.Hash("hunter22")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	ok, rehash, err := hasher.Verify(hash, "hunter22")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, _, err = hasher.Verify(hash, "hunter23")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// Salted so hashes differ
+	other, _ := hasher.Hash("hunter22")
+	assert.NotEqual(t, hash, other)
+}
+
+func TestVerifyLegacyHash(t *testing.T) {
+
+	legacy := passhash.Bcrypt{Cost: bcrypt.MinCost}
+	hash, err := legacy.Hash("hunter22")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	hasher := passhash.NewHasher(testArgon2id, legacy)
+
+	ok, rehash, err := hasher.Verify(hash, "hunter22")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	// Wrong passwords are never rehashed
+	ok, rehash, err = hasher.Verify(hash, "hunter23")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, rehash)
+}
+
+func TestVerifyOutdatedParameters(t *testing.T) {
+
+	old := passhash.NewHasher(passhash.Bcrypt{Cost: bcrypt.MinCost})
+	hash, _ := old.Hash("hunter22")
+
+	_, rehash, err := passhash.NewHasher(passhash.Bcrypt{Cost: bcrypt.MinCost + 1}).Verify(hash, "hunter22")
+	assert.NoError(t, err)
+	assert.True(t, rehash)
+
+	stronger := testArgon2id
+	stronger.Time = 2
+	hash, _ = passhash.NewHasher(testArgon2id).Hash("hunter22")
+
+	ok, rehash, err := passhash.NewHasher(stronger).Verify(hash, "hunter22")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+}
+
+func TestVerifyFailUnknownAlgorithm(t *testing.T) {
+
+	hasher := passhash.NewHasher(testArgon2id)
+
+	// Legacy algorithm is no longer configured
+	hash, _ := passhash.Bcrypt{Cost: bcrypt.MinCost}.Hash("hunter22")
+	ok, _, err := hasher.Verify(hash, "hunter22")
+	assert.Equal(t, passhash.ErrUnknownAlgorithm, err)
+	assert.False(t, ok)
+
+	ok, _, err = hasher.Verify("$argon2id$v=19$m=1024$nope", "hunter22")
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
+
+func TestDummyHash(t *testing.T) {
+
+	hasher := passhash.NewHasher(testArgon2id)
+
+	dummy := hasher.DummyHash()
+	assert.True(t, strings.HasPrefix(dummy, "$argon2id$"))
+	assert.Equal(t, dummy, hasher.DummyHash())
+
+	ok, _, err := hasher.Verify(dummy, "hunter22")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often full buckets are dropped from memory
+const sweepInterval = time.Minute
+
+// MemoryBackend is a thread-safe in-process backend
+type MemoryBackend struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryBackend creates an empty in-process backend
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		tats: make(map[string]time.Time),
+	}
+}
+
+// Take takes a token from bucket of key
+func (m *MemoryBackend) Take(key string, limit Limit, now time.Time) (Result, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Full buckets are the same as missing ones
+	if now.Sub(m.lastSweep) > sweepInterval {
+		for k, tat := range m.tats {
+			if !tat.After(now) {
+				delete(m.tats, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	res, tat := Take(m.tats[key], limit, now)
+	m.tats[key] = tat
+
+	return res, nil
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import "time"
+
+// Limit is a token bucket holding up to Burst tokens that refills completely over Period
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// interval gets time to refill one token
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Burst)
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+
+	// RetryAfter is how long until a token is available if none was taken
+	RetryAfter time.Duration
+}
+
+// Backend keeps token buckets by key
+//
+// The in-process MemoryBackend only limits requests to one instance. A backend shared
+// between instances, like Redis, lets all of them enforce the same budget.
+type Backend interface {
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Take takes a token from bucket that will be full at tat, the theoretical arrival time
+//
+// Returns the result and the new tat to store if a token was taken. Keeping only a
+// timestamp per key lets shared backends update buckets with a single compare and set.
+func Take(tat time.Time, limit Limit, now time.Time) (Result, time.Time) {
+
+	interval := limit.interval()
+	if tat.Before(now) {
+		tat = now
+	}
+
+	next := tat.Add(interval)
+	allowAt := next.Add(-limit.Period)
+	if now.Before(allowAt) {
+		return Result{
+			Allowed:    false,
+			Limit:      limit.Burst,
+			Remaining:  0,
+			ResetAfter: tat.Sub(now),
+			RetryAfter: allowAt.Sub(now),
+		}, tat
+	}
+
+	return Result{
+		Allowed:    true,
+		Limit:      limit.Burst,
+		Remaining:  int((limit.Period - next.Sub(now)) / interval),
+		ResetAfter: next.Sub(now),
+	}, next
+}
@@ -0,0 +1,72 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/ratelimit"
+)
+
+var testLimit = ratelimit.Limit{Burst: 3, Period: 3 * time.Second}
+
+func TestTakeBurst(t *testing.T) {
+
+	b := ratelimit.NewMemoryBackend()
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		res, err := b.Take("key", testLimit, now)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, _ := b.Take("key", testLimit, now)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.ResetAfter)
+
+	// Other keys have their own bucket
+	res, _ = b.Take("other", testLimit, now)
+	assert.True(t, res.Allowed)
+}
+
+func TestTakeRefill(t *testing.T) {
+
+	b := ratelimit.NewMemoryBackend()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		b.Take("key", testLimit, now)
+	}
+
+	// One token per interval
+	res, _ := b.Take("key", testLimit, now.Add(time.Second))
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	res, _ = b.Take("key", testLimit, now.Add(time.Second))
+	assert.False(t, res.Allowed)
+
+	// Full again after period, but no more than burst
+	res, _ = b.Take("key", testLimit, now.Add(time.Hour))
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, res.Remaining)
+	assert.Equal(t, time.Second, res.ResetAfter)
+}
+
+func TestDeniedTakeDoesNotSpend(t *testing.T) {
+
+	b := ratelimit.NewMemoryBackend()
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		b.Take("key", testLimit, now)
+	}
+
+	res, _ := b.Take("key", testLimit, now.Add(time.Second))
+	assert.True(t, res.Allowed)
+}
@@ -1,9 +1,5 @@
 package store
 
-import (
-	"errors"
-)
-
 // Circle is a social circle
 type Circle struct {
 	ID          string
@@ -22,12 +18,36 @@ func (s *Store) GetCircleByID(circleID string) (*Circle, error) {
 
 	circle := Circle{}
 	if err := row.Scan(&circle.ID, &circle.UserID, &circle.Name, &circle.Description); err != nil {
-		return nil, errors.New("No circle found")
+		return nil, scanError("No circle found", err)
 	}
 
 	return &circle, nil
 }
 
+// GetUserCircles gets every circle owned by user ordered by name
+func (s *Store) GetUserCircles(userID string) ([]Circle, error) {
+
+	rows, err := s.db.Query(
+		"SELECT id, user_id, name, description FROM circles WHERE user_id=$1 ORDER BY name, id",
+		userID,
+	)
+	if err != nil {
+		return nil, dbError("Error retrieving circles", err)
+	}
+	defer rows.Close()
+
+	circles := make([]Circle, 0)
+	for rows.Next() {
+		circle := Circle{}
+		if err := rows.Scan(&circle.ID, &circle.UserID, &circle.Name, &circle.Description); err != nil {
+			return nil, dbError("Error retrieving circles", err)
+		}
+		circles = append(circles, circle)
+	}
+
+	return circles, nil
+}
+
 // InsertCircle inserts social circle
 func (s *Store) InsertCircle(circle Circle) error {
 
@@ -36,7 +56,7 @@ func (s *Store) InsertCircle(circle Circle) error {
 		circle.ID, circle.UserID, circle.Name, circle.Description,
 	)
 	if err != nil {
-		return errors.New("Error creating circle")
+		return dbError("Error creating circle", err)
 	}
 
 	return nil
@@ -50,7 +70,7 @@ func (s *Store) UpdateCircle(circle Circle) error {
 		circle.ID, circle.Name, circle.Description,
 	)
 	if err != nil {
-		return errors.New("Error updating circle")
+		return dbError("Error updating circle", err)
 	}
 
 	return nil
@@ -61,7 +81,7 @@ func (s *Store) DeleteCircleByID(circleID string) error {
 
 	_, err := s.db.Exec("DELETE FROM circles WHERE id=$1", circleID)
 	if err != nil {
-		return errors.New("Error deleting circle")
+		return dbError("Error deleting circle", err)
 	}
 
 	return nil
@@ -75,7 +95,7 @@ func (s *Store) GetIsInCircle(userID string, circleID string) (bool, error) {
 	)
 	var count int
 	if err := row.Scan(&count); err != nil {
-		return false, errors.New("Error with database")
+		return false, dbError("Error with database", err)
 	}
 	if count > 0 {
 		return true, nil
@@ -102,7 +122,7 @@ func (s *Store) InsertCircleUserPair(userID string, circleID string) error {
 		userID, circleID,
 	)
 	if err != nil {
-		return errors.New("Error inserting user circle pair")
+		return dbError("Error inserting user circle pair", err)
 	}
 
 	return nil
@@ -116,7 +136,7 @@ func (s *Store) DeleteCircleUserPair(userID string, circleID string) error {
 		userID, circleID,
 	)
 	if err != nil {
-		return errors.New("Error deleting user circle pair")
+		return dbError("Error deleting user circle pair", err)
 	}
 
 	return nil
@@ -130,8 +150,29 @@ func (s *Store) GetCircleUserCount(circleID string) (int, error) {
 	)
 	var count int
 	if err := row.Scan(&count); err != nil {
-		return -1, errors.New("Error with database")
+		return -1, dbError("Error with database", err)
 	}
 
 	return count, nil
 }
+
+// GetCircleUserIDs gets ids of users in circle
+func (s *Store) GetCircleUserIDs(circleID string) ([]string, error) {
+
+	rows, err := s.db.Query("SELECT user_id FROM circle_user_pairs WHERE circle_id=$1 ORDER BY user_id", circleID)
+	if err != nil {
+		return nil, dbError("Error with database", err)
+	}
+	defer rows.Close()
+
+	userIDs := make([]string, 0)
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, dbError("Error with database", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, nil
+}
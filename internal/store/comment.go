@@ -2,8 +2,9 @@ package store
 
 import (
 	"database/sql"
-	"errors"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // Comment is a user comment
@@ -15,44 +16,77 @@ type Comment struct {
 	Content         string
 	PostedTimestamp time.Time
 	IsEdited        bool
+	IsDeleted       bool
 }
 
 // GetCommentByID gets comment by id
 func (s *Store) GetCommentByID(commentID string) (*Comment, error) {
 
 	row := s.db.QueryRow(
-		`SELECT id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited FROM comments WHERE id=$1`,
+		`SELECT id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited, is_deleted FROM comments WHERE id=$1`,
 		commentID,
 	)
 
 	comment := Comment{}
-	if err := row.Scan(&comment.ID, &comment.UserID, &comment.StatusID, &comment.ParentCommentID, &comment.Content, &comment.PostedTimestamp, &comment.IsEdited); err != nil {
-		return nil, errors.New("No comment found")
+	if err := row.Scan(&comment.ID, &comment.UserID, &comment.StatusID, &comment.ParentCommentID, &comment.Content, &comment.PostedTimestamp, &comment.IsEdited, &comment.IsDeleted); err != nil {
+		return nil, scanError("No comment found", err)
 	}
 
 	return &comment, nil
 }
 
-// GetCommentsFromStatus gets comments under a status
-func (s *Store) GetCommentsFromStatus(statusID string, limit int, offset int) ([]Comment, error) {
+// GetCommentsFromStatus gets page of comments under a status after cursor, starting from the newest if cursor is nil
+func (s *Store) GetCommentsFromStatus(statusID string, limit int, after *Cursor) ([]Comment, error) {
 
+	afterTimestamp, afterID := cursorParams(after)
 	rows, err := s.db.Query(
-		`SELECT id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited
-		FROM comments WHERE status_id=$1
-		ORDER BY posted_timestamp DESC
-		LIMIT $2 OFFSET $3`,
-		statusID, limit, offset,
+		`SELECT id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited, is_deleted
+		FROM comments WHERE status_id=$1 AND `+afterCursor("$2", "$3")+`
+		ORDER BY posted_timestamp DESC, id DESC
+		LIMIT $4`,
+		statusID, afterTimestamp, afterID, limit,
 	)
-	defer rows.Close()
 	if err != nil {
-		return nil, errors.New("Error retrieving comments")
+		return nil, dbError("Error retrieving comments", err)
 	}
+	defer rows.Close()
 
 	comments := make([]Comment, 0)
 
 	for rows.Next() {
 		comment := Comment{}
-		rows.Scan(&comment.ID, &comment.UserID, &comment.StatusID, &comment.ParentCommentID, &comment.Content, &comment.PostedTimestamp, &comment.IsEdited)
+		if err := rows.Scan(&comment.ID, &comment.UserID, &comment.StatusID, &comment.ParentCommentID, &comment.Content, &comment.PostedTimestamp, &comment.IsEdited, &comment.IsDeleted); err != nil {
+			return nil, dbError("Error retrieving comments", err)
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError("Error retrieving comments", err)
+	}
+
+	return comments, nil
+}
+
+// GetUserComments gets every comment posted by user that was not deleted, newest first
+func (s *Store) GetUserComments(userID string) ([]Comment, error) {
+
+	rows, err := s.db.Query(
+		`SELECT id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited, is_deleted
+		FROM comments WHERE user_id=$1 AND NOT is_deleted
+		ORDER BY posted_timestamp DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, dbError("Error retrieving comments", err)
+	}
+	defer rows.Close()
+
+	comments := make([]Comment, 0)
+	for rows.Next() {
+		comment := Comment{}
+		if err := rows.Scan(&comment.ID, &comment.UserID, &comment.StatusID, &comment.ParentCommentID, &comment.Content, &comment.PostedTimestamp, &comment.IsEdited, &comment.IsDeleted); err != nil {
+			return nil, dbError("Error retrieving comments", err)
+		}
 		comments = append(comments, comment)
 	}
 
@@ -63,11 +97,11 @@ func (s *Store) GetCommentsFromStatus(statusID string, limit int, offset int) ([
 func (s *Store) InsertComment(comment Comment) error {
 
 	_, err := s.db.Exec(
-		"INSERT INTO comments (id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited) VALUES ($1, $2, $3, $4, $5, $6, $7)",
-		comment.ID, comment.UserID, comment.StatusID, comment.ParentCommentID, comment.Content, comment.PostedTimestamp, comment.IsEdited,
+		"INSERT INTO comments (id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited, is_deleted) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		comment.ID, comment.UserID, comment.StatusID, comment.ParentCommentID, comment.Content, comment.PostedTimestamp, comment.IsEdited, comment.IsDeleted,
 	)
 	if err != nil {
-		return errors.New("Error creating comment")
+		return dbError("Error creating comment", err)
 	}
 
 	return nil
@@ -77,11 +111,11 @@ func (s *Store) InsertComment(comment Comment) error {
 func (s *Store) UpdateComment(comment Comment) error {
 
 	_, err := s.db.Exec(
-		"UPDATE comments SET content=$2, posted_timestamp=$3, is_edited=$4 WHERE id=$1",
-		comment.ID, comment.Content, comment.PostedTimestamp, comment.IsEdited,
+		"UPDATE comments SET content=$2, posted_timestamp=$3, is_edited=$4, is_deleted=$5 WHERE id=$1",
+		comment.ID, comment.Content, comment.PostedTimestamp, comment.IsEdited, comment.IsDeleted,
 	)
 	if err != nil {
-		return errors.New("Error updating comment")
+		return dbError("Error updating comment", err)
 	}
 
 	return nil
@@ -91,8 +125,11 @@ func (s *Store) UpdateComment(comment Comment) error {
 func (s *Store) DeleteCommentByID(commentID string) error {
 
 	_, err := s.db.Exec("DELETE FROM comments WHERE id=$1", commentID)
+	if isViolation(err, foreignKeyViolation) {
+		return conflict("Comment has replies", err)
+	}
 	if err != nil {
-		return errors.New("Error deleting comment")
+		return dbError("Error deleting comment", err)
 	}
 
 	return nil
@@ -101,27 +138,92 @@ func (s *Store) DeleteCommentByID(commentID string) error {
 // GetCommentReplies gets replies for a comment
 func (s *Store) GetCommentReplies(commentID string) ([]Comment, error) {
 	rows, err := s.db.Query(
-		`SELECT id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited
+		`SELECT id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited, is_deleted
 		FROM comments WHERE parent_comment_id=$1
 		ORDER BY posted_timestamp DESC`,
 		commentID,
 	)
-	defer rows.Close()
 	if err != nil {
-		return nil, errors.New("Error retrieving comments")
+		return nil, dbError("Error retrieving comments", err)
 	}
+	defer rows.Close()
 
 	comments := make([]Comment, 0)
 
 	for rows.Next() {
 		comment := Comment{}
-		rows.Scan(&comment.ID, &comment.UserID, &comment.StatusID, &comment.ParentCommentID, &comment.Content, &comment.PostedTimestamp, &comment.IsEdited)
+		if err := rows.Scan(&comment.ID, &comment.UserID, &comment.StatusID, &comment.ParentCommentID, &comment.Content, &comment.PostedTimestamp, &comment.IsEdited, &comment.IsDeleted); err != nil {
+			return nil, dbError("Error retrieving comments", err)
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError("Error retrieving comments", err)
+	}
+
+	return comments, nil
+}
+
+// GetCommentSubtree gets comment followed by its replies down to depth levels
+//
+// Each comment gets at most limit of its newest replies. Replies to the top comment start
+// after cursor. Comments are ordered by level and then newest first.
+func (s *Store) GetCommentSubtree(commentID string, depth int, limit int, after *Cursor) ([]Comment, error) {
+
+	afterTimestamp, afterID := cursorParams(after)
+	rows, err := s.db.Query(
+		`WITH RECURSIVE chain AS (
+			SELECT id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited, is_deleted, 0 AS depth
+			FROM comments WHERE id=$1
+			UNION ALL
+			SELECT replies.*, chain.depth+1
+			FROM chain CROSS JOIN LATERAL (
+				SELECT id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited, is_deleted
+				FROM comments
+				WHERE parent_comment_id=chain.id AND (chain.depth > 0 OR `+afterCursor("$4", "$5")+`)
+				ORDER BY posted_timestamp DESC, id DESC
+				LIMIT $3
+			) replies
+			WHERE chain.depth < $2
+		)
+		SELECT id, user_id, status_id, parent_comment_id, content, posted_timestamp, is_edited, is_deleted
+		FROM chain ORDER BY depth, posted_timestamp DESC, id DESC`,
+		commentID, depth, limit, afterTimestamp, afterID,
+	)
+	if err != nil {
+		return nil, dbError("Error retrieving comments", err)
+	}
+	defer rows.Close()
+
+	comments := make([]Comment, 0)
+	for rows.Next() {
+		comment := Comment{}
+		if err := rows.Scan(&comment.ID, &comment.UserID, &comment.StatusID, &comment.ParentCommentID, &comment.Content, &comment.PostedTimestamp, &comment.IsEdited, &comment.IsDeleted); err != nil {
+			return nil, dbError("Error retrieving comments", err)
+		}
 		comments = append(comments, comment)
 	}
+	if len(comments) == 0 {
+		return nil, notFound("No comment found", nil)
+	}
 
 	return comments, nil
 }
 
+// GetCommentReplyCount gets number of replies to a comment
+func (s *Store) GetCommentReplyCount(commentID string) (int, error) {
+
+	row := s.db.QueryRow("SELECT COUNT(id) FROM comments WHERE parent_comment_id=$1",
+		commentID,
+	)
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return -1, dbError("Error with database", err)
+	}
+
+	return count, nil
+}
+
 // GetCommentLikes gets number of likes on a comment
 func (s *Store) GetCommentLikes(commentID string) (int, error) {
 
@@ -130,12 +232,27 @@ func (s *Store) GetCommentLikes(commentID string) (int, error) {
 	)
 	var count int
 	if err := row.Scan(&count); err != nil {
-		return -1, errors.New("Error with database")
+		return -1, dbError("Error with database", err)
 	}
 
 	return count, nil
 }
 
+// GetCommentLikeCounts gets number of likes on each comment keyed by id
+//
+// Comments without likes are left out.
+func (s *Store) GetCommentLikeCounts(commentIDs []string) (map[string]int, error) {
+
+	if len(commentIDs) == 0 {
+		return make(map[string]int), nil
+	}
+
+	return s.queryCounts(
+		"SELECT comment_id, COUNT(user_id) FROM comment_like_pairs WHERE comment_id=ANY($1) GROUP BY comment_id",
+		pq.Array(commentIDs),
+	)
+}
+
 // GetIsUserLikedComment checks if comment was liked by user
 func (s *Store) GetIsUserLikedComment(userID string, commentID string) (bool, error) {
 
@@ -144,7 +261,7 @@ func (s *Store) GetIsUserLikedComment(userID string, commentID string) (bool, er
 	)
 	var count int
 	if err := row.Scan(&count); err != nil {
-		return false, errors.New("Error with database")
+		return false, dbError("Error with database", err)
 	}
 	if count > 0 {
 		return true, nil
@@ -153,6 +270,54 @@ func (s *Store) GetIsUserLikedComment(userID string, commentID string) (bool, er
 	return false, nil
 }
 
+// GetUserLikedComments gets which of the comments were liked by user
+func (s *Store) GetUserLikedComments(userID string, commentIDs []string) (map[string]bool, error) {
+
+	liked := make(map[string]bool)
+	if len(commentIDs) == 0 {
+		return liked, nil
+	}
+
+	rows, err := s.db.Query("SELECT comment_id FROM comment_like_pairs WHERE user_id=$1 AND comment_id=ANY($2)",
+		userID, pq.Array(commentIDs),
+	)
+	if err != nil {
+		return nil, dbError("Error with database", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID string
+		if err := rows.Scan(&commentID); err != nil {
+			return nil, dbError("Error with database", err)
+		}
+		liked[commentID] = true
+	}
+
+	return liked, nil
+}
+
+// GetUserCommentLikes gets ids of every comment liked by user
+func (s *Store) GetUserCommentLikes(userID string) ([]string, error) {
+
+	rows, err := s.db.Query("SELECT comment_id FROM comment_like_pairs WHERE user_id=$1 ORDER BY comment_id", userID)
+	if err != nil {
+		return nil, dbError("Error with database", err)
+	}
+	defer rows.Close()
+
+	commentIDs := make([]string, 0)
+	for rows.Next() {
+		var commentID string
+		if err := rows.Scan(&commentID); err != nil {
+			return nil, dbError("Error with database", err)
+		}
+		commentIDs = append(commentIDs, commentID)
+	}
+
+	return commentIDs, nil
+}
+
 // InsertCommentLikePair inserts (userID, commentID) pair for liking a comment
 func (s *Store) InsertCommentLikePair(userID string, commentID string) error {
 
@@ -171,7 +336,7 @@ func (s *Store) InsertCommentLikePair(userID string, commentID string) error {
 		userID, commentID,
 	)
 	if err != nil {
-		return errors.New("Error inserting comment like pair")
+		return dbError("Error inserting comment like pair", err)
 	}
 
 	return nil
@@ -185,7 +350,7 @@ func (s *Store) DeleteCommentLikePair(userID string, commentID string) error {
 		userID, commentID,
 	)
 	if err != nil {
-		return errors.New("Error deleting comment like pair")
+		return dbError("Error deleting comment like pair", err)
 	}
 
 	return nil
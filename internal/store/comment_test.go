@@ -0,0 +1,58 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+func TestGetCommentsFromStatusErrors(t *testing.T) {
+
+	// Setup db
+	s := store.Store{}
+	mock := s.OpenMock()
+	defer s.Close()
+
+	columns := []string{"id", "user_id", "status_id", "parent_comment_id", "content", "posted_timestamp", "is_edited", "is_deleted"}
+	mock.ExpectQuery("SELECT (.+) FROM comments").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("12345", "12345", "12345", nil, "content", "not a time", false, false))
+	mock.ExpectQuery("SELECT (.+) FROM comments").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("12345").RowError(0, errors.New("connection reset")))
+
+	// Rows that cannot be read fail the query instead of coming back empty
+	_, err := s.GetCommentsFromStatus("12345", 10, nil)
+	if err == nil || err.Error() != "Error retrieving comments" {
+		t.Errorf("expected scan error, got: %v", err)
+	}
+	_, err = s.GetCommentsFromStatus("12345", 10, nil)
+	if err == nil || errors.Unwrap(err).Error() != "connection reset" {
+		t.Errorf("expected row error, got: %v", err)
+	}
+}
+
+func TestGetStatusFeedErrors(t *testing.T) {
+
+	// Setup db
+	s := store.Store{}
+	mock := s.OpenMock()
+	defer s.Close()
+
+	columns := []string{"id", "user_id", "content", "posted_timestamp", "is_edited", "visibility", "reshared_status_id"}
+	mock.ExpectQuery("SELECT (.+) FROM statuses").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("12345", "12345", "content", "not a time", false, "public", nil))
+	mock.ExpectQuery("SELECT (.+) FROM statuses").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("12345").RowError(0, errors.New("connection reset")))
+
+	// Rows that cannot be read fail the query instead of coming back empty
+	_, err := s.GetStatusFeed("12345", 10, nil)
+	if err == nil || err.Error() != "Error retrieving feed" {
+		t.Errorf("expected scan error, got: %v", err)
+	}
+	_, err = s.GetStatusFeed("12345", 10, nil)
+	if err == nil || errors.Unwrap(err).Error() != "connection reset" {
+		t.Errorf("expected row error, got: %v", err)
+	}
+}
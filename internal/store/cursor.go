@@ -0,0 +1,76 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Cursor is a position in a list ordered newest first by posted timestamp then id
+//
+// Pages start after the cursor so rows posted while paging do not shift later pages.
+type Cursor struct {
+	PostedTimestamp time.Time
+	ID              string
+}
+
+// Encode encodes cursor as an opaque string
+func (c Cursor) Encode() string {
+	raw := c.PostedTimestamp.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor decodes cursor made by Encode
+func DecodeCursor(encoded string) (*Cursor, error) {
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("Invalid cursor")
+	}
+
+	// Ids are compared as UUIDs so anything else would fail in the query instead
+	if _, err := uuid.Parse(parts[1]); err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+
+	postedTimestamp, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+
+	return &Cursor{PostedTimestamp: postedTimestamp, ID: parts[1]}, nil
+}
+
+// isAfter checks if row at (postedTimestamp, id) comes after cursor, treating nil as the start
+func (c *Cursor) isAfter(postedTimestamp time.Time, id string) bool {
+	if c == nil {
+		return true
+	}
+	if postedTimestamp.Equal(c.PostedTimestamp) {
+		return id < c.ID
+	}
+	return postedTimestamp.Before(c.PostedTimestamp)
+}
+
+// cursorParams converts cursor to query params, using NULLs for the start
+func cursorParams(c *Cursor) (sql.NullTime, sql.NullString) {
+	if c == nil {
+		return sql.NullTime{}, sql.NullString{}
+	}
+	return sql.NullTime{Time: c.PostedTimestamp, Valid: true}, sql.NullString{String: c.ID, Valid: true}
+}
+
+// afterCursor is the SQL predicate for rows after the cursor given by timestamp and id params
+func afterCursor(timestampParam string, idParam string) string {
+	return fmt.Sprintf(`(%[1]s::timestamp IS NULL OR (posted_timestamp, id) < (%[1]s::timestamp, %[2]s::uuid))`, timestampParam, idParam)
+}
@@ -0,0 +1,32 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+
+	cursor := store.Cursor{
+		PostedTimestamp: time.Date(2020, 6, 1, 12, 30, 0, 123456000, time.UTC),
+		ID:              "00000000-0000-0000-0001-000000000001",
+	}
+
+	got, err := store.DecodeCursor(cursor.Encode())
+	if assert.NoError(t, err) {
+		assert.True(t, cursor.PostedTimestamp.Equal(got.PostedTimestamp))
+		assert.Equal(t, cursor.ID, got.ID)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+
+	for _, encoded := range []string{"not a cursor", "bm90IGEgY3Vyc29y", "MjAyMC0wNi0wMVQxMjozMDowMFp8", "MjAyMC0wNi0wMVQxMjozMDowMFp8YWJjZGU"} {
+		_, err := store.DecodeCursor(encoded)
+		assert.Error(t, err, encoded)
+	}
+}
@@ -10,8 +10,41 @@ import (
 )
 
 // Store wraps database connection
+//
+// Stores made by WithTx run everything in their transaction instead.
 type Store struct {
-	db *sql.DB
+	pool *sql.DB
+	db   conn
+	tx   *sql.Tx
+}
+
+// conn runs statements on the database or in a transaction
+type conn interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// txConn is a transaction that changes are committed or rolled back with
+type txConn interface {
+	conn
+	Commit() error
+	Rollback() error
+}
+
+// joinedTx is part of an enclosing transaction, which is committed or rolled back as a whole by WithTx
+type joinedTx struct {
+	*sql.Tx
+}
+
+// Commit leaves enclosing transaction to be committed
+func (joinedTx) Commit() error {
+	return nil
+}
+
+// Rollback leaves enclosing transaction to be rolled back
+func (joinedTx) Rollback() error {
+	return nil
 }
 
 // Open opens database connection
@@ -29,11 +62,18 @@ func (s *Store) Open() {
 		pgUser, pgPassword, pgHost, pgPort, pgDB,
 	)
 
+	s.OpenURL(connStr)
+}
+
+// OpenURL opens database connection from connection string
+func (s *Store) OpenURL(connStr string) {
+
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	s.pool = db
 	s.db = db
 }
 
@@ -45,12 +85,71 @@ func (s *Store) OpenMock() sqlmock.Sqlmock {
 		log.Fatal(err)
 	}
 
+	s.pool = db
 	s.db = db
 
 	return mock
 }
 
+// begin starts a transaction, or joins the one store is already in
+func (s *Store) begin() (txConn, error) {
+
+	if s.tx != nil {
+		return joinedTx{s.tx}, nil
+	}
+
+	return s.pool.Begin()
+}
+
+// WithTx runs fn with a store in a transaction, committing it if fn succeeds and rolling it back otherwise
+//
+// Stores already in a transaction run fn in it.
+func (s *Store) WithTx(fn func(Repository) error) error {
+
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	tx, err := s.pool.Begin()
+	if err != nil {
+		return dbError("Error with database", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&Store{pool: s.pool, db: tx, tx: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError("Error with database", err)
+	}
+
+	return nil
+}
+
+// queryCounts runs query returning (id, count) rows and collects counts by id
+func (s *Store) queryCounts(query string, args ...interface{}) (map[string]int, error) {
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, dbError("Error with database", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, dbError("Error with database", err)
+		}
+		counts[id] = count
+	}
+
+	return counts, nil
+}
+
 // Close closes database connection
 func (s *Store) Close() {
-	s.db.Close()
+	s.pool.Close()
 }
@@ -0,0 +1,53 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+func TestWithTx(t *testing.T) {
+
+	// Setup db
+	s := store.Store{}
+	mock := s.OpenMock()
+	defer s.Close()
+
+	// Statements in fn, including ones that start their own transaction, share one transaction
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM recovery_codes").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	err := s.WithTx(func(tx store.Repository) error {
+		if err := tx.UpdateUser(store.User{ID: "12345", Username: "bowser"}); err != nil {
+			return err
+		}
+		return tx.ReplaceRecoveryCodes("12345", nil)
+	})
+	if err != nil {
+		t.Errorf("error in transaction: %v", err)
+	}
+
+	// Failing fn rolls back
+	failed := errors.New("failed")
+	err = s.WithTx(func(tx store.Repository) error {
+		if err := tx.UpdateUser(store.User{ID: "12345", Username: "bowser"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Errorf("expected fn error, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Postgres error codes for violated constraints
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// invalidTextRepresentation is the Postgres error code for a value that cannot be parsed, like a malformed UUID
+const invalidTextRepresentation = "22P02"
+
+// Kinds of store errors, checked with errors.Is
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrConflict  = errors.New("conflict")
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Error is a store error with a message safe to show clients
+//
+// It matches its kind with errors.Is and unwraps to the underlying database error, if any.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+// Error gets message
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap gets underlying database error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is checks if error is of kind
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// dbError wraps unexpected database error
+func dbError(message string, err error) error {
+	return &Error{Message: message, Err: err}
+}
+
+// notFound creates error for a missing row
+func notFound(message string, err error) error {
+	return &Error{Kind: ErrNotFound, Message: message, Err: err}
+}
+
+// conflict creates error for a write that clashes with existing rows
+func conflict(message string, err error) error {
+	return &Error{Kind: ErrConflict, Message: message, Err: err}
+}
+
+// forbidden creates error for a change that is never allowed
+func forbidden(message string, err error) error {
+	return &Error{Kind: ErrForbidden, Message: message, Err: err}
+}
+
+// scanError wraps error from reading a single row, treating no rows as not found
+//
+// Ids that are not UUIDs cannot match any row so they are not found either.
+func scanError(message string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) || isViolation(err, invalidTextRepresentation) {
+		return notFound(message, err)
+	}
+	return dbError("Error with database", err)
+}
+
+// isViolation checks if error is Postgres violating constraint of code
+func isViolation(err error, code string) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && string(pqErr.Code) == code
+}
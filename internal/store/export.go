@@ -0,0 +1,105 @@
+package store
+
+import "time"
+
+// Export states
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// Export is a copy of a user's data built in the background for them to download
+type Export struct {
+	ID               string
+	UserID           string
+	State            string
+	Archive          []byte
+	CreatedTimestamp time.Time
+	ExpiresTimestamp time.Time
+}
+
+// InsertExport inserts export
+//
+// Fails with a conflict if export is pending while user already has a pending export.
+func (s *Store) InsertExport(export Export) error {
+
+	_, err := s.db.Exec(
+		`INSERT INTO exports (id, user_id, state, archive, created_timestamp, expires_timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		export.ID, export.UserID, export.State, export.Archive, export.CreatedTimestamp, export.ExpiresTimestamp,
+	)
+	if isViolation(err, uniqueViolation) {
+		return conflict("Export already in progress", err)
+	} else if err != nil {
+		return dbError("Error inserting export", err)
+	}
+
+	return nil
+}
+
+// GetExportByID gets export by id
+func (s *Store) GetExportByID(exportID string) (*Export, error) {
+
+	row := s.db.QueryRow(
+		`SELECT id, user_id, state, archive, created_timestamp, expires_timestamp
+		FROM exports WHERE id=$1`,
+		exportID,
+	)
+
+	export := Export{}
+	if err := row.Scan(&export.ID, &export.UserID, &export.State, &export.Archive, &export.CreatedTimestamp, &export.ExpiresTimestamp); err != nil {
+		return nil, scanError("No export found", err)
+	}
+
+	return &export, nil
+}
+
+// FinishExport sets final state of export and its archive if it was built
+func (s *Store) FinishExport(exportID string, state string, archive []byte) error {
+
+	_, err := s.db.Exec("UPDATE exports SET state=$2, archive=$3 WHERE id=$1", exportID, state, archive)
+	if err != nil {
+		return dbError("Error updating export", err)
+	}
+
+	return nil
+}
+
+// FailStaleExports fails exports still pending that were created at or before time, returning how
+// many were failed
+//
+// Builds are lost if the server stops while they run, which would leave their user unable to export again.
+func (s *Store) FailStaleExports(before time.Time) (int, error) {
+
+	res, err := s.db.Exec(
+		"UPDATE exports SET state=$1 WHERE state=$2 AND created_timestamp<=$3",
+		ExportFailed, ExportPending, before,
+	)
+	if err != nil {
+		return 0, dbError("Error updating exports", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, dbError("Error updating exports", err)
+	}
+
+	return int(count), nil
+}
+
+// DeleteExpiredExports deletes exports that expired at or before time, returning how many were deleted
+func (s *Store) DeleteExpiredExports(before time.Time) (int, error) {
+
+	res, err := s.db.Exec("DELETE FROM exports WHERE expires_timestamp<=$1", before)
+	if err != nil {
+		return 0, dbError("Error deleting exports", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, dbError("Error deleting exports", err)
+	}
+
+	return int(count), nil
+}
@@ -0,0 +1,161 @@
+package store
+
+import "time"
+
+// LoginFailure counts recent failed logins against a throttle key
+//
+// Keys name what is being guessed against, like a username or an ip address, and are
+// tracked whether or not a matching user exists.
+type LoginFailure struct {
+	Key                  string
+	FailureCount         int
+	LastFailureTimestamp time.Time
+	LockedUntilTimestamp time.Time
+}
+
+// LoginLockout is an audit record of a throttle key being locked out
+type LoginLockout struct {
+	ID               string
+	Key              string
+	Username         string
+	IPAddress        string
+	FailureCount     int
+	CreatedTimestamp time.Time
+	ExpiresTimestamp time.Time
+}
+
+// GetLoginFailure gets failed logins of throttle key
+func (s *Store) GetLoginFailure(key string) (*LoginFailure, error) {
+
+	row := s.db.QueryRow(
+		`SELECT throttle_key, failure_count, last_failure_timestamp, locked_until_timestamp
+		FROM login_failures WHERE throttle_key=$1`,
+		key,
+	)
+
+	failure := LoginFailure{}
+	if err := row.Scan(&failure.Key, &failure.FailureCount, &failure.LastFailureTimestamp, &failure.LockedUntilTimestamp); err != nil {
+		return nil, scanError("No login failure found", err)
+	}
+
+	return &failure, nil
+}
+
+// RecordLoginFailure counts failed login against throttle key and returns the new count
+//
+// Counting starts over if the last failure was before resetBefore.
+func (s *Store) RecordLoginFailure(key string, now time.Time, resetBefore time.Time) (int, error) {
+
+	row := s.db.QueryRow(
+		`INSERT INTO login_failures (throttle_key, failure_count, last_failure_timestamp, locked_until_timestamp)
+		VALUES ($1, 1, $2, TO_TIMESTAMP(0))
+		ON CONFLICT (throttle_key) DO UPDATE SET
+			failure_count=CASE WHEN login_failures.last_failure_timestamp<$3 THEN 1 ELSE login_failures.failure_count+1 END,
+			last_failure_timestamp=$2
+		RETURNING failure_count`,
+		key, now, resetBefore,
+	)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, dbError("Error recording login failure", err)
+	}
+
+	return count, nil
+}
+
+// LockLogin locks out throttle key until lockout expires and records lockout for auditing
+//
+// The failure count starts over so the key can be locked out again after it expires.
+func (s *Store) LockLogin(lockout LoginLockout) error {
+
+	tx, err := s.begin()
+	if err != nil {
+		return dbError("Error with database", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE login_failures SET failure_count=0, locked_until_timestamp=$2 WHERE throttle_key=$1",
+		lockout.Key, lockout.ExpiresTimestamp,
+	)
+	if err != nil {
+		return dbError("Error locking login", err)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO login_lockouts (id, throttle_key, username, ip_address, failure_count, created_timestamp, expires_timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		lockout.ID, lockout.Key, lockout.Username, lockout.IPAddress, lockout.FailureCount, lockout.CreatedTimestamp, lockout.ExpiresTimestamp,
+	)
+	if err != nil {
+		return dbError("Error locking login", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError("Error locking login", err)
+	}
+
+	return nil
+}
+
+// DeleteLoginFailure clears failed logins of throttle key
+func (s *Store) DeleteLoginFailure(key string) error {
+
+	_, err := s.db.Exec("DELETE FROM login_failures WHERE throttle_key=$1", key)
+	if err != nil {
+		return dbError("Error deleting login failure", err)
+	}
+
+	return nil
+}
+
+// DeleteStaleLoginFailures deletes failed logins last seen and locked out until at or before time,
+// returning how many were deleted
+func (s *Store) DeleteStaleLoginFailures(before time.Time) (int, error) {
+
+	res, err := s.db.Exec(
+		"DELETE FROM login_failures WHERE last_failure_timestamp<=$1 AND locked_until_timestamp<=$1",
+		before,
+	)
+	if err != nil {
+		return 0, dbError("Error deleting login failures", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, dbError("Error deleting login failures", err)
+	}
+
+	return int(count), nil
+}
+
+// GetLoginLockouts gets lockouts created since time, newest first
+func (s *Store) GetLoginLockouts(since time.Time) ([]LoginLockout, error) {
+
+	rows, err := s.db.Query(
+		`SELECT id, throttle_key, username, ip_address, failure_count, created_timestamp, expires_timestamp
+		FROM login_lockouts WHERE created_timestamp>=$1
+		ORDER BY created_timestamp DESC, id DESC`,
+		since,
+	)
+	if err != nil {
+		return nil, dbError("Error retrieving lockouts", err)
+	}
+	defer rows.Close()
+
+	lockouts := make([]LoginLockout, 0)
+	for rows.Next() {
+		lockout := LoginLockout{}
+		err := rows.Scan(
+			&lockout.ID, &lockout.Key, &lockout.Username, &lockout.IPAddress, &lockout.FailureCount,
+			&lockout.CreatedTimestamp, &lockout.ExpiresTimestamp,
+		)
+		if err != nil {
+			return nil, dbError("Error retrieving lockouts", err)
+		}
+		lockouts = append(lockouts, lockout)
+	}
+
+	return lockouts, nil
+}
@@ -0,0 +1,2001 @@
+package store
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+)
+
+// pair is a row in a two column join table
+type pair struct {
+	a string
+	b string
+}
+
+// MemoryStore is a thread-safe in-memory repository
+//
+// It mirrors the behavior of the Postgres store, including foreign key
+// constraints and cascades, so it can stand in for it in tests and demos.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	users    map[string]User
+	statuses map[string]Status
+	comments map[string]Comment
+	circles  map[string]Circle
+
+	circleUserPairs   map[pair]bool // (userID, circleID)
+	statusCirclePairs map[pair]bool // (statusID, circleID)
+	statusLikePairs   map[pair]bool // (userID, statusID)
+	commentLikePairs  map[pair]bool // (userID, commentID)
+
+	refreshTokens           map[string]RefreshToken
+	passwordResetTokens     map[string]PasswordResetToken
+	emailVerificationTokens map[string]EmailVerificationToken
+	usedMFATokens           map[string]UsedMFAToken
+	sessions                map[string]Session
+
+	totpLastSteps map[string]int64 // userID -> last used step
+	recoveryCodes map[pair]bool    // (userID, codeHash) -> is used
+
+	loginFailures map[string]LoginFailure
+	loginLockouts map[string]LoginLockout
+
+	exports map[string]Export
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:                   make(map[string]User),
+		statuses:                make(map[string]Status),
+		comments:                make(map[string]Comment),
+		circles:                 make(map[string]Circle),
+		circleUserPairs:         make(map[pair]bool),
+		statusCirclePairs:       make(map[pair]bool),
+		statusLikePairs:         make(map[pair]bool),
+		commentLikePairs:        make(map[pair]bool),
+		refreshTokens:           make(map[string]RefreshToken),
+		passwordResetTokens:     make(map[string]PasswordResetToken),
+		emailVerificationTokens: make(map[string]EmailVerificationToken),
+		usedMFATokens:           make(map[string]UsedMFAToken),
+		sessions:                make(map[string]Session),
+		totpLastSteps:           make(map[string]int64),
+		recoveryCodes:           make(map[pair]bool),
+		loginFailures:           make(map[string]LoginFailure),
+		loginLockouts:           make(map[string]LoginLockout),
+		exports:                 make(map[string]Export),
+	}
+}
+
+// paginate gets end of first page in a list of n items, negative limit meaning no limit
+func paginate(n int, limit int) int {
+	if limit < 0 || limit > n {
+		return n
+	}
+	return limit
+}
+
+// sortStatuses sorts statuses newest first
+func sortStatuses(statuses []Status) {
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].PostedTimestamp.Equal(statuses[j].PostedTimestamp) {
+			return statuses[i].ID > statuses[j].ID
+		}
+		return statuses[i].PostedTimestamp.After(statuses[j].PostedTimestamp)
+	})
+}
+
+// pairedWith gets sorted second columns of pairs whose first column is a
+func pairedWith(pairs map[pair]bool, a string) []string {
+
+	bs := make([]string, 0)
+	for p := range pairs {
+		if p.a == a {
+			bs = append(bs, p.b)
+		}
+	}
+	sort.Strings(bs)
+
+	return bs
+}
+
+// sortComments sorts comments newest first
+func sortComments(comments []Comment) {
+	sort.Slice(comments, func(i, j int) bool {
+		if comments[i].PostedTimestamp.Equal(comments[j].PostedTimestamp) {
+			return comments[i].ID > comments[j].ID
+		}
+		return comments[i].PostedTimestamp.After(comments[j].PostedTimestamp)
+	})
+}
+
+// countPairs counts pairs matching a value in one column
+func countPairs(pairs map[pair]bool, match func(p pair) bool) int {
+	count := 0
+	for p := range pairs {
+		if match(p) {
+			count++
+		}
+	}
+	return count
+}
+
+// countPairsByTarget counts pairs by their second item for the given ids
+func countPairsByTarget(pairs map[pair]bool, ids []string) map[string]int {
+
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	counts := make(map[string]int)
+	for p := range pairs {
+		if wanted[p.b] {
+			counts[p.b]++
+		}
+	}
+
+	return counts
+}
+
+// deletePairs deletes pairs matching a value in one column
+func deletePairs(pairs map[pair]bool, match func(p pair) bool) {
+	for p := range pairs {
+		if match(p) {
+			delete(pairs, p)
+		}
+	}
+}
+
+// Transactions
+
+// memoryTx is the store as seen inside WithTx
+type memoryTx struct {
+	*MemoryStore
+}
+
+// WithTx runs fn in the transaction already open
+func (tx memoryTx) WithTx(fn func(Repository) error) error {
+	return fn(tx)
+}
+
+// WithTx runs fn with a copy of the store, keeping the copy's changes only if fn succeeds
+//
+// The store stays locked while fn runs so nothing else can change it in the meantime. fn must
+// only use the repository it is given, since anything else waits for it to finish.
+func (m *MemoryStore) WithTx(fn func(Repository) error) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := m.copyLocked()
+	if err := fn(memoryTx{tx}); err != nil {
+		return err
+	}
+	m.replaceLocked(tx)
+
+	return nil
+}
+
+// copyLocked copies everything in store
+func (m *MemoryStore) copyLocked() *MemoryStore {
+
+	c := NewMemoryStore()
+	for k, v := range m.users {
+		c.users[k] = v
+	}
+	for k, v := range m.statuses {
+		c.statuses[k] = v
+	}
+	for k, v := range m.comments {
+		c.comments[k] = v
+	}
+	for k, v := range m.circles {
+		c.circles[k] = v
+	}
+	copyPairs(c.circleUserPairs, m.circleUserPairs)
+	copyPairs(c.statusCirclePairs, m.statusCirclePairs)
+	copyPairs(c.statusLikePairs, m.statusLikePairs)
+	copyPairs(c.commentLikePairs, m.commentLikePairs)
+	for k, v := range m.refreshTokens {
+		c.refreshTokens[k] = v
+	}
+	for k, v := range m.passwordResetTokens {
+		c.passwordResetTokens[k] = v
+	}
+	for k, v := range m.emailVerificationTokens {
+		c.emailVerificationTokens[k] = v
+	}
+	for k, v := range m.usedMFATokens {
+		c.usedMFATokens[k] = v
+	}
+	for k, v := range m.sessions {
+		c.sessions[k] = v
+	}
+	for k, v := range m.totpLastSteps {
+		c.totpLastSteps[k] = v
+	}
+	copyPairs(c.recoveryCodes, m.recoveryCodes)
+	for k, v := range m.loginFailures {
+		c.loginFailures[k] = v
+	}
+	for k, v := range m.loginLockouts {
+		c.loginLockouts[k] = v
+	}
+	for k, v := range m.exports {
+		c.exports[k] = v
+	}
+
+	return c
+}
+
+// replaceLocked replaces everything in store with what is in c
+func (m *MemoryStore) replaceLocked(c *MemoryStore) {
+	m.users = c.users
+	m.statuses = c.statuses
+	m.comments = c.comments
+	m.circles = c.circles
+	m.circleUserPairs = c.circleUserPairs
+	m.statusCirclePairs = c.statusCirclePairs
+	m.statusLikePairs = c.statusLikePairs
+	m.commentLikePairs = c.commentLikePairs
+	m.refreshTokens = c.refreshTokens
+	m.passwordResetTokens = c.passwordResetTokens
+	m.emailVerificationTokens = c.emailVerificationTokens
+	m.usedMFATokens = c.usedMFATokens
+	m.sessions = c.sessions
+	m.totpLastSteps = c.totpLastSteps
+	m.recoveryCodes = c.recoveryCodes
+	m.loginFailures = c.loginFailures
+	m.loginLockouts = c.loginLockouts
+	m.exports = c.exports
+}
+
+// copyPairs copies pairs from src to dst
+func copyPairs(dst map[pair]bool, src map[pair]bool) {
+	for p, v := range src {
+		dst[p] = v
+	}
+}
+
+// Users
+
+// InsertUser inserts user
+func (m *MemoryStore) InsertUser(user User) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Username == user.Username {
+			return conflict("User already exists", nil)
+		}
+	}
+	for _, u := range m.users {
+		if len(user.Email) > 0 && u.Email == user.Email {
+			return conflict("Email already in use", nil)
+		}
+	}
+	if _, ok := m.users[user.ID]; ok {
+		return dbError("Error creating user", nil)
+	}
+
+	user.Description = ""
+	user.ProfileImgURL = ""
+	user.IsEmailVerified = false
+	user.TOTPSecret = ""
+	user.IsTOTPEnabled = false
+	user.DeactivatedTimestamp = sql.NullTime{}
+	m.users[user.ID] = user
+
+	return nil
+}
+
+// GetUserByID gets user by id
+func (m *MemoryStore) GetUserByID(userID string) (*User, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, notFound("No user found", nil)
+	}
+
+	return &user, nil
+}
+
+// GetUsersByIDs gets users with the given ids keyed by id
+func (m *MemoryStore) GetUsersByIDs(userIDs []string) (map[string]User, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make(map[string]User)
+	for _, userID := range userIDs {
+		if user, ok := m.users[userID]; ok {
+			users[userID] = user
+		}
+	}
+
+	return users, nil
+}
+
+// GetUserByUsername gets user by username
+func (m *MemoryStore) GetUserByUsername(username string) (*User, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+
+	return nil, notFound("No user found", nil)
+}
+
+// GetUserByEmail gets user by email
+func (m *MemoryStore) GetUserByEmail(email string) (*User, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if len(email) > 0 && user.Email == email {
+			return &user, nil
+		}
+	}
+
+	return nil, notFound("No user found", nil)
+}
+
+// GetDeactivatedUsers gets users deactivated at or before time
+func (m *MemoryStore) GetDeactivatedUsers(before time.Time) ([]User, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]User, 0)
+	for _, user := range m.users {
+		if user.DeactivatedTimestamp.Valid && !user.DeactivatedTimestamp.Time.After(before) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].DeactivatedTimestamp.Time.Before(users[j].DeactivatedTimestamp.Time)
+	})
+
+	return users, nil
+}
+
+// UpdateUser updates user
+//
+// Passwords are only changed through SetUserPassword, two-factor settings through SetUserTOTP
+// and deactivation through DeactivateUser and RestoreUser.
+func (m *MemoryStore) UpdateUser(user User) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.ID != user.ID && u.Username == user.Username {
+			return conflict("User already exists", nil)
+		}
+	}
+	for _, u := range m.users {
+		if u.ID != user.ID && len(user.Email) > 0 && u.Email == user.Email {
+			return conflict("Email already in use", nil)
+		}
+	}
+
+	if existing, ok := m.users[user.ID]; ok {
+		user.PasswordHash = existing.PasswordHash
+		user.DeactivatedTimestamp = existing.DeactivatedTimestamp
+		user.TOTPSecret = existing.TOTPSecret
+		user.IsTOTPEnabled = existing.IsTOTPEnabled
+		m.users[user.ID] = user
+	}
+
+	return nil
+}
+
+// DeactivateUser marks user as deactivated at time
+func (m *MemoryStore) DeactivateUser(userID string, at time.Time) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[userID]; ok {
+		user.DeactivatedTimestamp = sql.NullTime{Time: at, Valid: true}
+		m.users[userID] = user
+	}
+
+	return nil
+}
+
+// RestoreUser clears deactivation of user
+func (m *MemoryStore) RestoreUser(userID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[userID]; ok {
+		user.DeactivatedTimestamp = sql.NullTime{}
+		m.users[userID] = user
+	}
+
+	return nil
+}
+
+// SetUserPassword sets user's password hash
+func (m *MemoryStore) SetUserPassword(userID string, passwordHash string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[userID]; ok {
+		user.PasswordHash = passwordHash
+		m.users[userID] = user
+	}
+
+	return nil
+}
+
+// SetUserTOTP sets user's TOTP secret and whether it is required at login
+func (m *MemoryStore) SetUserTOTP(userID string, secret string, enabled bool) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.users[userID]; ok {
+		user.TOTPSecret = secret
+		user.IsTOTPEnabled = enabled
+		m.users[userID] = user
+		delete(m.totpLastSteps, userID)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records TOTP time step as used
+func (m *MemoryStore) UseTOTPStep(userID string, step int64) (bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok || m.totpLastSteps[userID] >= step {
+		return false, nil
+	}
+	m.totpLastSteps[userID] = step
+
+	return true, nil
+}
+
+// DeleteUserByID deletes user by userID
+//
+// Their statuses go with them, along with reshares of and comments on those statuses.
+// Their comments elsewhere are moved to the placeholder user.
+func (m *MemoryStore) DeleteUserByID(userID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if userID == DeletedUserID {
+		return forbidden("Cannot delete placeholder user", nil)
+	}
+
+	// Threads on statuses go with them
+	statusIDs := make([]string, 0)
+	for _, status := range m.statuses {
+		if status.UserID == userID {
+			statusIDs = append(statusIDs, status.ID)
+		}
+	}
+	closure := m.reshareClosureLocked(statusIDs)
+	for id, comment := range m.comments {
+		if closure[comment.StatusID] {
+			delete(m.comments, id)
+			deletePairs(m.commentLikePairs, func(p pair) bool { return p.b == id })
+		}
+	}
+	m.deleteStatusesLocked(statusIDs)
+
+	// Comments elsewhere are kept under the placeholder
+	if _, ok := m.users[DeletedUserID]; !ok {
+		m.users[DeletedUserID] = User{ID: DeletedUserID, Username: DeletedUsername}
+	}
+	for id, comment := range m.comments {
+		if comment.UserID == userID {
+			comment.UserID = DeletedUserID
+			m.comments[id] = comment
+		}
+	}
+
+	for _, circle := range m.circles {
+		if circle.UserID == userID {
+			m.deleteCircleLocked(circle.ID)
+		}
+	}
+	deletePairs(m.circleUserPairs, func(p pair) bool { return p.a == userID })
+	deletePairs(m.statusLikePairs, func(p pair) bool { return p.a == userID })
+	deletePairs(m.commentLikePairs, func(p pair) bool { return p.a == userID })
+	for id, token := range m.refreshTokens {
+		if token.UserID == userID {
+			delete(m.refreshTokens, id)
+		}
+	}
+	for id, token := range m.passwordResetTokens {
+		if token.UserID == userID {
+			delete(m.passwordResetTokens, id)
+		}
+	}
+	for id, token := range m.emailVerificationTokens {
+		if token.UserID == userID {
+			delete(m.emailVerificationTokens, id)
+		}
+	}
+	for id, token := range m.usedMFATokens {
+		if token.UserID == userID {
+			delete(m.usedMFATokens, id)
+		}
+	}
+	for id, session := range m.sessions {
+		if session.UserID == userID {
+			delete(m.sessions, id)
+		}
+	}
+	deletePairs(m.recoveryCodes, func(p pair) bool { return p.a == userID })
+	delete(m.totpLastSteps, userID)
+	for id, export := range m.exports {
+		if export.UserID == userID {
+			delete(m.exports, id)
+		}
+	}
+	delete(m.users, userID)
+
+	return nil
+}
+
+// Statuses
+
+// circleMembersLocked gets set of users in circles owned by user
+func (m *MemoryStore) circleMembersLocked(ownerID string) map[string]bool {
+
+	members := make(map[string]bool)
+	for p := range m.circleUserPairs {
+		if circle, ok := m.circles[p.b]; ok && circle.UserID == ownerID {
+			members[p.a] = true
+		}
+	}
+
+	return members
+}
+
+// isStatusVisibleLocked checks if status is visible to viewer
+func (m *MemoryStore) isStatusVisibleLocked(status Status, viewerID string) bool {
+
+	if status.Visibility == VisibilityPublic {
+		return true
+	}
+	if len(viewerID) <= 0 {
+		return false
+	}
+	if status.UserID == viewerID {
+		return true
+	}
+
+	switch status.Visibility {
+	case VisibilityCircles:
+		for p := range m.statusCirclePairs {
+			if p.a == status.ID && m.circleUserPairs[pair{viewerID, p.b}] {
+				return true
+			}
+		}
+	case VisibilityExtended:
+		members := m.circleMembersLocked(status.UserID)
+		if members[viewerID] {
+			return true
+		}
+		for member := range members {
+			if m.circleMembersLocked(member)[viewerID] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// GetStatusByID gets status by id
+func (m *MemoryStore) GetStatusByID(statusID string) (*Status, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status, ok := m.statuses[statusID]
+	if !ok {
+		return nil, notFound("No status found", nil)
+	}
+
+	return &status, nil
+}
+
+// GetVisibleStatusByID gets status by id if it is visible to viewer
+func (m *MemoryStore) GetVisibleStatusByID(statusID string, viewerID string) (*Status, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status, ok := m.statuses[statusID]
+	if !ok || !m.isStatusVisibleLocked(status, viewerID) {
+		return nil, notFound("No status found", nil)
+	}
+
+	return &status, nil
+}
+
+// GetVisibleStatusesByIDs gets statuses with the given ids that are visible to viewer keyed by id
+func (m *MemoryStore) GetVisibleStatusesByIDs(statusIDs []string, viewerID string) (map[string]Status, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make(map[string]Status)
+	for _, statusID := range statusIDs {
+		status, ok := m.statuses[statusID]
+		if ok && m.isStatusVisibleLocked(status, viewerID) {
+			statuses[statusID] = status
+		}
+	}
+
+	return statuses, nil
+}
+
+// GetStatusFeed gets page of statuses in feed after cursor, starting from the newest if cursor is nil
+func (m *MemoryStore) GetStatusFeed(userID string, limit int, after *Cursor) ([]Status, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := m.circleMembersLocked(userID)
+
+	statuses := make([]Status, 0)
+	for _, status := range m.statuses {
+		if members[status.UserID] && m.isStatusVisibleLocked(status, userID) && after.isAfter(status.PostedTimestamp, status.ID) {
+			statuses = append(statuses, status)
+		}
+	}
+	sortStatuses(statuses)
+
+	return statuses[:paginate(len(statuses), limit)], nil
+}
+
+// InsertStatus inserts status
+func (m *MemoryStore) InsertStatus(status Status) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.statuses[status.ID]; ok {
+		return dbError("Error creating status", nil)
+	}
+	if _, ok := m.users[status.UserID]; !ok {
+		return dbError("Error creating status", nil)
+	}
+	if status.ResharedStatusID.Valid {
+		if _, ok := m.statuses[status.ResharedStatusID.String]; !ok {
+			return dbError("Error creating status", nil)
+		}
+	}
+	m.statuses[status.ID] = status
+
+	return nil
+}
+
+// UpdateStatus updates status
+func (m *MemoryStore) UpdateStatus(status Status) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.statuses[status.ID]; ok {
+		existing.Content = status.Content
+		existing.PostedTimestamp = status.PostedTimestamp
+		existing.IsEdited = status.IsEdited
+		m.statuses[status.ID] = existing
+	}
+
+	return nil
+}
+
+// reshareClosureLocked gets statuses along with all reshares of them
+func (m *MemoryStore) reshareClosureLocked(statusIDs []string) map[string]bool {
+
+	closure := make(map[string]bool)
+	queue := append([]string{}, statusIDs...)
+	for len(queue) > 0 {
+		statusID := queue[0]
+		queue = queue[1:]
+		if closure[statusID] {
+			continue
+		}
+		closure[statusID] = true
+		for _, status := range m.statuses {
+			if status.ResharedStatusID.Valid && status.ResharedStatusID.String == statusID {
+				queue = append(queue, status.ID)
+			}
+		}
+	}
+
+	return closure
+}
+
+// canDeleteStatusesLocked checks that no comments block deleting statuses
+func (m *MemoryStore) canDeleteStatusesLocked(statusIDs []string) bool {
+
+	closure := m.reshareClosureLocked(statusIDs)
+	for _, comment := range m.comments {
+		if closure[comment.StatusID] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// deleteStatusesLocked deletes statuses and cascades to their reshares
+func (m *MemoryStore) deleteStatusesLocked(statusIDs []string) {
+
+	for statusID := range m.reshareClosureLocked(statusIDs) {
+		delete(m.statuses, statusID)
+		deletePairs(m.statusCirclePairs, func(p pair) bool { return p.a == statusID })
+		deletePairs(m.statusLikePairs, func(p pair) bool { return p.b == statusID })
+	}
+}
+
+// DeleteStatusByID deletes status by statusID
+func (m *MemoryStore) DeleteStatusByID(statusID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.canDeleteStatusesLocked([]string{statusID}) {
+		return conflict("Status has comments", nil)
+	}
+	m.deleteStatusesLocked([]string{statusID})
+
+	return nil
+}
+
+// InsertStatusCirclePair inserts (statusID, circleID) pair for sharing a status with a circle
+func (m *MemoryStore) InsertStatusCirclePair(statusID string, circleID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, statusOK := m.statuses[statusID]
+	_, circleOK := m.circles[circleID]
+	if !statusOK || !circleOK {
+		return dbError("Error inserting status circle pair", nil)
+	}
+
+	m.statusCirclePairs[pair{statusID, circleID}] = true
+
+	return nil
+}
+
+// GetStatusReshares gets reshares of a status that are visible to viewer
+func (m *MemoryStore) GetStatusReshares(statusID string, viewerID string, limit int, after *Cursor) ([]Status, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]Status, 0)
+	for _, status := range m.statuses {
+		if status.ResharedStatusID.Valid && status.ResharedStatusID.String == statusID &&
+			m.isStatusVisibleLocked(status, viewerID) && after.isAfter(status.PostedTimestamp, status.ID) {
+			statuses = append(statuses, status)
+		}
+	}
+	sortStatuses(statuses)
+
+	return statuses[:paginate(len(statuses), limit)], nil
+}
+
+// GetStatusReshareCount gets number of reshares of a status
+func (m *MemoryStore) GetStatusReshareCount(statusID string) (int, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, status := range m.statuses {
+		if status.ResharedStatusID.Valid && status.ResharedStatusID.String == statusID {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// GetStatusReshareCounts gets number of reshares of each status keyed by id
+func (m *MemoryStore) GetStatusReshareCounts(statusIDs []string) (map[string]int, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := make(map[string]bool)
+	for _, statusID := range statusIDs {
+		wanted[statusID] = true
+	}
+
+	counts := make(map[string]int)
+	for _, status := range m.statuses {
+		if status.ResharedStatusID.Valid && wanted[status.ResharedStatusID.String] {
+			counts[status.ResharedStatusID.String]++
+		}
+	}
+
+	return counts, nil
+}
+
+// GetStatusLikes gets number of likes on a status
+func (m *MemoryStore) GetStatusLikes(statusID string) (int, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return countPairs(m.statusLikePairs, func(p pair) bool { return p.b == statusID }), nil
+}
+
+// GetIsUserLikedStatus checks if status was liked by user
+func (m *MemoryStore) GetIsUserLikedStatus(userID string, statusID string) (bool, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.statusLikePairs[pair{userID, statusID}], nil
+}
+
+// GetStatusLikeCounts gets number of likes on each status keyed by id
+func (m *MemoryStore) GetStatusLikeCounts(statusIDs []string) (map[string]int, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return countPairsByTarget(m.statusLikePairs, statusIDs), nil
+}
+
+// GetUserLikedStatuses gets which of the statuses were liked by user
+func (m *MemoryStore) GetUserLikedStatuses(userID string, statusIDs []string) (map[string]bool, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	liked := make(map[string]bool)
+	for _, statusID := range statusIDs {
+		if m.statusLikePairs[pair{userID, statusID}] {
+			liked[statusID] = true
+		}
+	}
+
+	return liked, nil
+}
+
+// InsertStatusLikePair inserts (userID, statusID) pair for liking a status post
+func (m *MemoryStore) InsertStatusLikePair(userID string, statusID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, userOK := m.users[userID]
+	_, statusOK := m.statuses[statusID]
+	if !userOK || !statusOK {
+		return dbError("Error inserting status like pair", nil)
+	}
+
+	m.statusLikePairs[pair{userID, statusID}] = true
+
+	return nil
+}
+
+// DeleteStatusLikePair deletes (userID, statusID) pair for liking a status post
+func (m *MemoryStore) DeleteStatusLikePair(userID string, statusID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.statusLikePairs, pair{userID, statusID})
+
+	return nil
+}
+
+// GetUserStatuses gets every status posted by user, newest first
+func (m *MemoryStore) GetUserStatuses(userID string) ([]Status, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]Status, 0)
+	for _, status := range m.statuses {
+		if status.UserID == userID {
+			statuses = append(statuses, status)
+		}
+	}
+	sortStatuses(statuses)
+
+	return statuses, nil
+}
+
+// GetStatusCircleIDs gets ids of circles statuses are shared with keyed by status id
+func (m *MemoryStore) GetStatusCircleIDs(statusIDs []string) (map[string][]string, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := make(map[string]bool)
+	for _, statusID := range statusIDs {
+		wanted[statusID] = true
+	}
+
+	circleIDs := make(map[string][]string)
+	for p := range m.statusCirclePairs {
+		if wanted[p.a] {
+			circleIDs[p.a] = append(circleIDs[p.a], p.b)
+		}
+	}
+	for _, ids := range circleIDs {
+		sort.Strings(ids)
+	}
+
+	return circleIDs, nil
+}
+
+// GetUserStatusLikes gets ids of every status liked by user
+func (m *MemoryStore) GetUserStatusLikes(userID string) ([]string, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return pairedWith(m.statusLikePairs, userID), nil
+}
+
+// Comments
+
+// GetCommentByID gets comment by id
+func (m *MemoryStore) GetCommentByID(commentID string) (*Comment, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	comment, ok := m.comments[commentID]
+	if !ok {
+		return nil, notFound("No comment found", nil)
+	}
+
+	return &comment, nil
+}
+
+// GetCommentsFromStatus gets page of comments under a status after cursor, starting from the newest if cursor is nil
+func (m *MemoryStore) GetCommentsFromStatus(statusID string, limit int, after *Cursor) ([]Comment, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	comments := make([]Comment, 0)
+	for _, comment := range m.comments {
+		if comment.StatusID == statusID && after.isAfter(comment.PostedTimestamp, comment.ID) {
+			comments = append(comments, comment)
+		}
+	}
+	sortComments(comments)
+
+	return comments[:paginate(len(comments), limit)], nil
+}
+
+// InsertComment inserts comment
+func (m *MemoryStore) InsertComment(comment Comment) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.comments[comment.ID]
+	_, userOK := m.users[comment.UserID]
+	_, statusOK := m.statuses[comment.StatusID]
+	parentOK := true
+	if comment.ParentCommentID.Valid {
+		_, parentOK = m.comments[comment.ParentCommentID.String]
+	}
+	if exists || !userOK || !statusOK || !parentOK {
+		return dbError("Error creating comment", nil)
+	}
+
+	m.comments[comment.ID] = comment
+
+	return nil
+}
+
+// UpdateComment updates comment
+func (m *MemoryStore) UpdateComment(comment Comment) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.comments[comment.ID]; ok {
+		existing.Content = comment.Content
+		existing.PostedTimestamp = comment.PostedTimestamp
+		existing.IsEdited = comment.IsEdited
+		existing.IsDeleted = comment.IsDeleted
+		m.comments[comment.ID] = existing
+	}
+
+	return nil
+}
+
+// DeleteCommentByID deletes comment by commentID
+func (m *MemoryStore) DeleteCommentByID(commentID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Replies do not cascade with their parent
+	for _, comment := range m.comments {
+		if comment.ParentCommentID.Valid && comment.ParentCommentID.String == commentID {
+			return conflict("Comment has replies", nil)
+		}
+	}
+
+	delete(m.comments, commentID)
+	deletePairs(m.commentLikePairs, func(p pair) bool { return p.b == commentID })
+
+	return nil
+}
+
+// GetCommentReplies gets replies for a comment
+func (m *MemoryStore) GetCommentReplies(commentID string) ([]Comment, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	comments := make([]Comment, 0)
+	for _, comment := range m.comments {
+		if comment.ParentCommentID.Valid && comment.ParentCommentID.String == commentID {
+			comments = append(comments, comment)
+		}
+	}
+	sortComments(comments)
+
+	return comments, nil
+}
+
+// GetCommentSubtree gets comment followed by its replies down to depth levels
+func (m *MemoryStore) GetCommentSubtree(commentID string, depth int, limit int, after *Cursor) ([]Comment, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	root, ok := m.comments[commentID]
+	if !ok {
+		return nil, notFound("No comment found", nil)
+	}
+
+	comments := []Comment{root}
+	level := []Comment{root}
+	for d := 0; d < depth && len(level) > 0; d++ {
+
+		next := make([]Comment, 0)
+		for _, parent := range level {
+
+			replies := make([]Comment, 0)
+			for _, comment := range m.comments {
+				if !comment.ParentCommentID.Valid || comment.ParentCommentID.String != parent.ID {
+					continue
+				}
+				if d == 0 && !after.isAfter(comment.PostedTimestamp, comment.ID) {
+					continue
+				}
+				replies = append(replies, comment)
+			}
+			sortComments(replies)
+
+			next = append(next, replies[:paginate(len(replies), limit)]...)
+		}
+
+		sortComments(next)
+		comments = append(comments, next...)
+		level = next
+	}
+
+	return comments, nil
+}
+
+// GetCommentReplyCount gets number of replies to a comment
+func (m *MemoryStore) GetCommentReplyCount(commentID string) (int, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, comment := range m.comments {
+		if comment.ParentCommentID.Valid && comment.ParentCommentID.String == commentID {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// GetCommentLikes gets number of likes on a comment
+func (m *MemoryStore) GetCommentLikes(commentID string) (int, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return countPairs(m.commentLikePairs, func(p pair) bool { return p.b == commentID }), nil
+}
+
+// GetCommentLikeCounts gets number of likes on each comment keyed by id
+func (m *MemoryStore) GetCommentLikeCounts(commentIDs []string) (map[string]int, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return countPairsByTarget(m.commentLikePairs, commentIDs), nil
+}
+
+// GetIsUserLikedComment checks if comment was liked by user
+func (m *MemoryStore) GetIsUserLikedComment(userID string, commentID string) (bool, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.commentLikePairs[pair{userID, commentID}], nil
+}
+
+// GetUserLikedComments gets which of the comments were liked by user
+func (m *MemoryStore) GetUserLikedComments(userID string, commentIDs []string) (map[string]bool, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	liked := make(map[string]bool)
+	for _, commentID := range commentIDs {
+		if m.commentLikePairs[pair{userID, commentID}] {
+			liked[commentID] = true
+		}
+	}
+
+	return liked, nil
+}
+
+// InsertCommentLikePair inserts (userID, commentID) pair for liking a comment
+func (m *MemoryStore) InsertCommentLikePair(userID string, commentID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, userOK := m.users[userID]
+	_, commentOK := m.comments[commentID]
+	if !userOK || !commentOK {
+		return dbError("Error inserting comment like pair", nil)
+	}
+
+	m.commentLikePairs[pair{userID, commentID}] = true
+
+	return nil
+}
+
+// DeleteCommentLikePair deletes (userID, commentID) pair for liking a comment
+func (m *MemoryStore) DeleteCommentLikePair(userID string, commentID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.commentLikePairs, pair{userID, commentID})
+
+	return nil
+}
+
+// GetUserComments gets every comment posted by user that was not deleted, newest first
+func (m *MemoryStore) GetUserComments(userID string) ([]Comment, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	comments := make([]Comment, 0)
+	for _, comment := range m.comments {
+		if comment.UserID == userID && !comment.IsDeleted {
+			comments = append(comments, comment)
+		}
+	}
+	sortComments(comments)
+
+	return comments, nil
+}
+
+// GetUserCommentLikes gets ids of every comment liked by user
+func (m *MemoryStore) GetUserCommentLikes(userID string) ([]string, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return pairedWith(m.commentLikePairs, userID), nil
+}
+
+// Circles
+
+// GetCircleByID gets circle by id
+func (m *MemoryStore) GetCircleByID(circleID string) (*Circle, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	circle, ok := m.circles[circleID]
+	if !ok {
+		return nil, notFound("No circle found", nil)
+	}
+
+	return &circle, nil
+}
+
+// InsertCircle inserts social circle
+func (m *MemoryStore) InsertCircle(circle Circle) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, exists := m.circles[circle.ID]
+	_, userOK := m.users[circle.UserID]
+	if exists || !userOK {
+		return dbError("Error creating circle", nil)
+	}
+
+	m.circles[circle.ID] = circle
+
+	return nil
+}
+
+// UpdateCircle updates circle
+func (m *MemoryStore) UpdateCircle(circle Circle) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.circles[circle.ID]; ok {
+		existing.Name = circle.Name
+		existing.Description = circle.Description
+		m.circles[circle.ID] = existing
+	}
+
+	return nil
+}
+
+// deleteCircleLocked deletes circle and cascades to its pairs
+func (m *MemoryStore) deleteCircleLocked(circleID string) {
+
+	delete(m.circles, circleID)
+	deletePairs(m.circleUserPairs, func(p pair) bool { return p.b == circleID })
+	deletePairs(m.statusCirclePairs, func(p pair) bool { return p.b == circleID })
+}
+
+// DeleteCircleByID deletes circle by circleID
+func (m *MemoryStore) DeleteCircleByID(circleID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteCircleLocked(circleID)
+
+	return nil
+}
+
+// GetIsInCircle checks if user is in circle
+func (m *MemoryStore) GetIsInCircle(userID string, circleID string) (bool, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.circleUserPairs[pair{userID, circleID}], nil
+}
+
+// InsertCircleUserPair inserts (userID, circleID) pair for adding user to social circle
+func (m *MemoryStore) InsertCircleUserPair(userID string, circleID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, userOK := m.users[userID]
+	_, circleOK := m.circles[circleID]
+	if !userOK || !circleOK {
+		return dbError("Error inserting user circle pair", nil)
+	}
+
+	m.circleUserPairs[pair{userID, circleID}] = true
+
+	return nil
+}
+
+// DeleteCircleUserPair deletes (userID, circleID) pair
+func (m *MemoryStore) DeleteCircleUserPair(userID string, circleID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.circleUserPairs, pair{userID, circleID})
+
+	return nil
+}
+
+// GetCircleUserCount gets the number of users in a circle
+func (m *MemoryStore) GetCircleUserCount(circleID string) (int, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return countPairs(m.circleUserPairs, func(p pair) bool { return p.b == circleID }), nil
+}
+
+// GetUserCircles gets every circle owned by user ordered by name
+func (m *MemoryStore) GetUserCircles(userID string) ([]Circle, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	circles := make([]Circle, 0)
+	for _, circle := range m.circles {
+		if circle.UserID == userID {
+			circles = append(circles, circle)
+		}
+	}
+	sort.Slice(circles, func(i, j int) bool {
+		if circles[i].Name == circles[j].Name {
+			return circles[i].ID < circles[j].ID
+		}
+		return circles[i].Name < circles[j].Name
+	})
+
+	return circles, nil
+}
+
+// GetCircleUserIDs gets ids of users in circle
+func (m *MemoryStore) GetCircleUserIDs(circleID string) ([]string, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	userIDs := make([]string, 0)
+	for p := range m.circleUserPairs {
+		if p.b == circleID {
+			userIDs = append(userIDs, p.a)
+		}
+	}
+	sort.Strings(userIDs)
+
+	return userIDs, nil
+}
+
+// Tokens
+
+// InsertRefreshToken inserts refresh token
+func (m *MemoryStore) InsertRefreshToken(token RefreshToken) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[token.UserID]; !ok {
+		return dbError("Error inserting refresh token", nil)
+	}
+	if _, ok := m.refreshTokens[token.ID]; ok {
+		return dbError("Error inserting refresh token", nil)
+	}
+	for _, other := range m.refreshTokens {
+		if other.TokenHash == token.TokenHash {
+			return dbError("Error inserting refresh token", nil)
+		}
+	}
+
+	m.refreshTokens[token.ID] = token
+
+	return nil
+}
+
+// GetRefreshTokenByHash gets refresh token by hash
+func (m *MemoryStore) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, token := range m.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+
+	return nil, notFound("No refresh token found", nil)
+}
+
+// UseRefreshToken marks refresh token as used
+func (m *MemoryStore) UseRefreshToken(tokenID string) (bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.refreshTokens[tokenID]
+	if !ok || token.IsUsed {
+		return false, nil
+	}
+
+	token.IsUsed = true
+	m.refreshTokens[tokenID] = token
+
+	return true, nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token in a family
+func (m *MemoryStore) RevokeRefreshTokenFamily(familyID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, token := range m.refreshTokens {
+		if token.FamilyID == familyID {
+			token.IsRevoked = true
+			m.refreshTokens[id] = token
+		}
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token belonging to user
+func (m *MemoryStore) RevokeUserRefreshTokens(userID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, token := range m.refreshTokens {
+		if token.UserID == userID {
+			token.IsRevoked = true
+			m.refreshTokens[id] = token
+		}
+	}
+
+	return nil
+}
+
+// InsertPasswordResetToken inserts password reset token
+func (m *MemoryStore) InsertPasswordResetToken(token PasswordResetToken) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[token.UserID]; !ok {
+		return dbError("Error inserting password reset token", nil)
+	}
+	if _, ok := m.passwordResetTokens[token.ID]; ok {
+		return dbError("Error inserting password reset token", nil)
+	}
+	for _, other := range m.passwordResetTokens {
+		if other.TokenHash == token.TokenHash {
+			return dbError("Error inserting password reset token", nil)
+		}
+	}
+
+	m.passwordResetTokens[token.ID] = token
+
+	return nil
+}
+
+// GetPasswordResetTokenByHash gets password reset token by hash
+func (m *MemoryStore) GetPasswordResetTokenByHash(tokenHash string) (*PasswordResetToken, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, token := range m.passwordResetTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+
+	return nil, notFound("No password reset token found", nil)
+}
+
+// UsePasswordResetToken marks password reset token as used
+func (m *MemoryStore) UsePasswordResetToken(tokenID string) (bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.passwordResetTokens[tokenID]
+	if !ok || token.IsUsed {
+		return false, nil
+	}
+
+	token.IsUsed = true
+	m.passwordResetTokens[tokenID] = token
+
+	return true, nil
+}
+
+// DeleteUserPasswordResetTokens deletes every password reset token belonging to user
+func (m *MemoryStore) DeleteUserPasswordResetTokens(userID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, token := range m.passwordResetTokens {
+		if token.UserID == userID {
+			delete(m.passwordResetTokens, id)
+		}
+	}
+
+	return nil
+}
+
+// InsertEmailVerificationToken inserts email verification token
+func (m *MemoryStore) InsertEmailVerificationToken(token EmailVerificationToken) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[token.UserID]; !ok {
+		return dbError("Error inserting email verification token", nil)
+	}
+	if _, ok := m.emailVerificationTokens[token.ID]; ok {
+		return dbError("Error inserting email verification token", nil)
+	}
+	for _, other := range m.emailVerificationTokens {
+		if other.TokenHash == token.TokenHash {
+			return dbError("Error inserting email verification token", nil)
+		}
+	}
+
+	m.emailVerificationTokens[token.ID] = token
+
+	return nil
+}
+
+// GetEmailVerificationTokenByHash gets email verification token by hash
+func (m *MemoryStore) GetEmailVerificationTokenByHash(tokenHash string) (*EmailVerificationToken, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, token := range m.emailVerificationTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+
+	return nil, notFound("No email verification token found", nil)
+}
+
+// DeleteUserEmailVerificationTokens deletes every email verification token belonging to user
+func (m *MemoryStore) DeleteUserEmailVerificationTokens(userID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, token := range m.emailVerificationTokens {
+		if token.UserID == userID {
+			delete(m.emailVerificationTokens, id)
+		}
+	}
+
+	return nil
+}
+
+// UseMFAToken records MFA token as used
+func (m *MemoryStore) UseMFAToken(token UsedMFAToken) (bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[token.UserID]; !ok {
+		return false, dbError("Error using MFA token", nil)
+	}
+	if _, ok := m.usedMFATokens[token.ID]; ok {
+		return false, nil
+	}
+	m.usedMFATokens[token.ID] = token
+
+	return true, nil
+}
+
+// DeleteExpiredMFATokens deletes used MFA tokens that expired at or before time, returning how many were deleted
+func (m *MemoryStore) DeleteExpiredMFATokens(before time.Time) (int, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for id, token := range m.usedMFATokens {
+		if !token.ExpiresTimestamp.After(before) {
+			delete(m.usedMFATokens, id)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Sessions
+
+// InsertSession inserts session
+func (m *MemoryStore) InsertSession(session Session) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[session.UserID]; !ok {
+		return dbError("Error inserting session", nil)
+	}
+	if _, ok := m.sessions[session.ID]; ok {
+		return dbError("Error inserting session", nil)
+	}
+
+	m.sessions[session.ID] = session
+
+	return nil
+}
+
+// GetSessionByID gets session by id
+func (m *MemoryStore) GetSessionByID(sessionID string) (*Session, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, notFound("No session found", nil)
+	}
+
+	return &session, nil
+}
+
+// GetUserSessions gets sessions of user, most recently seen first
+func (m *MemoryStore) GetUserSessions(userID string) ([]Session, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := make([]Session, 0)
+	for _, session := range m.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastSeenTimestamp.Equal(sessions[j].LastSeenTimestamp) {
+			return sessions[i].ID > sessions[j].ID
+		}
+		return sessions[i].LastSeenTimestamp.After(sessions[j].LastSeenTimestamp)
+	})
+
+	return sessions, nil
+}
+
+// TouchSession records session was seen from ip address
+func (m *MemoryStore) TouchSession(sessionID string, ipAddress string, lastSeen time.Time) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, ok := m.sessions[sessionID]; ok {
+		session.IPAddress = ipAddress
+		session.LastSeenTimestamp = lastSeen
+		m.sessions[sessionID] = session
+	}
+
+	return nil
+}
+
+// DeleteSessionByID deletes session by id
+func (m *MemoryStore) DeleteSessionByID(sessionID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, sessionID)
+
+	return nil
+}
+
+// DeleteUserSessions deletes all sessions of user
+func (m *MemoryStore) DeleteUserSessions(userID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, session := range m.sessions {
+		if session.UserID == userID {
+			delete(m.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+// DeleteExpiredSessions deletes sessions expired at time, returning how many were deleted
+func (m *MemoryStore) DeleteExpiredSessions(now time.Time) (int, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for id, session := range m.sessions {
+		if session.IsExpired(now) {
+			delete(m.sessions, id)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Recovery codes
+
+// ReplaceRecoveryCodes replaces user's two-factor recovery codes
+func (m *MemoryStore) ReplaceRecoveryCodes(userID string, codeHashes []string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return dbError("Error replacing recovery codes", nil)
+	}
+
+	deletePairs(m.recoveryCodes, func(p pair) bool { return p.a == userID })
+	for _, codeHash := range codeHashes {
+		m.recoveryCodes[pair{userID, codeHash}] = false
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks user's recovery code as used
+func (m *MemoryStore) UseRecoveryCode(userID string, codeHash string) (bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := pair{userID, codeHash}
+	if used, ok := m.recoveryCodes[p]; !ok || used {
+		return false, nil
+	}
+	m.recoveryCodes[p] = true
+
+	return true, nil
+}
+
+// GetRecoveryCodeCount gets number of unused recovery codes user has left
+func (m *MemoryStore) GetRecoveryCodeCount(userID string) (int, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for p, used := range m.recoveryCodes {
+		if p.a == userID && !used {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// DeleteUserRecoveryCodes deletes all of user's recovery codes
+func (m *MemoryStore) DeleteUserRecoveryCodes(userID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deletePairs(m.recoveryCodes, func(p pair) bool { return p.a == userID })
+
+	return nil
+}
+
+// Login throttling
+
+// GetLoginFailure gets failed logins of throttle key
+func (m *MemoryStore) GetLoginFailure(key string) (*LoginFailure, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	failure, ok := m.loginFailures[key]
+	if !ok {
+		return nil, notFound("No login failure found", nil)
+	}
+
+	return &failure, nil
+}
+
+// RecordLoginFailure counts failed login against throttle key and returns the new count
+func (m *MemoryStore) RecordLoginFailure(key string, now time.Time, resetBefore time.Time) (int, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	failure, ok := m.loginFailures[key]
+	if !ok {
+		failure = LoginFailure{Key: key, LockedUntilTimestamp: time.Unix(0, 0)}
+	}
+	if failure.LastFailureTimestamp.Before(resetBefore) {
+		failure.FailureCount = 0
+	}
+	failure.FailureCount++
+	failure.LastFailureTimestamp = now
+	m.loginFailures[key] = failure
+
+	return failure.FailureCount, nil
+}
+
+// LockLogin locks out throttle key until lockout expires and records lockout for auditing
+func (m *MemoryStore) LockLogin(lockout LoginLockout) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.loginLockouts[lockout.ID]; ok {
+		return dbError("Error locking login", nil)
+	}
+
+	if failure, ok := m.loginFailures[lockout.Key]; ok {
+		failure.FailureCount = 0
+		failure.LockedUntilTimestamp = lockout.ExpiresTimestamp
+		m.loginFailures[lockout.Key] = failure
+	}
+	m.loginLockouts[lockout.ID] = lockout
+
+	return nil
+}
+
+// DeleteLoginFailure clears failed logins of throttle key
+func (m *MemoryStore) DeleteLoginFailure(key string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.loginFailures, key)
+
+	return nil
+}
+
+// DeleteStaleLoginFailures deletes failed logins last seen and locked out until at or before time,
+// returning how many were deleted
+func (m *MemoryStore) DeleteStaleLoginFailures(before time.Time) (int, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for key, failure := range m.loginFailures {
+		if !failure.LastFailureTimestamp.After(before) && !failure.LockedUntilTimestamp.After(before) {
+			delete(m.loginFailures, key)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// GetLoginLockouts gets lockouts created since time, newest first
+func (m *MemoryStore) GetLoginLockouts(since time.Time) ([]LoginLockout, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lockouts := make([]LoginLockout, 0)
+	for _, lockout := range m.loginLockouts {
+		if !lockout.CreatedTimestamp.Before(since) {
+			lockouts = append(lockouts, lockout)
+		}
+	}
+	sort.Slice(lockouts, func(i, j int) bool {
+		if !lockouts[i].CreatedTimestamp.Equal(lockouts[j].CreatedTimestamp) {
+			return lockouts[i].CreatedTimestamp.After(lockouts[j].CreatedTimestamp)
+		}
+		return lockouts[i].ID > lockouts[j].ID
+	})
+
+	return lockouts, nil
+}
+
+// Exports
+
+// InsertExport inserts export
+//
+// Fails with a conflict if export is pending while user already has a pending export.
+func (m *MemoryStore) InsertExport(export Export) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[export.UserID]; !ok {
+		return dbError("Error inserting export", nil)
+	}
+	if _, ok := m.exports[export.ID]; ok {
+		return dbError("Error inserting export", nil)
+	}
+	if export.State == ExportPending {
+		for _, other := range m.exports {
+			if other.UserID == export.UserID && other.State == ExportPending {
+				return conflict("Export already in progress", nil)
+			}
+		}
+	}
+	m.exports[export.ID] = export
+
+	return nil
+}
+
+// GetExportByID gets export by id
+func (m *MemoryStore) GetExportByID(exportID string) (*Export, error) {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	export, ok := m.exports[exportID]
+	if !ok {
+		return nil, notFound("No export found", nil)
+	}
+
+	return &export, nil
+}
+
+// FinishExport sets final state of export and its archive if it was built
+func (m *MemoryStore) FinishExport(exportID string, state string, archive []byte) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if export, ok := m.exports[exportID]; ok {
+		export.State = state
+		export.Archive = archive
+		m.exports[exportID] = export
+	}
+
+	return nil
+}
+
+// FailStaleExports fails exports still pending that were created at or before time, returning how
+// many were failed
+func (m *MemoryStore) FailStaleExports(before time.Time) (int, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for id, export := range m.exports {
+		if export.State == ExportPending && !export.CreatedTimestamp.After(before) {
+			export.State = ExportFailed
+			m.exports[id] = export
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// DeleteExpiredExports deletes exports that expired at or before time, returning how many were deleted
+func (m *MemoryStore) DeleteExpiredExports(before time.Time) (int, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for id, export := range m.exports {
+		if !export.ExpiresTimestamp.After(before) {
+			delete(m.exports, id)
+			count++
+		}
+	}
+
+	return count, nil
+}
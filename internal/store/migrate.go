@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock key held while migrating
+const migrationLockID = 4378215
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration and when it was applied
+type MigrationStatus struct {
+	Migration
+	AppliedAt sql.NullTime
+}
+
+// LoadMigrations loads embedded migrations ordered by version
+func LoadMigrations() ([]Migration, error) {
+
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+
+		res := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if res == nil {
+			return nil, fmt.Errorf("Invalid migration file name %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(res[1])
+		content, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: res[2]}
+			byVersion[version] = m
+		} else if m.Name != res[2] {
+			return nil, fmt.Errorf("Conflicting names for migration %d", version)
+		}
+
+		if res[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if len(m.Up) == 0 || len(m.Down) == 0 {
+			return nil, fmt.Errorf("Migration %d must have up and down files", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// withMigrationLock runs fn on a connection holding the migration lock
+//
+// Advisory locks belong to a session so everything runs on one connection.
+func (s *Store) withMigrationLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+
+	ctx := context.Background()
+	conn, err := s.pool.Conn(ctx)
+	if err != nil {
+		return errors.New("Error with database")
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return errors.New("Error acquiring migration lock")
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	_, err = conn.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`,
+	)
+	if err != nil {
+		return errors.New("Error creating migrations table")
+	}
+
+	return fn(ctx, conn)
+}
+
+// getAppliedMigrations gets applied migration versions and when they were applied
+func getAppliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, errors.New("Error retrieving migrations")
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, errors.New("Error retrieving migrations")
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, nil
+}
+
+// runMigration runs migration script and records it in one transaction
+func runMigration(ctx context.Context, conn *sql.Conn, script string, record string, args ...interface{}) error {
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MigrateUp applies all pending migrations and returns those applied
+func (s *Store) MigrateUp() ([]Migration, error) {
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]Migration, 0)
+	err = s.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+
+		done, err := getAppliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			err := runMigration(ctx, conn, m.Up,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+				m.Version, m.Name, time.Now(),
+			)
+			if err != nil {
+				return fmt.Errorf("Error applying migration %04d_%s: %v", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// MigrateDown reverts the given number of most recently applied migrations and returns those reverted
+func (s *Store) MigrateDown(steps int) ([]Migration, error) {
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := make([]Migration, 0)
+	err = s.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+
+		done, err := getAppliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := migrations[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			err := runMigration(ctx, conn, m.Down,
+				"DELETE FROM schema_migrations WHERE version=$1",
+				m.Version,
+			)
+			if err != nil {
+				return fmt.Errorf("Error reverting migration %04d_%s: %v", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// GetMigrationStatus gets all migrations and whether they have been applied
+func (s *Store) GetMigrationStatus() ([]MigrationStatus, error) {
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	err = s.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+
+		done, err := getAppliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i, m := range migrations {
+			appliedAt, ok := done[m.Version]
+			statuses[i] = MigrationStatus{
+				Migration: m,
+				AppliedAt: sql.NullTime{Time: appliedAt, Valid: ok},
+			}
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
@@ -0,0 +1,69 @@
+package store_test
+
+import (
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+func TestLoadMigrations(t *testing.T) {
+
+	migrations, err := store.LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.NotEmpty(t, migrations) {
+		assert.Equal(t, 1, migrations[0].Version)
+	}
+	for i, m := range migrations {
+		if i > 0 {
+			assert.Less(t, migrations[i-1].Version, m.Version)
+		}
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+}
+
+func TestMigrateUpAppliesPending(t *testing.T) {
+
+	// Setup db
+	s := store.Store{}
+	mock := s.OpenMock()
+	defer s.Close()
+
+	migrations, err := store.LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec("SELECT pg_advisory_lock").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, baseTime))
+	for _, m := range migrations[1:] {
+		mock.ExpectBegin()
+		mock.ExpectExec(".+").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO schema_migrations").
+			WithArgs(m.Version, m.Name, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+	mock.ExpectExec("SELECT pg_advisory_unlock").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := s.MigrateUp()
+
+	if assert.NoError(t, err) {
+		assert.Len(t, applied, len(migrations)-1)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS comment_like_pairs;
+DROP TABLE IF EXISTS status_like_pairs;
+DROP TABLE IF EXISTS circle_user_pairs;
+DROP TABLE IF EXISTS circles;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS statuses;
+DROP TABLE IF EXISTS users;
@@ -1,6 +1,8 @@
-CREATE DATABASE galt;
+-- Tables exactly as created by the original db/init.sql. IF NOT EXISTS lets databases
+-- bootstrapped from that script adopt migrations without recreating tables, so later
+-- changes to these tables belong in later migrations.
 
-CREATE TABLE users (
+CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY NOT NULL,
     username VARCHAR(255) NOT NULL,
     password VARCHAR(255) NOT NULL,
@@ -8,7 +10,7 @@ CREATE TABLE users (
     profile_img_url VARCHAR(255) NOT NULL
 );
 
-CREATE TABLE statuses (
+CREATE TABLE IF NOT EXISTS statuses (
     id UUID PRIMARY KEY NOT NULL,
     user_id UUID NOT NULL,
     content VARCHAR(255) NOT NULL,
@@ -17,12 +19,12 @@ CREATE TABLE statuses (
     FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
-CREATE TABLE comments (
+CREATE TABLE IF NOT EXISTS comments (
     id UUID PRIMARY KEY NOT NULL,
     user_id UUID NOT NULL,
     status_id UUID NOT NULL,
     parent_comment_id UUID,
-    content VARCHAR(255) NOT NULL, 
+    content VARCHAR(255) NOT NULL,
     posted_timestamp TIMESTAMP NOT NULL,
     is_edited BOOLEAN NOT NULL,
     FOREIGN KEY(user_id) REFERENCES users(id),
@@ -30,7 +32,7 @@ CREATE TABLE comments (
     FOREIGN KEY(parent_comment_id) REFERENCES comments(id)
 );
 
-CREATE TABLE circles (
+CREATE TABLE IF NOT EXISTS circles (
     id UUID PRIMARY KEY NOT NULL,
     user_id UUID NOT NULL,
     name VARCHAR(255) NOT NULL,
@@ -38,23 +40,23 @@ CREATE TABLE circles (
     FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
-CREATE TABLE circle_user_pairs (
+CREATE TABLE IF NOT EXISTS circle_user_pairs (
     user_id UUID NOT NULL,
     circle_id UUID NOT NULL,
     FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY(circle_id) REFERENCES circles(id) ON DELETE CASCADE
 );
 
-CREATE TABLE status_like_pairs (
+CREATE TABLE IF NOT EXISTS status_like_pairs (
     user_id UUID NOT NULL,
     status_id UUID NOT NULL,
     FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY(status_id) REFERENCES statuses(id) ON DELETE CASCADE
 );
 
-CREATE TABLE comment_like_pairs (
+CREATE TABLE IF NOT EXISTS comment_like_pairs (
     user_id UUID NOT NULL,
     comment_id UUID NOT NULL,
     FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY(comment_id) REFERENCES comments(id) ON DELETE CASCADE
-);
\ No newline at end of file
+);
@@ -0,0 +1,19 @@
+DROP INDEX IF EXISTS comment_like_pairs_user_id_idx;
+DROP INDEX IF EXISTS comment_like_pairs_comment_id_user_id_idx;
+DROP INDEX IF EXISTS status_like_pairs_user_id_idx;
+DROP INDEX IF EXISTS status_like_pairs_status_id_user_id_idx;
+DROP INDEX IF EXISTS status_circle_pairs_circle_id_idx;
+DROP INDEX IF EXISTS status_circle_pairs_status_id_circle_id_idx;
+DROP INDEX IF EXISTS circle_user_pairs_user_id_idx;
+DROP INDEX IF EXISTS circle_user_pairs_circle_id_user_id_idx;
+DROP INDEX IF EXISTS circles_user_id_idx;
+DROP INDEX IF EXISTS comments_user_id_idx;
+DROP INDEX IF EXISTS comments_parent_comment_id_idx;
+DROP INDEX IF EXISTS comments_status_id_posted_timestamp_idx;
+DROP INDEX IF EXISTS statuses_reshared_status_id_idx;
+DROP INDEX IF EXISTS statuses_user_id_posted_timestamp_idx;
+DROP INDEX IF EXISTS users_username_idx;
+
+DROP TABLE IF EXISTS status_circle_pairs;
+ALTER TABLE statuses DROP COLUMN IF EXISTS reshared_status_id;
+ALTER TABLE statuses DROP COLUMN IF EXISTS visibility;
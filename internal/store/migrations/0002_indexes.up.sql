@@ -0,0 +1,54 @@
+-- Status audiences and reshares were added after the original db/init.sql. IF NOT EXISTS
+-- leaves databases bootstrapped from a later version of that script unchanged.
+ALTER TABLE statuses ADD COLUMN IF NOT EXISTS visibility VARCHAR(16) NOT NULL DEFAULT 'public';
+ALTER TABLE statuses ADD COLUMN IF NOT EXISTS reshared_status_id UUID REFERENCES statuses(id) ON DELETE CASCADE;
+
+CREATE TABLE IF NOT EXISTS status_circle_pairs (
+    status_id UUID NOT NULL,
+    circle_id UUID NOT NULL,
+    FOREIGN KEY(status_id) REFERENCES statuses(id) ON DELETE CASCADE,
+    FOREIGN KEY(circle_id) REFERENCES circles(id) ON DELETE CASCADE
+);
+
+-- The original schema had no unique constraints, so duplicates are cleared before the unique
+-- indexes below are created. Users sharing a username keep their accounts, with every one but
+-- the first by id renamed after its id.
+UPDATE users SET username = username || '_' || replace(id::text, '-', '')
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY username ORDER BY id) AS n FROM users
+    ) ranked
+    WHERE n > 1
+);
+
+DELETE FROM circle_user_pairs a USING circle_user_pairs b
+WHERE a.ctid > b.ctid AND a.circle_id = b.circle_id AND a.user_id = b.user_id;
+DELETE FROM status_circle_pairs a USING status_circle_pairs b
+WHERE a.ctid > b.ctid AND a.status_id = b.status_id AND a.circle_id = b.circle_id;
+DELETE FROM status_like_pairs a USING status_like_pairs b
+WHERE a.ctid > b.ctid AND a.status_id = b.status_id AND a.user_id = b.user_id;
+DELETE FROM comment_like_pairs a USING comment_like_pairs b
+WHERE a.ctid > b.ctid AND a.comment_id = b.comment_id AND a.user_id = b.user_id;
+
+CREATE UNIQUE INDEX users_username_idx ON users(username);
+
+CREATE INDEX statuses_user_id_posted_timestamp_idx ON statuses(user_id, posted_timestamp DESC);
+CREATE INDEX statuses_reshared_status_id_idx ON statuses(reshared_status_id);
+
+CREATE INDEX comments_status_id_posted_timestamp_idx ON comments(status_id, posted_timestamp DESC);
+CREATE INDEX comments_parent_comment_id_idx ON comments(parent_comment_id);
+CREATE INDEX comments_user_id_idx ON comments(user_id);
+
+CREATE INDEX circles_user_id_idx ON circles(user_id);
+
+CREATE UNIQUE INDEX circle_user_pairs_circle_id_user_id_idx ON circle_user_pairs(circle_id, user_id);
+CREATE INDEX circle_user_pairs_user_id_idx ON circle_user_pairs(user_id);
+
+CREATE UNIQUE INDEX status_circle_pairs_status_id_circle_id_idx ON status_circle_pairs(status_id, circle_id);
+CREATE INDEX status_circle_pairs_circle_id_idx ON status_circle_pairs(circle_id);
+
+CREATE UNIQUE INDEX status_like_pairs_status_id_user_id_idx ON status_like_pairs(status_id, user_id);
+CREATE INDEX status_like_pairs_user_id_idx ON status_like_pairs(user_id);
+
+CREATE UNIQUE INDEX comment_like_pairs_comment_id_user_id_idx ON comment_like_pairs(comment_id, user_id);
+CREATE INDEX comment_like_pairs_user_id_idx ON comment_like_pairs(user_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS statuses_user_id_posted_timestamp_idx;
+CREATE INDEX statuses_user_id_posted_timestamp_id_idx ON statuses(user_id, posted_timestamp DESC, id DESC);
+
+DROP INDEX IF EXISTS comments_status_id_posted_timestamp_idx;
+CREATE INDEX comments_status_id_posted_timestamp_id_idx ON comments(status_id, posted_timestamp DESC, id DESC);
@@ -0,0 +1,15 @@
+CREATE TABLE refresh_tokens (
+    id UUID PRIMARY KEY NOT NULL,
+    user_id UUID NOT NULL,
+    family_id UUID NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    created_timestamp TIMESTAMP NOT NULL,
+    expires_timestamp TIMESTAMP NOT NULL,
+    is_used BOOLEAN NOT NULL DEFAULT FALSE,
+    is_revoked BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX refresh_tokens_token_hash_idx ON refresh_tokens(token_hash);
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens(family_id);
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens(user_id);
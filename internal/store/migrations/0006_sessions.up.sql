@@ -0,0 +1,12 @@
+-- Sessions share ids with the refresh token family started at login
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY NOT NULL,
+    user_id UUID NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    created_timestamp TIMESTAMP NOT NULL,
+    last_seen_timestamp TIMESTAMP NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions(user_id);
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN email VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE password_reset_tokens (
+    id UUID PRIMARY KEY NOT NULL,
+    user_id UUID NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    created_timestamp TIMESTAMP NOT NULL,
+    expires_timestamp TIMESTAMP NOT NULL,
+    is_used BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX password_reset_tokens_token_hash_idx ON password_reset_tokens(token_hash);
+CREATE INDEX password_reset_tokens_user_id_idx ON password_reset_tokens(user_id);
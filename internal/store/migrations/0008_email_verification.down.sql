@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS email_verification_tokens;
+DROP INDEX IF EXISTS users_email_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS is_email_verified;
@@ -0,0 +1,25 @@
+ALTER TABLE users ADD COLUMN is_email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Emails are compared lowercase and only the oldest account keeps a duplicate
+UPDATE users SET email=LOWER(email);
+UPDATE users SET email='' WHERE id IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY email ORDER BY id) AS n
+        FROM users WHERE email<>''
+    ) AS duplicates WHERE n > 1
+);
+
+CREATE UNIQUE INDEX users_email_idx ON users(email) WHERE email<>'';
+
+CREATE TABLE email_verification_tokens (
+    id UUID PRIMARY KEY NOT NULL,
+    user_id UUID NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    created_timestamp TIMESTAMP NOT NULL,
+    expires_timestamp TIMESTAMP NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX email_verification_tokens_token_hash_idx ON email_verification_tokens(token_hash);
+CREATE INDEX email_verification_tokens_user_id_idx ON email_verification_tokens(user_id);
@@ -0,0 +1,19 @@
+-- Keys are not tied to users so guesses against unknown usernames are counted too
+CREATE TABLE login_failures (
+    throttle_key VARCHAR(320) PRIMARY KEY NOT NULL,
+    failure_count INTEGER NOT NULL,
+    last_failure_timestamp TIMESTAMP NOT NULL,
+    locked_until_timestamp TIMESTAMP NOT NULL
+);
+
+CREATE TABLE login_lockouts (
+    id UUID PRIMARY KEY NOT NULL,
+    throttle_key VARCHAR(320) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(64) NOT NULL,
+    failure_count INTEGER NOT NULL,
+    created_timestamp TIMESTAMP NOT NULL,
+    expires_timestamp TIMESTAMP NOT NULL
+);
+
+CREATE INDEX login_lockouts_created_timestamp_idx ON login_lockouts(created_timestamp);
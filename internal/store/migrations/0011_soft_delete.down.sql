@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_deactivated_timestamp_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS deactivated_timestamp;
@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN deactivated_timestamp TIMESTAMP;
+
+CREATE INDEX users_deactivated_timestamp_idx ON users(deactivated_timestamp) WHERE deactivated_timestamp IS NOT NULL;
+
+-- Placeholder that comments of deleted users are moved to
+INSERT INTO users (id, username, password, description, profile_img_url, email)
+VALUES ('00000000-0000-0000-0000-000000000000', '[deleted]', '', '', '', '')
+ON CONFLICT DO NOTHING;
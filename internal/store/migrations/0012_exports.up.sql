@@ -0,0 +1,15 @@
+CREATE TABLE exports (
+    id UUID PRIMARY KEY NOT NULL,
+    user_id UUID NOT NULL,
+    state VARCHAR(16) NOT NULL,
+    archive BYTEA,
+    created_timestamp TIMESTAMP NOT NULL,
+    expires_timestamp TIMESTAMP NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX exports_user_id_idx ON exports(user_id);
+CREATE INDEX exports_expires_timestamp_idx ON exports(expires_timestamp);
+
+-- Users can only build one export at a time
+CREATE UNIQUE INDEX exports_user_id_pending_idx ON exports(user_id) WHERE state='pending';
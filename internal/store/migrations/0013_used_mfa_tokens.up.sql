@@ -0,0 +1,9 @@
+-- MFA tokens are stateless JWTs so the ones already used to log in are remembered until they expire
+CREATE TABLE used_mfa_tokens (
+    id UUID PRIMARY KEY NOT NULL,
+    user_id UUID NOT NULL,
+    expires_timestamp TIMESTAMP NOT NULL,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX used_mfa_tokens_expires_timestamp_idx ON used_mfa_tokens(expires_timestamp);
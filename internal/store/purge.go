@@ -0,0 +1,96 @@
+package store
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// staleExportAge is how long an export can stay pending before its build is assumed lost
+	staleExportAge = time.Hour
+
+	// staleLoginFailureAge is how long failed logins are kept once their lockout is over, well past
+	// the window they are counted in
+	staleLoginFailureAge = 24 * time.Hour
+)
+
+// PurgeDeactivatedUsers deletes users deactivated at or before time, returning how many were deleted
+//
+// Users that fail to delete are logged and skipped so one cannot hold up the rest.
+func PurgeDeactivatedUsers(s UserRepository, before time.Time) (int, error) {
+
+	users, err := s.GetDeactivatedUsers(before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		if err := s.DeleteUserByID(user.ID); err != nil {
+			log.Printf("Error purging user %s: %v", user.ID, err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// RunPurge purges users whose grace period has passed, expired exports, sessions and used MFA tokens,
+// and stale login failures every interval until stop is closed
+//
+// Exports left pending too long are failed so their user can request another.
+func RunPurge(s Repository, interval time.Duration, gracePeriod time.Duration, stop <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			purged, err := PurgeDeactivatedUsers(s, time.Now().Add(-gracePeriod))
+			if err != nil {
+				log.Printf("Error purging users: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d deactivated users", purged)
+			}
+
+			stale, err := s.FailStaleExports(time.Now().Add(-staleExportAge))
+			if err != nil {
+				log.Printf("Error failing stale exports: %v", err)
+			} else if stale > 0 {
+				log.Printf("Failed %d stale exports", stale)
+			}
+
+			expired, err := s.DeleteExpiredExports(time.Now())
+			if err != nil {
+				log.Printf("Error purging exports: %v", err)
+			} else if expired > 0 {
+				log.Printf("Purged %d expired exports", expired)
+			}
+
+			expired, err = s.DeleteExpiredSessions(time.Now())
+			if err != nil {
+				log.Printf("Error purging sessions: %v", err)
+			} else if expired > 0 {
+				log.Printf("Purged %d expired sessions", expired)
+			}
+
+			expired, err = s.DeleteExpiredMFATokens(time.Now())
+			if err != nil {
+				log.Printf("Error purging MFA tokens: %v", err)
+			} else if expired > 0 {
+				log.Printf("Purged %d used MFA tokens", expired)
+			}
+
+			stale, err = s.DeleteStaleLoginFailures(time.Now().Add(-staleLoginFailureAge))
+			if err != nil {
+				log.Printf("Error purging login failures: %v", err)
+			} else if stale > 0 {
+				log.Printf("Purged %d stale login failures", stale)
+			}
+		}
+	}
+}
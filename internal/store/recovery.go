@@ -0,0 +1,79 @@
+package store
+
+import "github.com/google/uuid"
+
+// ReplaceRecoveryCodes replaces user's two-factor recovery codes
+func (s *Store) ReplaceRecoveryCodes(userID string, codeHashes []string) error {
+
+	tx, err := s.begin()
+	if err != nil {
+		return dbError("Error with database", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id=$1", userID)
+	if err != nil {
+		return dbError("Error replacing recovery codes", err)
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec(
+			"INSERT INTO recovery_codes (id, user_id, code_hash, is_used) VALUES ($1, $2, $3, FALSE)",
+			uuid.New().String(), userID, codeHash,
+		)
+		if err != nil {
+			return dbError("Error replacing recovery codes", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError("Error replacing recovery codes", err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks user's recovery code as used
+//
+// Returns false if the user has no such unused code.
+func (s *Store) UseRecoveryCode(userID string, codeHash string) (bool, error) {
+
+	res, err := s.db.Exec(
+		"UPDATE recovery_codes SET is_used=TRUE WHERE user_id=$1 AND code_hash=$2 AND is_used=FALSE",
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, dbError("Error updating recovery code", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, dbError("Error updating recovery code", err)
+	}
+
+	return count > 0, nil
+}
+
+// GetRecoveryCodeCount gets number of unused recovery codes user has left
+func (s *Store) GetRecoveryCodeCount(userID string) (int, error) {
+
+	row := s.db.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id=$1 AND is_used=FALSE", userID)
+
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, dbError("Error with database", err)
+	}
+
+	return count, nil
+}
+
+// DeleteUserRecoveryCodes deletes all of user's recovery codes
+func (s *Store) DeleteUserRecoveryCodes(userID string) error {
+
+	_, err := s.db.Exec("DELETE FROM recovery_codes WHERE user_id=$1", userID)
+	if err != nil {
+		return dbError("Error deleting recovery codes", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package store
+
+import "time"
+
+// Repository persists users, statuses, comments, circles, likes, tokens, sessions, recovery codes,
+// login throttling and exports
+type Repository interface {
+	UserRepository
+	StatusRepository
+	CommentRepository
+	CircleRepository
+	TokenRepository
+	SessionRepository
+	RecoveryCodeRepository
+	LoginThrottleRepository
+	ExportRepository
+
+	WithTx(fn func(Repository) error) error
+}
+
+// UserRepository persists users
+type UserRepository interface {
+	InsertUser(user User) error
+	GetUserByID(userID string) (*User, error)
+	GetUsersByIDs(userIDs []string) (map[string]User, error)
+	GetUserByUsername(username string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+	GetDeactivatedUsers(before time.Time) ([]User, error)
+	UpdateUser(user User) error
+	DeleteUserByID(userID string) error
+
+	DeactivateUser(userID string, at time.Time) error
+	RestoreUser(userID string) error
+
+	SetUserPassword(userID string, passwordHash string) error
+	SetUserTOTP(userID string, secret string, enabled bool) error
+	UseTOTPStep(userID string, step int64) (bool, error)
+}
+
+// StatusRepository persists statuses, their audiences, reshares and likes
+type StatusRepository interface {
+	GetStatusByID(statusID string) (*Status, error)
+	GetVisibleStatusByID(statusID string, viewerID string) (*Status, error)
+	GetVisibleStatusesByIDs(statusIDs []string, viewerID string) (map[string]Status, error)
+	GetStatusFeed(userID string, limit int, after *Cursor) ([]Status, error)
+	GetUserStatuses(userID string) ([]Status, error)
+	InsertStatus(status Status) error
+	UpdateStatus(status Status) error
+	DeleteStatusByID(statusID string) error
+	InsertStatusCirclePair(statusID string, circleID string) error
+	GetStatusCircleIDs(statusIDs []string) (map[string][]string, error)
+
+	GetStatusReshares(statusID string, viewerID string, limit int, after *Cursor) ([]Status, error)
+	GetStatusReshareCount(statusID string) (int, error)
+	GetStatusReshareCounts(statusIDs []string) (map[string]int, error)
+
+	GetStatusLikes(statusID string) (int, error)
+	GetStatusLikeCounts(statusIDs []string) (map[string]int, error)
+	GetIsUserLikedStatus(userID string, statusID string) (bool, error)
+	GetUserLikedStatuses(userID string, statusIDs []string) (map[string]bool, error)
+	GetUserStatusLikes(userID string) ([]string, error)
+	InsertStatusLikePair(userID string, statusID string) error
+	DeleteStatusLikePair(userID string, statusID string) error
+}
+
+// CommentRepository persists comments and their likes
+type CommentRepository interface {
+	GetCommentByID(commentID string) (*Comment, error)
+	GetCommentsFromStatus(statusID string, limit int, after *Cursor) ([]Comment, error)
+	GetUserComments(userID string) ([]Comment, error)
+	InsertComment(comment Comment) error
+	UpdateComment(comment Comment) error
+	DeleteCommentByID(commentID string) error
+	GetCommentReplies(commentID string) ([]Comment, error)
+	GetCommentSubtree(commentID string, depth int, limit int, after *Cursor) ([]Comment, error)
+	GetCommentReplyCount(commentID string) (int, error)
+
+	GetCommentLikes(commentID string) (int, error)
+	GetCommentLikeCounts(commentIDs []string) (map[string]int, error)
+	GetIsUserLikedComment(userID string, commentID string) (bool, error)
+	GetUserLikedComments(userID string, commentIDs []string) (map[string]bool, error)
+	GetUserCommentLikes(userID string) ([]string, error)
+	InsertCommentLikePair(userID string, commentID string) error
+	DeleteCommentLikePair(userID string, commentID string) error
+}
+
+// CircleRepository persists circles and their members
+type CircleRepository interface {
+	GetCircleByID(circleID string) (*Circle, error)
+	GetUserCircles(userID string) ([]Circle, error)
+	InsertCircle(circle Circle) error
+	UpdateCircle(circle Circle) error
+	DeleteCircleByID(circleID string) error
+	GetIsInCircle(userID string, circleID string) (bool, error)
+	InsertCircleUserPair(userID string, circleID string) error
+	DeleteCircleUserPair(userID string, circleID string) error
+	GetCircleUserCount(circleID string) (int, error)
+	GetCircleUserIDs(circleID string) ([]string, error)
+}
+
+// TokenRepository persists refresh, password reset and email verification tokens
+type TokenRepository interface {
+	InsertRefreshToken(token RefreshToken) error
+	GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error)
+	UseRefreshToken(tokenID string) (bool, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeUserRefreshTokens(userID string) error
+
+	InsertPasswordResetToken(token PasswordResetToken) error
+	GetPasswordResetTokenByHash(tokenHash string) (*PasswordResetToken, error)
+	UsePasswordResetToken(tokenID string) (bool, error)
+	DeleteUserPasswordResetTokens(userID string) error
+
+	InsertEmailVerificationToken(token EmailVerificationToken) error
+	GetEmailVerificationTokenByHash(tokenHash string) (*EmailVerificationToken, error)
+	DeleteUserEmailVerificationTokens(userID string) error
+
+	UseMFAToken(token UsedMFAToken) (bool, error)
+	DeleteExpiredMFATokens(before time.Time) (int, error)
+}
+
+// SessionRepository persists login sessions
+type SessionRepository interface {
+	InsertSession(session Session) error
+	GetSessionByID(sessionID string) (*Session, error)
+	GetUserSessions(userID string) ([]Session, error)
+	TouchSession(sessionID string, ipAddress string, lastSeen time.Time) error
+	DeleteSessionByID(sessionID string) error
+	DeleteUserSessions(userID string) error
+	DeleteExpiredSessions(now time.Time) (int, error)
+}
+
+// RecoveryCodeRepository persists two-factor recovery codes
+type RecoveryCodeRepository interface {
+	ReplaceRecoveryCodes(userID string, codeHashes []string) error
+	UseRecoveryCode(userID string, codeHash string) (bool, error)
+	GetRecoveryCodeCount(userID string) (int, error)
+	DeleteUserRecoveryCodes(userID string) error
+}
+
+// LoginThrottleRepository persists failed logins and lockouts
+type LoginThrottleRepository interface {
+	GetLoginFailure(key string) (*LoginFailure, error)
+	RecordLoginFailure(key string, now time.Time, resetBefore time.Time) (int, error)
+	LockLogin(lockout LoginLockout) error
+	DeleteLoginFailure(key string) error
+	DeleteStaleLoginFailures(before time.Time) (int, error)
+	GetLoginLockouts(since time.Time) ([]LoginLockout, error)
+}
+
+// ExportRepository persists exports of user data
+type ExportRepository interface {
+	InsertExport(export Export) error
+	GetExportByID(exportID string) (*Export, error)
+	FinishExport(exportID string, state string, archive []byte) error
+	FailStaleExports(before time.Time) (int, error)
+	DeleteExpiredExports(before time.Time) (int, error)
+}
+
+var (
+	_ Repository = (*Store)(nil)
+	_ Repository = (*MemoryStore)(nil)
+)
@@ -0,0 +1,1305 @@
+package store_test
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// Fixture ids are UUIDs so the suite also runs against Postgres
+const (
+	aliceID = "00000000-0000-0000-0000-00000000000a"
+	bobID   = "00000000-0000-0000-0000-00000000000b"
+	carolID = "00000000-0000-0000-0000-00000000000c"
+	daveID  = "00000000-0000-0000-0000-00000000000d"
+
+	status1ID = "00000000-0000-0000-0001-000000000001"
+	status2ID = "00000000-0000-0000-0001-000000000002"
+	status3ID = "00000000-0000-0000-0001-000000000003"
+
+	comment1ID = "00000000-0000-0000-0002-000000000001"
+	comment2ID = "00000000-0000-0000-0002-000000000002"
+	comment3ID = "00000000-0000-0000-0002-000000000003"
+
+	circle1ID = "00000000-0000-0000-0003-000000000001"
+	circle2ID = "00000000-0000-0000-0003-000000000002"
+)
+
+var baseTime = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	testRepository(t, func(t *testing.T) store.Repository {
+		return store.NewMemoryStore()
+	})
+}
+
+func TestMemoryStoreTxKeepsOtherWrites(t *testing.T) {
+
+	s := store.NewMemoryStore()
+	mustInsertUsers(t, s, aliceID)
+
+	// Write started while a transaction runs waits for it instead of being rolled back with it
+	done := make(chan error)
+	err := s.WithTx(func(tx store.Repository) error {
+		go func() {
+			done <- s.InsertUser(store.User{ID: bobID, Username: "bob", PasswordHash: "hash"})
+		}()
+		time.Sleep(10 * time.Millisecond)
+		mustInsertStatus(t, tx, status1ID, aliceID, store.VisibilityPublic, 0)
+		return errors.New("failed")
+	})
+	assert.Error(t, err)
+	assert.NoError(t, <-done)
+
+	_, err = s.GetUserByID(bobID)
+	assert.NoError(t, err)
+	_, err = s.GetStatusByID(status1ID)
+	assertKind(t, err, store.ErrNotFound)
+}
+
+func TestPostgresStoreConformance(t *testing.T) {
+
+	connStr := os.Getenv("TEST_DATABASE_URL")
+	if len(connStr) == 0 {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	migrator := &store.Store{}
+	migrator.OpenURL(connStr)
+	_, err := migrator.MigrateUp()
+	migrator.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testRepository(t, func(t *testing.T) store.Repository {
+
+		// Start every test from empty tables
+		db, err := sql.Open("postgres", connStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		_, err = db.Exec(`TRUNCATE users, statuses, status_circle_pairs, status_like_pairs,
+			comments, comment_like_pairs, circles, circle_user_pairs, refresh_tokens, password_reset_tokens,
+			email_verification_tokens, used_mfa_tokens, sessions, recovery_codes, login_failures, login_lockouts, exports CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := &store.Store{}
+		s.OpenURL(connStr)
+		t.Cleanup(s.Close)
+
+		return s
+	})
+}
+
+// assertKind checks err is a store error of kind
+func assertKind(t *testing.T, err error, kind error) {
+	t.Helper()
+	assert.True(t, errors.Is(err, kind), "expected %v error, got %v", kind, err)
+}
+
+// testRepository runs the shared conformance suite against fresh repositories
+func testRepository(t *testing.T, newRepo func(t *testing.T) store.Repository) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, newRepo(t)) })
+	t.Run("Statuses", func(t *testing.T) { testStatuses(t, newRepo(t)) })
+	t.Run("StatusLikes", func(t *testing.T) { testStatusLikes(t, newRepo(t)) })
+	t.Run("Visibility", func(t *testing.T) { testVisibility(t, newRepo(t)) })
+	t.Run("Feed", func(t *testing.T) { testFeed(t, newRepo(t)) })
+	t.Run("Reshares", func(t *testing.T) { testReshares(t, newRepo(t)) })
+	t.Run("Comments", func(t *testing.T) { testComments(t, newRepo(t)) })
+	t.Run("CommentSubtree", func(t *testing.T) { testCommentSubtree(t, newRepo(t)) })
+	t.Run("BatchLookups", func(t *testing.T) { testBatchLookups(t, newRepo(t)) })
+	t.Run("CommentLikes", func(t *testing.T) { testCommentLikes(t, newRepo(t)) })
+	t.Run("Circles", func(t *testing.T) { testCircles(t, newRepo(t)) })
+	t.Run("Constraints", func(t *testing.T) { testConstraints(t, newRepo(t)) })
+	t.Run("Deactivation", func(t *testing.T) { testDeactivation(t, newRepo(t)) })
+	t.Run("RefreshTokens", func(t *testing.T) { testRefreshTokens(t, newRepo(t)) })
+	t.Run("PasswordResetTokens", func(t *testing.T) { testPasswordResetTokens(t, newRepo(t)) })
+	t.Run("EmailVerificationTokens", func(t *testing.T) { testEmailVerificationTokens(t, newRepo(t)) })
+	t.Run("MFATokens", func(t *testing.T) { testMFATokens(t, newRepo(t)) })
+	t.Run("Sessions", func(t *testing.T) { testSessions(t, newRepo(t)) })
+	t.Run("TOTP", func(t *testing.T) { testTOTP(t, newRepo(t)) })
+	t.Run("LoginThrottle", func(t *testing.T) { testLoginThrottle(t, newRepo(t)) })
+	t.Run("UserData", func(t *testing.T) { testUserData(t, newRepo(t)) })
+	t.Run("Exports", func(t *testing.T) { testExports(t, newRepo(t)) })
+	t.Run("Transactions", func(t *testing.T) { testTransactions(t, newRepo(t)) })
+}
+
+// mustInsertUsers inserts users with the given ids
+func mustInsertUsers(t *testing.T, s store.Repository, userIDs ...string) {
+	for _, userID := range userIDs {
+		err := s.InsertUser(store.User{ID: userID, Username: "user-" + userID, PasswordHash: "hash"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// mustInsertStatus inserts status posted minutes after base time
+func mustInsertStatus(t *testing.T, s store.Repository, statusID string, userID string, visibility string, minutes int) store.Status {
+
+	status := store.Status{
+		ID:              statusID,
+		UserID:          userID,
+		Content:         "content " + statusID,
+		PostedTimestamp: baseTime.Add(time.Duration(minutes) * time.Minute),
+		Visibility:      visibility,
+	}
+	if err := s.InsertStatus(status); err != nil {
+		t.Fatal(err)
+	}
+
+	return status
+}
+
+// mustInsertComment inserts comment posted minutes after base time
+func mustInsertComment(t *testing.T, s store.Repository, commentID string, userID string, statusID string, parentID string, minutes int) store.Comment {
+
+	comment := store.Comment{
+		ID:              commentID,
+		UserID:          userID,
+		StatusID:        statusID,
+		ParentCommentID: sql.NullString{String: parentID, Valid: len(parentID) > 0},
+		Content:         "content " + commentID,
+		PostedTimestamp: baseTime.Add(time.Duration(minutes) * time.Minute),
+	}
+	if err := s.InsertComment(comment); err != nil {
+		t.Fatal(err)
+	}
+
+	return comment
+}
+
+// mustInsertCircle inserts circle with members
+func mustInsertCircle(t *testing.T, s store.Repository, circleID string, userID string, memberIDs ...string) {
+
+	err := s.InsertCircle(store.Circle{ID: circleID, UserID: userID, Name: "circle", Description: ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, memberID := range memberIDs {
+		if err := s.InsertCircleUserPair(memberID, circleID); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// statusIDs gets ids of statuses
+func statusIDs(statuses []store.Status) []string {
+	ids := make([]string, len(statuses))
+	for i, status := range statuses {
+		ids[i] = status.ID
+	}
+	return ids
+}
+
+// commentIDs gets ids of comments
+func commentIDs(comments []store.Comment) []string {
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	return ids
+}
+
+func testUsers(t *testing.T, s store.Repository) {
+
+	user := store.User{ID: aliceID, Username: "alice", PasswordHash: "hash"}
+	assert.NoError(t, s.InsertUser(user))
+	assertKind(t, s.InsertUser(store.User{ID: bobID, Username: "alice", PasswordHash: "hash"}), store.ErrConflict)
+
+	got, err := s.GetUserByID(aliceID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user, *got)
+	}
+	got, err = s.GetUserByUsername("alice")
+	if assert.NoError(t, err) {
+		assert.Equal(t, aliceID, got.ID)
+	}
+	_, err = s.GetUserByID(bobID)
+	assertKind(t, err, store.ErrNotFound)
+	_, err = s.GetUserByUsername("bob")
+	assertKind(t, err, store.ErrNotFound)
+	_, err = s.GetUserByID("not-a-uuid")
+	assertKind(t, err, store.ErrNotFound)
+
+	user.Username = "alice2"
+	user.Description = "hello"
+	user.ProfileImgURL = "alice.png"
+	user.Email = "alice@example.com"
+	user.IsEmailVerified = true
+	assert.NoError(t, s.UpdateUser(user))
+	got, err = s.GetUserByID(aliceID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user, *got)
+	}
+
+	// Password hash is only changed on its own
+	stale := user
+	stale.PasswordHash = "stale"
+	assert.NoError(t, s.UpdateUser(stale))
+	got, _ = s.GetUserByID(aliceID)
+	assert.Equal(t, user.PasswordHash, got.PasswordHash)
+	assert.NoError(t, s.SetUserPassword(aliceID, "newhash"))
+	got, _ = s.GetUserByID(aliceID)
+	assert.Equal(t, "newhash", got.PasswordHash)
+	user.PasswordHash = "newhash"
+	got, err = s.GetUserByEmail("alice@example.com")
+	if assert.NoError(t, err) {
+		assert.Equal(t, aliceID, got.ID)
+	}
+	_, err = s.GetUserByEmail("")
+	assert.Error(t, err)
+
+	// Emails are unique but many users can have none
+	assertKind(t, s.InsertUser(store.User{ID: bobID, Username: "bob", PasswordHash: "hash", Email: "alice@example.com"}), store.ErrConflict)
+	assert.NoError(t, s.InsertUser(store.User{ID: bobID, Username: "bob", PasswordHash: "hash"}))
+	assert.NoError(t, s.InsertUser(store.User{ID: carolID, Username: "carol", PasswordHash: "hash"}))
+	bob, err := s.GetUserByID(bobID)
+	if assert.NoError(t, err) {
+		bob.Email = "alice@example.com"
+		err = s.UpdateUser(*bob)
+		assertKind(t, err, store.ErrConflict)
+		assert.EqualError(t, err, "Email already in use")
+		bob.Email = "bob@example.com"
+		assert.NoError(t, s.UpdateUser(*bob))
+
+		// So are usernames
+		bob.Username = "alice2"
+		err = s.UpdateUser(*bob)
+		assertKind(t, err, store.ErrConflict)
+		assert.EqualError(t, err, "User already exists")
+		got, _ = s.GetUserByID(bobID)
+		assert.Equal(t, "bob", got.Username)
+	}
+
+	assert.NoError(t, s.DeleteUserByID(aliceID))
+	_, err = s.GetUserByID(aliceID)
+	assert.Error(t, err)
+}
+
+func testStatuses(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID)
+	status := mustInsertStatus(t, s, status1ID, aliceID, store.VisibilityPublic, 0)
+
+	got, err := s.GetStatusByID(status1ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, status.Content, got.Content)
+		assert.Equal(t, status.UserID, got.UserID)
+		assert.Equal(t, status.Visibility, got.Visibility)
+		assert.True(t, status.PostedTimestamp.Equal(got.PostedTimestamp))
+		assert.False(t, got.IsEdited)
+		assert.False(t, got.ResharedStatusID.Valid)
+	}
+	_, err = s.GetStatusByID(status2ID)
+	assert.Error(t, err)
+
+	status.Content = "edited"
+	status.IsEdited = true
+	status.PostedTimestamp = baseTime.Add(time.Hour)
+	assert.NoError(t, s.UpdateStatus(status))
+	got, err = s.GetStatusByID(status1ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "edited", got.Content)
+		assert.True(t, got.IsEdited)
+		assert.True(t, status.PostedTimestamp.Equal(got.PostedTimestamp))
+	}
+
+	assert.NoError(t, s.DeleteStatusByID(status1ID))
+	_, err = s.GetStatusByID(status1ID)
+	assert.Error(t, err)
+}
+
+func testStatusLikes(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID)
+	mustInsertStatus(t, s, status1ID, aliceID, store.VisibilityPublic, 0)
+
+	assert.NoError(t, s.InsertStatusLikePair(bobID, status1ID))
+	assert.NoError(t, s.InsertStatusLikePair(bobID, status1ID))
+	assert.NoError(t, s.InsertStatusLikePair(aliceID, status1ID))
+
+	count, err := s.GetStatusLikes(status1ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	isLiked, err := s.GetIsUserLikedStatus(bobID, status1ID)
+	assert.NoError(t, err)
+	assert.True(t, isLiked)
+
+	assert.NoError(t, s.DeleteStatusLikePair(bobID, status1ID))
+	count, _ = s.GetStatusLikes(status1ID)
+	assert.Equal(t, 1, count)
+	isLiked, _ = s.GetIsUserLikedStatus(bobID, status1ID)
+	assert.False(t, isLiked)
+}
+
+func testVisibility(t *testing.T, s store.Repository) {
+
+	// alice has bob in a circle, bob has carol in a circle, dave is a stranger
+	mustInsertUsers(t, s, aliceID, bobID, carolID, daveID)
+	mustInsertCircle(t, s, circle1ID, aliceID, bobID)
+	mustInsertCircle(t, s, circle2ID, bobID, carolID)
+
+	cases := []struct {
+		visibility string
+		viewers    map[string]bool
+	}{
+		{store.VisibilityPublic, map[string]bool{"": true, aliceID: true, bobID: true, carolID: true, daveID: true}},
+		{store.VisibilityCircles, map[string]bool{"": false, aliceID: true, bobID: true, carolID: false, daveID: false}},
+		{store.VisibilityExtended, map[string]bool{"": false, aliceID: true, bobID: true, carolID: true, daveID: false}},
+		{store.VisibilityPrivate, map[string]bool{"": false, aliceID: true, bobID: false, carolID: false, daveID: false}},
+	}
+
+	for _, c := range cases {
+		s.DeleteStatusByID(status1ID)
+		mustInsertStatus(t, s, status1ID, aliceID, c.visibility, 0)
+		if c.visibility == store.VisibilityCircles {
+			assert.NoError(t, s.InsertStatusCirclePair(status1ID, circle1ID))
+		}
+
+		for viewerID, visible := range c.viewers {
+			_, err := s.GetVisibleStatusByID(status1ID, viewerID)
+			assert.Equal(t, visible, err == nil, "visibility %s for viewer %q", c.visibility, viewerID)
+		}
+	}
+}
+
+func testFeed(t *testing.T, s store.Repository) {
+
+	// bob follows alice and carol
+	mustInsertUsers(t, s, aliceID, bobID, carolID, daveID)
+	mustInsertCircle(t, s, circle1ID, bobID, aliceID, carolID)
+	mustInsertStatus(t, s, status1ID, aliceID, store.VisibilityPublic, 0)
+	mustInsertStatus(t, s, status2ID, carolID, store.VisibilityPublic, 2)
+	mustInsertStatus(t, s, status3ID, aliceID, store.VisibilityPrivate, 1)
+	mustInsertStatus(t, s, "00000000-0000-0000-0001-000000000004", daveID, store.VisibilityPublic, 3)
+	tied := mustInsertStatus(t, s, "00000000-0000-0000-0001-000000000005", aliceID, store.VisibilityPublic, 2)
+
+	feed, err := s.GetStatusFeed(bobID, 30, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tied.ID, status2ID, status1ID}, statusIDs(feed))
+
+	// Pages continue after cursor and break timestamp ties by id
+	feed, err = s.GetStatusFeed(bobID, 1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tied.ID}, statusIDs(feed))
+	feed, err = s.GetStatusFeed(bobID, 1, &store.Cursor{PostedTimestamp: tied.PostedTimestamp, ID: tied.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{status2ID}, statusIDs(feed))
+	feed, err = s.GetStatusFeed(bobID, 30, &store.Cursor{PostedTimestamp: feed[0].PostedTimestamp, ID: feed[0].ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{status1ID}, statusIDs(feed))
+
+	feed, err = s.GetStatusFeed(daveID, 30, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, feed)
+}
+
+func testReshares(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID, carolID)
+	mustInsertStatus(t, s, status1ID, aliceID, store.VisibilityPublic, 0)
+
+	reshare := store.Status{
+		ID:               status2ID,
+		UserID:           bobID,
+		Content:          "look",
+		PostedTimestamp:  baseTime.Add(time.Minute),
+		Visibility:       store.VisibilityPublic,
+		ResharedStatusID: sql.NullString{String: status1ID, Valid: true},
+	}
+	assert.NoError(t, s.InsertStatus(reshare))
+	reshare.ID = status3ID
+	reshare.UserID = carolID
+	reshare.Visibility = store.VisibilityPrivate
+	assert.NoError(t, s.InsertStatus(reshare))
+
+	got, err := s.GetStatusByID(status2ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, sql.NullString{String: status1ID, Valid: true}, got.ResharedStatusID)
+	}
+
+	count, err := s.GetStatusReshareCount(status1ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	reshares, err := s.GetStatusReshares(status1ID, aliceID, 30, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{status2ID}, statusIDs(reshares))
+	reshares, err = s.GetStatusReshares(status1ID, carolID, 30, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{status3ID, status2ID}, statusIDs(reshares))
+
+	// Pages continue after cursor
+	reshares, err = s.GetStatusReshares(status1ID, carolID, 1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{status3ID}, statusIDs(reshares))
+	cursor := &store.Cursor{PostedTimestamp: reshares[0].PostedTimestamp, ID: reshares[0].ID}
+	reshares, err = s.GetStatusReshares(status1ID, carolID, 1, cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{status2ID}, statusIDs(reshares))
+
+	// Reshares are deleted with the original
+	assert.NoError(t, s.DeleteStatusByID(status1ID))
+	_, err = s.GetStatusByID(status2ID)
+	assert.Error(t, err)
+}
+
+func testCommentSubtree(t *testing.T, s store.Repository) {
+
+	// comment1 has replies comment2 and comment3, comment3 has replies comment4 and comment5
+	comment4ID := "00000000-0000-0000-0002-000000000004"
+	comment5ID := "00000000-0000-0000-0002-000000000005"
+	mustInsertUsers(t, s, aliceID, bobID)
+	mustInsertStatus(t, s, status1ID, aliceID, store.VisibilityPublic, 0)
+	mustInsertComment(t, s, comment1ID, bobID, status1ID, "", 1)
+	mustInsertComment(t, s, comment2ID, aliceID, status1ID, comment1ID, 2)
+	comment3 := mustInsertComment(t, s, comment3ID, bobID, status1ID, comment1ID, 3)
+	mustInsertComment(t, s, comment4ID, aliceID, status1ID, comment3ID, 4)
+	mustInsertComment(t, s, comment5ID, aliceID, status1ID, comment3ID, 5)
+
+	subtree, err := s.GetCommentSubtree(comment1ID, 3, 10, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{comment1ID, comment3ID, comment2ID, comment5ID, comment4ID}, commentIDs(subtree))
+
+	subtree, err = s.GetCommentSubtree(comment1ID, 1, 10, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{comment1ID, comment3ID, comment2ID}, commentIDs(subtree))
+
+	subtree, err = s.GetCommentSubtree(comment1ID, 0, 10, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{comment1ID}, commentIDs(subtree))
+
+	// Limit applies to replies of each comment
+	subtree, err = s.GetCommentSubtree(comment1ID, 3, 1, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{comment1ID, comment3ID, comment5ID}, commentIDs(subtree))
+
+	// Cursor applies to replies of the top comment
+	subtree, err = s.GetCommentSubtree(comment1ID, 3, 10, &store.Cursor{PostedTimestamp: comment3.PostedTimestamp, ID: comment3ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{comment1ID, comment2ID}, commentIDs(subtree))
+
+	_, err = s.GetCommentSubtree("00000000-0000-0000-0002-000000000009", 3, 10, nil)
+	assert.Error(t, err)
+}
+
+func testBatchLookups(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID, carolID)
+	mustInsertStatus(t, s, status1ID, aliceID, store.VisibilityPublic, 0)
+	mustInsertStatus(t, s, status2ID, aliceID, store.VisibilityPrivate, 1)
+	assert.NoError(t, s.InsertStatus(store.Status{
+		ID:               status3ID,
+		UserID:           bobID,
+		PostedTimestamp:  baseTime,
+		Visibility:       store.VisibilityPublic,
+		ResharedStatusID: sql.NullString{String: status1ID, Valid: true},
+	}))
+	mustInsertComment(t, s, comment1ID, bobID, status1ID, "", 1)
+	mustInsertComment(t, s, comment2ID, carolID, status1ID, "", 2)
+	assert.NoError(t, s.InsertStatusLikePair(bobID, status1ID))
+	assert.NoError(t, s.InsertStatusLikePair(carolID, status1ID))
+	assert.NoError(t, s.InsertStatusLikePair(bobID, status2ID))
+	assert.NoError(t, s.InsertCommentLikePair(aliceID, comment1ID))
+
+	users, err := s.GetUsersByIDs([]string{aliceID, carolID, daveID})
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.Equal(t, "user-"+carolID, users[carolID].Username)
+
+	statuses, err := s.GetVisibleStatusesByIDs([]string{status1ID, status2ID}, bobID)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, aliceID, statuses[status1ID].UserID)
+	statuses, _ = s.GetVisibleStatusesByIDs([]string{status1ID, status2ID}, aliceID)
+	assert.Len(t, statuses, 2)
+
+	likes, err := s.GetStatusLikeCounts([]string{status1ID, status2ID, status3ID})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{status1ID: 2, status2ID: 1}, likes)
+	liked, err := s.GetUserLikedStatuses(bobID, []string{status1ID, status2ID, status3ID})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{status1ID: true, status2ID: true}, liked)
+
+	reshares, err := s.GetStatusReshareCounts([]string{status1ID, status2ID})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{status1ID: 1}, reshares)
+
+	likes, err = s.GetCommentLikeCounts([]string{comment1ID, comment2ID})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{comment1ID: 1}, likes)
+
+	// Empty id lists need no lookups
+	users, err = s.GetUsersByIDs(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+	likes, err = s.GetStatusLikeCounts(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, likes)
+}
+
+func testComments(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID)
+	mustInsertStatus(t, s, status1ID, aliceID, store.VisibilityPublic, 0)
+	comment := mustInsertComment(t, s, comment1ID, bobID, status1ID, "", 1)
+	mustInsertComment(t, s, comment2ID, aliceID, status1ID, comment1ID, 2)
+	mustInsertComment(t, s, comment3ID, bobID, status1ID, comment1ID, 3)
+
+	got, err := s.GetCommentByID(comment1ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, comment.Content, got.Content)
+		assert.Equal(t, status1ID, got.StatusID)
+		assert.False(t, got.ParentCommentID.Valid)
+	}
+	_, err = s.GetCommentByID("00000000-0000-0000-0002-000000000009")
+	assert.Error(t, err)
+
+	comments, err := s.GetCommentsFromStatus(status1ID, 30, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{comment3ID, comment2ID, comment1ID}, commentIDs(comments))
+	comments, err = s.GetCommentsFromStatus(status1ID, 2, &store.Cursor{PostedTimestamp: comments[0].PostedTimestamp, ID: comment3ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{comment2ID, comment1ID}, commentIDs(comments))
+
+	replies, err := s.GetCommentReplies(comment1ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{comment3ID, comment2ID}, commentIDs(replies))
+	count, err := s.GetCommentReplyCount(comment1ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, _ = s.GetCommentReplyCount(comment2ID)
+	assert.Equal(t, 0, count)
+
+	comment.Content = "edited"
+	comment.IsEdited = true
+	assert.NoError(t, s.UpdateComment(comment))
+	got, err = s.GetCommentByID(comment1ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "edited", got.Content)
+		assert.True(t, got.IsEdited)
+		assert.False(t, got.IsDeleted)
+	}
+
+	comment.Content = ""
+	comment.IsDeleted = true
+	assert.NoError(t, s.UpdateComment(comment))
+	got, _ = s.GetCommentByID(comment1ID)
+	assert.True(t, got.IsDeleted)
+
+	// Comments with replies cannot be deleted
+	assert.Error(t, s.DeleteCommentByID(comment1ID))
+	assert.NoError(t, s.DeleteCommentByID(comment3ID))
+	assert.NoError(t, s.DeleteCommentByID(comment2ID))
+	assert.NoError(t, s.DeleteCommentByID(comment1ID))
+	_, err = s.GetCommentByID(comment1ID)
+	assert.Error(t, err)
+}
+
+func testCommentLikes(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID)
+	mustInsertStatus(t, s, status1ID, aliceID, store.VisibilityPublic, 0)
+	mustInsertComment(t, s, comment1ID, bobID, status1ID, "", 1)
+
+	assert.NoError(t, s.InsertCommentLikePair(aliceID, comment1ID))
+	assert.NoError(t, s.InsertCommentLikePair(aliceID, comment1ID))
+
+	count, err := s.GetCommentLikes(comment1ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	isLiked, err := s.GetIsUserLikedComment(aliceID, comment1ID)
+	assert.NoError(t, err)
+	assert.True(t, isLiked)
+
+	mustInsertComment(t, s, comment2ID, bobID, status1ID, "", 2)
+	liked, err := s.GetUserLikedComments(aliceID, []string{comment1ID, comment2ID})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{comment1ID: true}, liked)
+	liked, err = s.GetUserLikedComments(aliceID, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, liked)
+
+	assert.NoError(t, s.DeleteCommentLikePair(aliceID, comment1ID))
+	count, _ = s.GetCommentLikes(comment1ID)
+	assert.Equal(t, 0, count)
+}
+
+func testCircles(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID, carolID)
+	circle := store.Circle{ID: circle1ID, UserID: aliceID, Name: "Friends", Description: "My friends"}
+	assert.NoError(t, s.InsertCircle(circle))
+
+	got, err := s.GetCircleByID(circle1ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, circle, *got)
+	}
+	_, err = s.GetCircleByID(circle2ID)
+	assert.Error(t, err)
+
+	circle.Name = "Family"
+	assert.NoError(t, s.UpdateCircle(circle))
+	got, _ = s.GetCircleByID(circle1ID)
+	assert.Equal(t, "Family", got.Name)
+
+	assert.NoError(t, s.InsertCircleUserPair(bobID, circle1ID))
+	assert.NoError(t, s.InsertCircleUserPair(bobID, circle1ID))
+	assert.NoError(t, s.InsertCircleUserPair(carolID, circle1ID))
+	count, err := s.GetCircleUserCount(circle1ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	isInCircle, err := s.GetIsInCircle(bobID, circle1ID)
+	assert.NoError(t, err)
+	assert.True(t, isInCircle)
+
+	assert.NoError(t, s.DeleteCircleUserPair(bobID, circle1ID))
+	isInCircle, _ = s.GetIsInCircle(bobID, circle1ID)
+	assert.False(t, isInCircle)
+
+	assert.NoError(t, s.DeleteCircleByID(circle1ID))
+	_, err = s.GetCircleByID(circle1ID)
+	assert.Error(t, err)
+	isInCircle, _ = s.GetIsInCircle(carolID, circle1ID)
+	assert.False(t, isInCircle)
+}
+
+func testConstraints(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID)
+
+	// References must exist
+	assert.Error(t, s.InsertStatus(store.Status{ID: status1ID, UserID: carolID, PostedTimestamp: baseTime, Visibility: store.VisibilityPublic}))
+	assert.Error(t, s.InsertCircle(store.Circle{ID: circle1ID, UserID: carolID}))
+
+	mustInsertUsers(t, s, carolID)
+	mustInsertStatus(t, s, status1ID, aliceID, store.VisibilityPublic, 0)
+	mustInsertStatus(t, s, status2ID, bobID, store.VisibilityPublic, 0)
+	mustInsertComment(t, s, comment1ID, bobID, status1ID, "", 1)
+	mustInsertComment(t, s, comment2ID, aliceID, status2ID, "", 2)
+	assert.NoError(t, s.InsertStatus(store.Status{
+		ID:               status3ID,
+		UserID:           carolID,
+		PostedTimestamp:  baseTime,
+		Visibility:       store.VisibilityPublic,
+		ResharedStatusID: sql.NullString{String: status1ID, Valid: true},
+	}))
+	mustInsertComment(t, s, comment3ID, carolID, status3ID, "", 3)
+
+	// Comments block deleting their status
+	assertKind(t, s.DeleteStatusByID(status1ID), store.ErrConflict)
+	_, err := s.GetStatusByID(status1ID)
+	assert.NoError(t, err)
+
+	// Deleting a user takes their statuses, reshares of them and comments on both
+	assert.NoError(t, s.DeleteUserByID(aliceID))
+	_, err = s.GetStatusByID(status1ID)
+	assertKind(t, err, store.ErrNotFound)
+	_, err = s.GetStatusByID(status3ID)
+	assertKind(t, err, store.ErrNotFound)
+	_, err = s.GetCommentByID(comment1ID)
+	assertKind(t, err, store.ErrNotFound)
+	_, err = s.GetCommentByID(comment3ID)
+	assertKind(t, err, store.ErrNotFound)
+
+	// Their comments elsewhere are kept under the placeholder
+	comment, err := s.GetCommentByID(comment2ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, store.DeletedUserID, comment.UserID)
+	}
+	placeholder, err := s.GetUserByID(store.DeletedUserID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, store.DeletedUsername, placeholder.Username)
+	}
+	assertKind(t, s.DeleteUserByID(store.DeletedUserID), store.ErrForbidden)
+}
+
+func testDeactivation(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID, carolID)
+	assert.NoError(t, s.DeactivateUser(aliceID, baseTime))
+	assert.NoError(t, s.DeactivateUser(bobID, baseTime.Add(time.Hour)))
+
+	got, err := s.GetUserByID(aliceID)
+	if assert.NoError(t, err) {
+		assert.True(t, got.DeactivatedTimestamp.Valid)
+		assert.True(t, baseTime.Equal(got.DeactivatedTimestamp.Time))
+
+		// Updates leave deactivation alone
+		got.DeactivatedTimestamp = sql.NullTime{}
+		got.Description = "away"
+		assert.NoError(t, s.UpdateUser(*got))
+		got, _ = s.GetUserByID(aliceID)
+		assert.True(t, got.DeactivatedTimestamp.Valid)
+	}
+
+	users, err := s.GetDeactivatedUsers(baseTime)
+	if assert.NoError(t, err) && assert.Len(t, users, 1) {
+		assert.Equal(t, aliceID, users[0].ID)
+	}
+	users, _ = s.GetDeactivatedUsers(baseTime.Add(time.Hour))
+	assert.Len(t, users, 2)
+
+	assert.NoError(t, s.RestoreUser(bobID))
+	got, _ = s.GetUserByID(bobID)
+	assert.False(t, got.DeactivatedTimestamp.Valid)
+
+	// Only users past the cutoff are purged
+	assert.NoError(t, s.DeactivateUser(carolID, baseTime.Add(2*time.Hour)))
+	purged, err := store.PurgeDeactivatedUsers(s, baseTime.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = s.GetUserByID(aliceID)
+	assertKind(t, err, store.ErrNotFound)
+	_, err = s.GetUserByID(bobID)
+	assert.NoError(t, err)
+	_, err = s.GetUserByID(carolID)
+	assert.NoError(t, err)
+}
+
+func testRefreshTokens(t *testing.T, s store.Repository) {
+
+	familyID := "00000000-0000-0000-0004-000000000001"
+	mustInsertUsers(t, s, aliceID)
+	token := store.RefreshToken{
+		ID:               "00000000-0000-0000-0005-000000000001",
+		UserID:           aliceID,
+		FamilyID:         familyID,
+		TokenHash:        "hash1",
+		CreatedTimestamp: baseTime,
+		ExpiresTimestamp: baseTime.Add(time.Hour),
+	}
+	assert.NoError(t, s.InsertRefreshToken(token))
+	next := token
+	next.ID = "00000000-0000-0000-0005-000000000002"
+	next.TokenHash = "hash2"
+	assert.NoError(t, s.InsertRefreshToken(next))
+
+	// Hashes are unique
+	duplicate := token
+	duplicate.ID = "00000000-0000-0000-0005-000000000003"
+	assert.Error(t, s.InsertRefreshToken(duplicate))
+
+	got, err := s.GetRefreshTokenByHash("hash1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, token.ID, got.ID)
+		assert.Equal(t, familyID, got.FamilyID)
+		assert.True(t, token.ExpiresTimestamp.Equal(got.ExpiresTimestamp))
+		assert.False(t, got.IsUsed)
+	}
+	_, err = s.GetRefreshTokenByHash("missing")
+	assert.Error(t, err)
+
+	// Tokens can only be used once
+	used, err := s.UseRefreshToken(token.ID)
+	assert.NoError(t, err)
+	assert.True(t, used)
+	used, err = s.UseRefreshToken(token.ID)
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	assert.NoError(t, s.RevokeRefreshTokenFamily(familyID))
+	got, _ = s.GetRefreshTokenByHash("hash2")
+	assert.True(t, got.IsRevoked)
+
+	// Tokens are deleted with their user
+	assert.NoError(t, s.DeleteUserByID(aliceID))
+	_, err = s.GetRefreshTokenByHash("hash2")
+	assert.Error(t, err)
+}
+
+func testPasswordResetTokens(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID)
+	token := store.PasswordResetToken{
+		ID:               "00000000-0000-0000-0006-000000000001",
+		UserID:           aliceID,
+		TokenHash:        "hash1",
+		CreatedTimestamp: baseTime,
+		ExpiresTimestamp: baseTime.Add(time.Hour),
+	}
+	assert.NoError(t, s.InsertPasswordResetToken(token))
+	other := token
+	other.ID = "00000000-0000-0000-0006-000000000002"
+	other.TokenHash = "hash2"
+	assert.NoError(t, s.InsertPasswordResetToken(other))
+	bobToken := token
+	bobToken.ID = "00000000-0000-0000-0006-000000000003"
+	bobToken.UserID = bobID
+	bobToken.TokenHash = "hash3"
+	assert.NoError(t, s.InsertPasswordResetToken(bobToken))
+
+	// Hashes are unique
+	duplicate := token
+	duplicate.ID = "00000000-0000-0000-0006-000000000004"
+	assert.Error(t, s.InsertPasswordResetToken(duplicate))
+
+	got, err := s.GetPasswordResetTokenByHash("hash1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, token.ID, got.ID)
+		assert.Equal(t, aliceID, got.UserID)
+		assert.True(t, token.ExpiresTimestamp.Equal(got.ExpiresTimestamp))
+		assert.False(t, got.IsUsed)
+	}
+	_, err = s.GetPasswordResetTokenByHash("missing")
+	assert.Error(t, err)
+
+	// Tokens can only be used once
+	used, err := s.UsePasswordResetToken(token.ID)
+	assert.NoError(t, err)
+	assert.True(t, used)
+	used, err = s.UsePasswordResetToken(token.ID)
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	// Only the user's tokens are deleted
+	assert.NoError(t, s.DeleteUserPasswordResetTokens(aliceID))
+	_, err = s.GetPasswordResetTokenByHash("hash2")
+	assert.Error(t, err)
+	_, err = s.GetPasswordResetTokenByHash("hash3")
+	assert.NoError(t, err)
+
+	// Tokens are deleted with their user
+	assert.NoError(t, s.DeleteUserByID(bobID))
+	_, err = s.GetPasswordResetTokenByHash("hash3")
+	assert.Error(t, err)
+}
+
+func testEmailVerificationTokens(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID)
+	token := store.EmailVerificationToken{
+		ID:               "00000000-0000-0000-0007-000000000001",
+		UserID:           aliceID,
+		Email:            "alice@example.com",
+		TokenHash:        "hash1",
+		CreatedTimestamp: baseTime,
+		ExpiresTimestamp: baseTime.Add(time.Hour),
+	}
+	assert.NoError(t, s.InsertEmailVerificationToken(token))
+	bobToken := token
+	bobToken.ID = "00000000-0000-0000-0007-000000000002"
+	bobToken.UserID = bobID
+	bobToken.TokenHash = "hash2"
+	assert.NoError(t, s.InsertEmailVerificationToken(bobToken))
+
+	// Hashes are unique
+	duplicate := token
+	duplicate.ID = "00000000-0000-0000-0007-000000000003"
+	assert.Error(t, s.InsertEmailVerificationToken(duplicate))
+
+	got, err := s.GetEmailVerificationTokenByHash("hash1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, token.ID, got.ID)
+		assert.Equal(t, "alice@example.com", got.Email)
+		assert.True(t, token.ExpiresTimestamp.Equal(got.ExpiresTimestamp))
+	}
+	_, err = s.GetEmailVerificationTokenByHash("missing")
+	assert.Error(t, err)
+
+	// Only the user's tokens are deleted
+	assert.NoError(t, s.DeleteUserEmailVerificationTokens(aliceID))
+	_, err = s.GetEmailVerificationTokenByHash("hash1")
+	assert.Error(t, err)
+	_, err = s.GetEmailVerificationTokenByHash("hash2")
+	assert.NoError(t, err)
+
+	// Tokens are deleted with their user
+	assert.NoError(t, s.DeleteUserByID(bobID))
+	_, err = s.GetEmailVerificationTokenByHash("hash2")
+	assert.Error(t, err)
+}
+
+func testMFATokens(t *testing.T, s store.Repository) {
+
+	tokenID := "00000000-0000-0000-0009-000000000001"
+	mustInsertUsers(t, s, aliceID)
+	token := store.UsedMFAToken{ID: tokenID, UserID: aliceID, ExpiresTimestamp: baseTime.Add(time.Hour)}
+
+	// Tokens can only be used once
+	used, err := s.UseMFAToken(token)
+	assert.NoError(t, err)
+	assert.True(t, used)
+	used, err = s.UseMFAToken(token)
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	// Used tokens are forgotten once they expire
+	count, err := s.DeleteExpiredMFATokens(baseTime)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	count, err = s.DeleteExpiredMFATokens(baseTime.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	used, _ = s.UseMFAToken(token)
+	assert.True(t, used)
+
+	// And deleted along with their user
+	assert.NoError(t, s.DeleteUserByID(aliceID))
+	count, _ = s.DeleteExpiredMFATokens(baseTime.Add(time.Hour))
+	assert.Equal(t, 0, count)
+}
+
+func testSessions(t *testing.T, s store.Repository) {
+
+	session1ID := "00000000-0000-0000-0004-000000000001"
+	session2ID := "00000000-0000-0000-0004-000000000002"
+	mustInsertUsers(t, s, aliceID, bobID)
+	session := store.Session{
+		ID:                session1ID,
+		UserID:            aliceID,
+		UserAgent:         "curl/7.68.0",
+		IPAddress:         "10.0.0.1",
+		CreatedTimestamp:  baseTime,
+		LastSeenTimestamp: baseTime,
+	}
+	assert.NoError(t, s.InsertSession(session))
+	session.ID = session2ID
+	session.LastSeenTimestamp = baseTime.Add(time.Minute)
+	assert.NoError(t, s.InsertSession(session))
+	assert.Error(t, s.InsertSession(session))
+
+	got, err := s.GetSessionByID(session1ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "curl/7.68.0", got.UserAgent)
+		assert.Equal(t, aliceID, got.UserID)
+	}
+
+	assert.NoError(t, s.TouchSession(session1ID, "10.0.0.2", baseTime.Add(time.Hour)))
+	got, _ = s.GetSessionByID(session1ID)
+	assert.Equal(t, "10.0.0.2", got.IPAddress)
+	assert.True(t, baseTime.Add(time.Hour).Equal(got.LastSeenTimestamp))
+
+	sessions, err := s.GetUserSessions(aliceID)
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 2) {
+		assert.Equal(t, session1ID, sessions[0].ID)
+	}
+	sessions, _ = s.GetUserSessions(bobID)
+	assert.Empty(t, sessions)
+
+	// Sessions expire when left unused or past their max age
+	assert.False(t, got.IsExpired(baseTime.Add(time.Hour)))
+	assert.True(t, got.IsExpired(baseTime.Add(time.Hour+store.SessionIdleTimeout)))
+	assert.NoError(t, s.TouchSession(session2ID, "10.0.0.1", baseTime.Add(store.SessionMaxAge-time.Hour)))
+	count, err := s.DeleteExpiredSessions(baseTime.Add(time.Hour + store.SessionIdleTimeout - time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	count, err = s.DeleteExpiredSessions(baseTime.Add(time.Hour + store.SessionIdleTimeout))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	_, err = s.GetSessionByID(session1ID)
+	assertKind(t, err, store.ErrNotFound)
+	count, _ = s.DeleteExpiredSessions(baseTime.Add(store.SessionMaxAge))
+	assert.Equal(t, 1, count)
+
+	session.ID = session1ID
+	assert.NoError(t, s.InsertSession(session))
+	assert.NoError(t, s.DeleteSessionByID(session1ID))
+	_, err = s.GetSessionByID(session1ID)
+	assert.Error(t, err)
+
+	assert.NoError(t, s.DeleteUserSessions(aliceID))
+	sessions, _ = s.GetUserSessions(aliceID)
+	assert.Empty(t, sessions)
+}
+
+func testTOTP(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID)
+
+	assert.NoError(t, s.SetUserTOTP(aliceID, "SECRET", true))
+	got, err := s.GetUserByID(aliceID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "SECRET", got.TOTPSecret)
+		assert.True(t, got.IsTOTPEnabled)
+
+		// Profile updates leave two-factor settings alone
+		got.TOTPSecret = ""
+		got.IsTOTPEnabled = false
+		assert.NoError(t, s.UpdateUser(*got))
+		got, _ = s.GetUserByID(aliceID)
+		assert.Equal(t, "SECRET", got.TOTPSecret)
+		assert.True(t, got.IsTOTPEnabled)
+	}
+
+	// Steps cannot be reused or go backwards
+	used, err := s.UseTOTPStep(aliceID, 100)
+	assert.NoError(t, err)
+	assert.True(t, used)
+	used, _ = s.UseTOTPStep(aliceID, 100)
+	assert.False(t, used)
+	used, _ = s.UseTOTPStep(aliceID, 99)
+	assert.False(t, used)
+	used, _ = s.UseTOTPStep(bobID, 100)
+	assert.True(t, used)
+
+	// Recovery codes are single use and replaced together
+	assert.NoError(t, s.ReplaceRecoveryCodes(aliceID, []string{"code1", "code2"}))
+	assert.NoError(t, s.ReplaceRecoveryCodes(bobID, []string{"code3"}))
+	count, err := s.GetRecoveryCodeCount(aliceID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	used, err = s.UseRecoveryCode(aliceID, "code1")
+	assert.NoError(t, err)
+	assert.True(t, used)
+	used, _ = s.UseRecoveryCode(aliceID, "code1")
+	assert.False(t, used)
+	used, _ = s.UseRecoveryCode(aliceID, "code3")
+	assert.False(t, used)
+	count, _ = s.GetRecoveryCodeCount(aliceID)
+	assert.Equal(t, 1, count)
+
+	assert.NoError(t, s.ReplaceRecoveryCodes(aliceID, []string{"code4"}))
+	used, _ = s.UseRecoveryCode(aliceID, "code2")
+	assert.False(t, used)
+
+	assert.NoError(t, s.DeleteUserRecoveryCodes(aliceID))
+	count, _ = s.GetRecoveryCodeCount(aliceID)
+	assert.Equal(t, 0, count)
+	count, _ = s.GetRecoveryCodeCount(bobID)
+	assert.Equal(t, 1, count)
+
+	// Disabling resets used steps
+	assert.NoError(t, s.SetUserTOTP(aliceID, "", false))
+	used, _ = s.UseTOTPStep(aliceID, 100)
+	assert.True(t, used)
+}
+
+func testLoginThrottle(t *testing.T, s store.Repository) {
+
+	_, err := s.GetLoginFailure("user:alice")
+	assert.Error(t, err)
+
+	// Failures count up within the window and start over after it
+	count, err := s.RecordLoginFailure("user:alice", baseTime, baseTime.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, _ = s.RecordLoginFailure("user:alice", baseTime.Add(time.Minute), baseTime.Add(-time.Hour))
+	assert.Equal(t, 2, count)
+	count, _ = s.RecordLoginFailure("ip:10.0.0.1", baseTime.Add(time.Minute), baseTime.Add(-time.Hour))
+	assert.Equal(t, 1, count)
+
+	failure, err := s.GetLoginFailure("user:alice")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, failure.FailureCount)
+		assert.True(t, baseTime.Add(time.Minute).Equal(failure.LastFailureTimestamp))
+		assert.True(t, failure.LockedUntilTimestamp.Before(baseTime))
+	}
+
+	count, _ = s.RecordLoginFailure("user:alice", baseTime.Add(3*time.Hour), baseTime.Add(2*time.Hour))
+	assert.Equal(t, 1, count)
+
+	// Locking out resets the count and is recorded
+	lockout := store.LoginLockout{
+		ID:               "00000000-0000-0000-0005-000000000001",
+		Key:              "user:alice",
+		Username:         "alice",
+		IPAddress:        "10.0.0.1",
+		FailureCount:     1,
+		CreatedTimestamp: baseTime.Add(3 * time.Hour),
+		ExpiresTimestamp: baseTime.Add(4 * time.Hour),
+	}
+	assert.NoError(t, s.LockLogin(lockout))
+	assert.Error(t, s.LockLogin(lockout))
+
+	failure, _ = s.GetLoginFailure("user:alice")
+	assert.Equal(t, 0, failure.FailureCount)
+	assert.True(t, baseTime.Add(4*time.Hour).Equal(failure.LockedUntilTimestamp))
+
+	lockouts, err := s.GetLoginLockouts(baseTime)
+	assert.NoError(t, err)
+	if assert.Len(t, lockouts, 1) {
+		assert.Equal(t, "alice", lockouts[0].Username)
+		assert.Equal(t, "10.0.0.1", lockouts[0].IPAddress)
+	}
+	lockouts, _ = s.GetLoginLockouts(baseTime.Add(4 * time.Hour))
+	assert.Empty(t, lockouts)
+
+	// Failures are purged once they are old and no longer locked out
+	count, err = s.DeleteStaleLoginFailures(baseTime.Add(3 * time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	_, err = s.GetLoginFailure("ip:10.0.0.1")
+	assert.Error(t, err)
+	_, err = s.GetLoginFailure("user:alice")
+	assert.NoError(t, err)
+
+	s.RecordLoginFailure("ip:10.0.0.1", baseTime.Add(3*time.Hour), baseTime.Add(2*time.Hour))
+	assert.NoError(t, s.DeleteLoginFailure("user:alice"))
+	_, err = s.GetLoginFailure("user:alice")
+	assert.Error(t, err)
+	_, err = s.GetLoginFailure("ip:10.0.0.1")
+	assert.NoError(t, err)
+}
+
+func testUserData(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID, bobID, carolID)
+	mustInsertStatus(t, s, status1ID, aliceID, store.VisibilityPublic, 0)
+	mustInsertStatus(t, s, status2ID, aliceID, store.VisibilityCircles, 1)
+	mustInsertStatus(t, s, status3ID, bobID, store.VisibilityPublic, 2)
+	mustInsertComment(t, s, comment1ID, aliceID, status3ID, "", 3)
+	mustInsertComment(t, s, comment2ID, aliceID, status1ID, "", 4)
+	mustInsertComment(t, s, comment3ID, bobID, status1ID, comment2ID, 5)
+	mustInsertCircle(t, s, circle1ID, aliceID, carolID, bobID)
+	assert.NoError(t, s.InsertCircle(store.Circle{ID: circle2ID, UserID: aliceID, Name: "Acquaintances"}))
+	assert.NoError(t, s.InsertStatusCirclePair(status2ID, circle1ID))
+	assert.NoError(t, s.InsertStatusCirclePair(status2ID, circle2ID))
+	assert.NoError(t, s.InsertStatusLikePair(aliceID, status3ID))
+	assert.NoError(t, s.InsertStatusLikePair(bobID, status1ID))
+	assert.NoError(t, s.InsertCommentLikePair(aliceID, comment3ID))
+
+	statuses, err := s.GetUserStatuses(aliceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{status2ID, status1ID}, statusIDs(statuses))
+
+	circleIDs, err := s.GetStatusCircleIDs([]string{status1ID, status2ID})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{status2ID: {circle1ID, circle2ID}}, circleIDs)
+
+	likes, err := s.GetUserStatusLikes(aliceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{status3ID}, likes)
+	likes, err = s.GetUserCommentLikes(aliceID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{comment3ID}, likes)
+
+	// Deleted comments are left out
+	assert.NoError(t, s.DeleteCommentByID(comment1ID))
+	comments, err := s.GetUserComments(aliceID)
+	if assert.NoError(t, err) && assert.Len(t, comments, 1) {
+		assert.Equal(t, comment2ID, comments[0].ID)
+	}
+
+	circles, err := s.GetUserCircles(aliceID)
+	if assert.NoError(t, err) && assert.Len(t, circles, 2) {
+		assert.Equal(t, circle2ID, circles[0].ID)
+		assert.Equal(t, circle1ID, circles[1].ID)
+	}
+	members, err := s.GetCircleUserIDs(circle1ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{bobID, carolID}, members)
+
+	// Users without data get empty results
+	statuses, _ = s.GetUserStatuses(carolID)
+	assert.Empty(t, statuses)
+	circles, _ = s.GetUserCircles(carolID)
+	assert.Empty(t, circles)
+}
+
+func testExports(t *testing.T, s store.Repository) {
+
+	exportID := "00000000-0000-0000-0008-000000000001"
+	mustInsertUsers(t, s, aliceID)
+	export := store.Export{
+		ID:               exportID,
+		UserID:           aliceID,
+		State:            store.ExportPending,
+		CreatedTimestamp: baseTime,
+		ExpiresTimestamp: baseTime.Add(time.Hour),
+	}
+	assert.NoError(t, s.InsertExport(export))
+
+	got, err := s.GetExportByID(exportID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, store.ExportPending, got.State)
+		assert.Empty(t, got.Archive)
+		assert.True(t, baseTime.Add(time.Hour).Equal(got.ExpiresTimestamp))
+	}
+	_, err = s.GetExportByID("00000000-0000-0000-0008-000000000002")
+	assertKind(t, err, store.ErrNotFound)
+
+	assert.NoError(t, s.FinishExport(exportID, store.ExportReady, []byte("archive")))
+	got, _ = s.GetExportByID(exportID)
+	assert.Equal(t, store.ExportReady, got.State)
+	assert.Equal(t, []byte("archive"), got.Archive)
+
+	// Users can only have one pending export, until it is failed for being stale
+	pending := store.Export{
+		ID:               "00000000-0000-0000-0008-000000000002",
+		UserID:           aliceID,
+		State:            store.ExportPending,
+		CreatedTimestamp: baseTime,
+		ExpiresTimestamp: baseTime.Add(2 * time.Hour),
+	}
+	assert.NoError(t, s.InsertExport(pending))
+	pending.ID = "00000000-0000-0000-0008-000000000003"
+	assertKind(t, s.InsertExport(pending), store.ErrConflict)
+	count, err := s.FailStaleExports(baseTime.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	count, err = s.FailStaleExports(baseTime)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	got, _ = s.GetExportByID("00000000-0000-0000-0008-000000000002")
+	assert.Equal(t, store.ExportFailed, got.State)
+	assert.NoError(t, s.InsertExport(pending))
+
+	// Only exports past expiry are deleted
+	count, err = s.DeleteExpiredExports(baseTime)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	count, err = s.DeleteExpiredExports(baseTime.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	_, err = s.GetExportByID(exportID)
+	assertKind(t, err, store.ErrNotFound)
+
+	// Exports are deleted along with their user
+	export.State = store.ExportReady
+	export.ExpiresTimestamp = baseTime.Add(2 * time.Hour)
+	assert.NoError(t, s.InsertExport(export))
+	assert.NoError(t, s.DeleteUserByID(aliceID))
+	_, err = s.GetExportByID(exportID)
+	assertKind(t, err, store.ErrNotFound)
+}
+
+func testTransactions(t *testing.T, s store.Repository) {
+
+	mustInsertUsers(t, s, aliceID)
+
+	// Changes are kept when fn succeeds
+	err := s.WithTx(func(tx store.Repository) error {
+		return tx.InsertUser(store.User{ID: bobID, Username: "bob", PasswordHash: "hash"})
+	})
+	assert.NoError(t, err)
+	_, err = s.GetUserByID(bobID)
+	assert.NoError(t, err)
+
+	// All of them are rolled back when it fails, including nested transactions
+	failed := errors.New("failed")
+	err = s.WithTx(func(tx store.Repository) error {
+		mustInsertStatus(t, tx, status1ID, aliceID, store.VisibilityPublic, 0)
+		err := tx.WithTx(func(tx store.Repository) error {
+			return tx.InsertUser(store.User{ID: carolID, Username: "carol", PasswordHash: "hash"})
+		})
+		if err != nil {
+			return err
+		}
+		if err := tx.DeleteUserByID(bobID); err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.Equal(t, failed, err)
+	_, err = s.GetStatusByID(status1ID)
+	assertKind(t, err, store.ErrNotFound)
+	_, err = s.GetUserByID(carolID)
+	assertKind(t, err, store.ErrNotFound)
+	_, err = s.GetUserByID(bobID)
+	assert.NoError(t, err)
+}
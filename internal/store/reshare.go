@@ -0,0 +1,68 @@
+package store
+
+import "github.com/lib/pq"
+
+// A reshare is a status whose ResharedStatusID points to the status being reshared.
+// It carries its own commentary and audience and is deleted with the original.
+
+// GetStatusReshares gets reshares of a status that are visible to viewer
+func (s *Store) GetStatusReshares(statusID string, viewerID string, limit int, after *Cursor) ([]Status, error) {
+
+	afterTimestamp, afterID := cursorParams(after)
+	rows, err := s.db.Query(
+		`SELECT id, user_id, content, posted_timestamp, is_edited, visibility, reshared_status_id
+		FROM statuses WHERE reshared_status_id=$1 AND `+statusVisibleTo("$2")+` AND `+afterCursor("$3", "$4")+`
+		ORDER BY posted_timestamp DESC, id DESC
+		LIMIT $5`,
+		statusID, viewerParam(viewerID), afterTimestamp, afterID, limit,
+	)
+	if err != nil {
+		return nil, dbError("Error retrieving reshares", err)
+	}
+	defer rows.Close()
+
+	statuses := make([]Status, 0)
+
+	for rows.Next() {
+		status := Status{}
+		err := rows.Scan(&status.ID, &status.UserID, &status.Content, &status.PostedTimestamp, &status.IsEdited, &status.Visibility, &status.ResharedStatusID)
+		if err != nil {
+			return nil, dbError("Error retrieving reshares", err)
+		}
+		statuses = append(statuses, status)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError("Error retrieving reshares", err)
+	}
+
+	return statuses, nil
+}
+
+// GetStatusReshareCount gets number of reshares of a status
+func (s *Store) GetStatusReshareCount(statusID string) (int, error) {
+
+	row := s.db.QueryRow("SELECT COUNT(id) FROM statuses WHERE reshared_status_id=$1",
+		statusID,
+	)
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return -1, dbError("Error with database", err)
+	}
+
+	return count, nil
+}
+
+// GetStatusReshareCounts gets number of reshares of each status keyed by id
+//
+// Statuses without reshares are left out.
+func (s *Store) GetStatusReshareCounts(statusIDs []string) (map[string]int, error) {
+
+	if len(statusIDs) == 0 {
+		return make(map[string]int), nil
+	}
+
+	return s.queryCounts(
+		"SELECT reshared_status_id, COUNT(id) FROM statuses WHERE reshared_status_id=ANY($1) GROUP BY reshared_status_id",
+		pq.Array(statusIDs),
+	)
+}
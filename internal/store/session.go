@@ -0,0 +1,143 @@
+package store
+
+import "time"
+
+const (
+	// SessionIdleTimeout is how long a session lasts without being used
+	SessionIdleTimeout = 30 * 24 * time.Hour
+
+	// SessionMaxAge is how long a session lasts after login however much it is used
+	SessionMaxAge = 90 * 24 * time.Hour
+)
+
+// Session is a login on a device
+//
+// Access tokens carry the session id in their jti claim and refresh tokens issued
+// for the session share its id as their family id.
+type Session struct {
+	ID                string
+	UserID            string
+	UserAgent         string
+	IPAddress         string
+	CreatedTimestamp  time.Time
+	LastSeenTimestamp time.Time
+}
+
+// IsExpired checks if session has gone unused too long or outlived its max age at time
+func (session Session) IsExpired(now time.Time) bool {
+	return !now.Before(session.LastSeenTimestamp.Add(SessionIdleTimeout)) ||
+		!now.Before(session.CreatedTimestamp.Add(SessionMaxAge))
+}
+
+// InsertSession inserts session
+func (s *Store) InsertSession(session Session) error {
+
+	_, err := s.db.Exec(
+		`INSERT INTO sessions (id, user_id, user_agent, ip_address, created_timestamp, last_seen_timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		session.ID, session.UserID, session.UserAgent, session.IPAddress, session.CreatedTimestamp, session.LastSeenTimestamp,
+	)
+	if err != nil {
+		return dbError("Error inserting session", err)
+	}
+
+	return nil
+}
+
+// GetSessionByID gets session by id
+func (s *Store) GetSessionByID(sessionID string) (*Session, error) {
+
+	row := s.db.QueryRow(
+		`SELECT id, user_id, user_agent, ip_address, created_timestamp, last_seen_timestamp
+		FROM sessions WHERE id=$1`,
+		sessionID,
+	)
+
+	session := Session{}
+	if err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.CreatedTimestamp, &session.LastSeenTimestamp); err != nil {
+		return nil, scanError("No session found", err)
+	}
+
+	return &session, nil
+}
+
+// GetUserSessions gets sessions of user, most recently seen first
+func (s *Store) GetUserSessions(userID string) ([]Session, error) {
+
+	rows, err := s.db.Query(
+		`SELECT id, user_id, user_agent, ip_address, created_timestamp, last_seen_timestamp
+		FROM sessions WHERE user_id=$1
+		ORDER BY last_seen_timestamp DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, dbError("Error retrieving sessions", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		session := Session{}
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress, &session.CreatedTimestamp, &session.LastSeenTimestamp); err != nil {
+			return nil, dbError("Error retrieving sessions", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession records session was seen from ip address
+func (s *Store) TouchSession(sessionID string, ipAddress string, lastSeen time.Time) error {
+
+	_, err := s.db.Exec(
+		"UPDATE sessions SET ip_address=$2, last_seen_timestamp=$3 WHERE id=$1",
+		sessionID, ipAddress, lastSeen,
+	)
+	if err != nil {
+		return dbError("Error updating session", err)
+	}
+
+	return nil
+}
+
+// DeleteSessionByID deletes session by id
+func (s *Store) DeleteSessionByID(sessionID string) error {
+
+	_, err := s.db.Exec("DELETE FROM sessions WHERE id=$1", sessionID)
+	if err != nil {
+		return dbError("Error deleting session", err)
+	}
+
+	return nil
+}
+
+// DeleteUserSessions deletes all sessions of user
+func (s *Store) DeleteUserSessions(userID string) error {
+
+	_, err := s.db.Exec("DELETE FROM sessions WHERE user_id=$1", userID)
+	if err != nil {
+		return dbError("Error deleting sessions", err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredSessions deletes sessions expired at time, returning how many were deleted
+func (s *Store) DeleteExpiredSessions(now time.Time) (int, error) {
+
+	res, err := s.db.Exec(
+		"DELETE FROM sessions WHERE last_seen_timestamp<=$1 OR created_timestamp<=$2",
+		now.Add(-SessionIdleTimeout), now.Add(-SessionMaxAge),
+	)
+	if err != nil {
+		return 0, dbError("Error deleting sessions", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, dbError("Error deleting sessions", err)
+	}
+
+	return int(count), nil
+}
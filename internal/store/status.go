@@ -1,60 +1,216 @@
 package store
 
 import (
-	"errors"
+	"database/sql"
+	"fmt"
 	"time"
+
+	"github.com/lib/pq"
+)
+
+// Status visibilities
+const (
+	VisibilityPublic   = "public"
+	VisibilityCircles  = "circles"
+	VisibilityExtended = "extended"
+	VisibilityPrivate  = "private"
 )
 
 // Status is a status post
 type Status struct {
-	ID              string
-	UserID          string
-	Content         string
-	PostedTimestamp time.Time
-	IsEdited        bool
+	ID               string
+	UserID           string
+	Content          string
+	PostedTimestamp  time.Time
+	IsEdited         bool
+	Visibility       string
+	ResharedStatusID sql.NullString
+}
+
+// IsValidVisibility checks if visibility is a known status audience
+func IsValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPublic, VisibilityCircles, VisibilityExtended, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// statusVisibleTo builds condition for statuses visible to the viewer bound to param
+//
+// Circle visibility admits users in any of the status's circles. Extended visibility
+// admits users in the poster's circles and users in the circles of those users.
+func statusVisibleTo(param string) string {
+	return fmt.Sprintf(`(statuses.visibility='public'
+		OR statuses.user_id=%[1]s
+		OR (statuses.visibility='circles' AND EXISTS (
+			SELECT 1 FROM status_circle_pairs JOIN circle_user_pairs ON status_circle_pairs.circle_id=circle_user_pairs.circle_id
+			WHERE status_circle_pairs.status_id=statuses.id AND circle_user_pairs.user_id=%[1]s
+		))
+		OR (statuses.visibility='extended' AND EXISTS (
+			SELECT 1 FROM circle_user_pairs cup JOIN circles c ON cup.circle_id=c.id
+			WHERE cup.user_id=%[1]s AND (c.user_id=statuses.user_id OR c.user_id IN (
+				SELECT cup2.user_id FROM circle_user_pairs cup2 JOIN circles c2 ON cup2.circle_id=c2.id
+				WHERE c2.user_id=statuses.user_id
+			))
+		)))`, param)
+}
+
+// viewerParam converts viewer id to query param, using NULL for anonymous viewers
+func viewerParam(viewerID string) sql.NullString {
+	return sql.NullString{String: viewerID, Valid: len(viewerID) > 0}
 }
 
 // GetStatusByID gets status by id
 func (s *Store) GetStatusByID(statusID string) (*Status, error) {
 
 	row := s.db.QueryRow(
-		"SELECT id, user_id, content, posted_timestamp, is_edited FROM statuses WHERE id=$1",
+		"SELECT id, user_id, content, posted_timestamp, is_edited, visibility, reshared_status_id FROM statuses WHERE id=$1",
 		statusID,
 	)
 
 	status := Status{}
-	if err := row.Scan(&status.ID, &status.UserID, &status.Content, &status.PostedTimestamp, &status.IsEdited); err != nil {
-		return nil, errors.New("No status found")
+	if err := row.Scan(&status.ID, &status.UserID, &status.Content, &status.PostedTimestamp, &status.IsEdited, &status.Visibility, &status.ResharedStatusID); err != nil {
+		return nil, scanError("No status found", err)
 	}
 
 	return &status, nil
 }
 
-// GetStatusFeed gets statuses in feed
-func (s *Store) GetStatusFeed(userID string, limit int, offset int) ([]Status, error) {
+// GetVisibleStatusByID gets status by id if it is visible to viewer
+//
+// An empty viewerID is an anonymous viewer who can only see public statuses.
+func (s *Store) GetVisibleStatusByID(statusID string, viewerID string) (*Status, error) {
+
+	row := s.db.QueryRow(
+		`SELECT id, user_id, content, posted_timestamp, is_edited, visibility, reshared_status_id
+		FROM statuses WHERE id=$1 AND `+statusVisibleTo("$2"),
+		statusID, viewerParam(viewerID),
+	)
+
+	status := Status{}
+	if err := row.Scan(&status.ID, &status.UserID, &status.Content, &status.PostedTimestamp, &status.IsEdited, &status.Visibility, &status.ResharedStatusID); err != nil {
+		return nil, scanError("No status found", err)
+	}
+
+	return &status, nil
+}
+
+// GetVisibleStatusesByIDs gets statuses with the given ids that are visible to viewer keyed by id
+func (s *Store) GetVisibleStatusesByIDs(statusIDs []string, viewerID string) (map[string]Status, error) {
+
+	statuses := make(map[string]Status)
+	if len(statusIDs) == 0 {
+		return statuses, nil
+	}
+
+	rows, err := s.db.Query(
+		`SELECT id, user_id, content, posted_timestamp, is_edited, visibility, reshared_status_id
+		FROM statuses WHERE id=ANY($1) AND `+statusVisibleTo("$2"),
+		pq.Array(statusIDs), viewerParam(viewerID),
+	)
+	if err != nil {
+		return nil, dbError("Error retrieving statuses", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		status := Status{}
+		if err := rows.Scan(&status.ID, &status.UserID, &status.Content, &status.PostedTimestamp, &status.IsEdited, &status.Visibility, &status.ResharedStatusID); err != nil {
+			return nil, dbError("Error retrieving statuses", err)
+		}
+		statuses[status.ID] = status
+	}
+
+	return statuses, nil
+}
+
+// GetUserStatuses gets every status posted by user, newest first
+func (s *Store) GetUserStatuses(userID string) ([]Status, error) {
+
+	rows, err := s.db.Query(
+		`SELECT id, user_id, content, posted_timestamp, is_edited, visibility, reshared_status_id
+		FROM statuses WHERE user_id=$1
+		ORDER BY posted_timestamp DESC, id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, dbError("Error retrieving statuses", err)
+	}
+	defer rows.Close()
+
+	statuses := make([]Status, 0)
+	for rows.Next() {
+		status := Status{}
+		if err := rows.Scan(&status.ID, &status.UserID, &status.Content, &status.PostedTimestamp, &status.IsEdited, &status.Visibility, &status.ResharedStatusID); err != nil {
+			return nil, dbError("Error retrieving statuses", err)
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// GetStatusCircleIDs gets ids of circles statuses are shared with keyed by status id
+func (s *Store) GetStatusCircleIDs(statusIDs []string) (map[string][]string, error) {
+
+	circleIDs := make(map[string][]string)
+	if len(statusIDs) == 0 {
+		return circleIDs, nil
+	}
+
+	rows, err := s.db.Query(
+		"SELECT status_id, circle_id FROM status_circle_pairs WHERE status_id=ANY($1) ORDER BY circle_id",
+		pq.Array(statusIDs),
+	)
+	if err != nil {
+		return nil, dbError("Error with database", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var statusID, circleID string
+		if err := rows.Scan(&statusID, &circleID); err != nil {
+			return nil, dbError("Error with database", err)
+		}
+		circleIDs[statusID] = append(circleIDs[statusID], circleID)
+	}
+
+	return circleIDs, nil
+}
+
+// GetStatusFeed gets page of statuses in feed after cursor, starting from the newest if cursor is nil
+func (s *Store) GetStatusFeed(userID string, limit int, after *Cursor) ([]Status, error) {
 
+	afterTimestamp, afterID := cursorParams(after)
 	rows, err := s.db.Query(
-		`SELECT id, user_id, content, posted_timestamp, is_edited
+		`SELECT id, user_id, content, posted_timestamp, is_edited, visibility, reshared_status_id
 		FROM statuses WHERE user_id IN (
 			SELECT circle_user_pairs.user_id
 			FROM circle_user_pairs JOIN circles ON circle_user_pairs.circle_id=circles.id
 			WHERE circles.user_id=$1
-		) ORDER BY posted_timestamp DESC
-		LIMIT $2 OFFSET $3`,
-		userID, limit, offset,
+		) AND `+statusVisibleTo("$1")+` AND `+afterCursor("$2", "$3")+`
+		ORDER BY posted_timestamp DESC, id DESC
+		LIMIT $4`,
+		userID, afterTimestamp, afterID, limit,
 	)
-	defer rows.Close()
 	if err != nil {
-		return nil, errors.New("Error retrieving feed")
+		return nil, dbError("Error retrieving feed", err)
 	}
+	defer rows.Close()
 
 	statuses := make([]Status, 0)
 
 	for rows.Next() {
 		status := Status{}
-		rows.Scan(&status.ID, &status.UserID, &status.Content, &status.PostedTimestamp, &status.IsEdited)
+		if err := rows.Scan(&status.ID, &status.UserID, &status.Content, &status.PostedTimestamp, &status.IsEdited, &status.Visibility, &status.ResharedStatusID); err != nil {
+			return nil, dbError("Error retrieving feed", err)
+		}
 		statuses = append(statuses, status)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError("Error retrieving feed", err)
+	}
 
 	return statuses, nil
 }
@@ -63,11 +219,11 @@ func (s *Store) GetStatusFeed(userID string, limit int, offset int) ([]Status, e
 func (s *Store) InsertStatus(status Status) error {
 
 	_, err := s.db.Exec(
-		"INSERT INTO statuses (id, user_id, content, posted_timestamp, is_edited) VALUES ($1, $2, $3, $4, $5)",
-		status.ID, status.UserID, status.Content, status.PostedTimestamp, status.IsEdited,
+		"INSERT INTO statuses (id, user_id, content, posted_timestamp, is_edited, visibility, reshared_status_id) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		status.ID, status.UserID, status.Content, status.PostedTimestamp, status.IsEdited, status.Visibility, status.ResharedStatusID,
 	)
 	if err != nil {
-		return errors.New("Error creating status")
+		return dbError("Error creating status", err)
 	}
 
 	return nil
@@ -81,7 +237,7 @@ func (s *Store) UpdateStatus(status Status) error {
 		status.ID, status.Content, status.PostedTimestamp, status.IsEdited,
 	)
 	if err != nil {
-		return errors.New("Error updating status")
+		return dbError("Error updating status", err)
 	}
 
 	return nil
@@ -91,8 +247,11 @@ func (s *Store) UpdateStatus(status Status) error {
 func (s *Store) DeleteStatusByID(statusID string) error {
 
 	_, err := s.db.Exec("DELETE FROM statuses WHERE id=$1", statusID)
+	if isViolation(err, foreignKeyViolation) {
+		return conflict("Status has comments", err)
+	}
 	if err != nil {
-		return errors.New("Error deleting status")
+		return dbError("Error deleting status", err)
 	}
 
 	return nil
@@ -106,12 +265,27 @@ func (s *Store) GetStatusLikes(statusID string) (int, error) {
 	)
 	var count int
 	if err := row.Scan(&count); err != nil {
-		return -1, errors.New("Error with database")
+		return -1, dbError("Error with database", err)
 	}
 
 	return count, nil
 }
 
+// GetStatusLikeCounts gets number of likes on each status keyed by id
+//
+// Statuses without likes are left out.
+func (s *Store) GetStatusLikeCounts(statusIDs []string) (map[string]int, error) {
+
+	if len(statusIDs) == 0 {
+		return make(map[string]int), nil
+	}
+
+	return s.queryCounts(
+		"SELECT status_id, COUNT(user_id) FROM status_like_pairs WHERE status_id=ANY($1) GROUP BY status_id",
+		pq.Array(statusIDs),
+	)
+}
+
 // GetIsUserLikedStatus checks if status was liked by user
 func (s *Store) GetIsUserLikedStatus(userID string, statusID string) (bool, error) {
 
@@ -120,7 +294,7 @@ func (s *Store) GetIsUserLikedStatus(userID string, statusID string) (bool, erro
 	)
 	var count int
 	if err := row.Scan(&count); err != nil {
-		return false, errors.New("Error with database")
+		return false, dbError("Error with database", err)
 	}
 	if count > 0 {
 		return true, nil
@@ -129,6 +303,54 @@ func (s *Store) GetIsUserLikedStatus(userID string, statusID string) (bool, erro
 	return false, nil
 }
 
+// GetUserLikedStatuses gets which of the statuses were liked by user
+func (s *Store) GetUserLikedStatuses(userID string, statusIDs []string) (map[string]bool, error) {
+
+	liked := make(map[string]bool)
+	if len(statusIDs) == 0 {
+		return liked, nil
+	}
+
+	rows, err := s.db.Query("SELECT status_id FROM status_like_pairs WHERE user_id=$1 AND status_id=ANY($2)",
+		userID, pq.Array(statusIDs),
+	)
+	if err != nil {
+		return nil, dbError("Error with database", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var statusID string
+		if err := rows.Scan(&statusID); err != nil {
+			return nil, dbError("Error with database", err)
+		}
+		liked[statusID] = true
+	}
+
+	return liked, nil
+}
+
+// GetUserStatusLikes gets ids of every status liked by user
+func (s *Store) GetUserStatusLikes(userID string) ([]string, error) {
+
+	rows, err := s.db.Query("SELECT status_id FROM status_like_pairs WHERE user_id=$1 ORDER BY status_id", userID)
+	if err != nil {
+		return nil, dbError("Error with database", err)
+	}
+	defer rows.Close()
+
+	statusIDs := make([]string, 0)
+	for rows.Next() {
+		var statusID string
+		if err := rows.Scan(&statusID); err != nil {
+			return nil, dbError("Error with database", err)
+		}
+		statusIDs = append(statusIDs, statusID)
+	}
+
+	return statusIDs, nil
+}
+
 // InsertStatusLikePair inserts (userID, statusID) pair for liking a status post
 func (s *Store) InsertStatusLikePair(userID string, statusID string) error {
 
@@ -147,7 +369,7 @@ func (s *Store) InsertStatusLikePair(userID string, statusID string) error {
 		userID, statusID,
 	)
 	if err != nil {
-		return errors.New("Error inserting status like pair")
+		return dbError("Error inserting status like pair", err)
 	}
 
 	return nil
@@ -161,7 +383,21 @@ func (s *Store) DeleteStatusLikePair(userID string, statusID string) error {
 		userID, statusID,
 	)
 	if err != nil {
-		return errors.New("Error deleting status like pair")
+		return dbError("Error deleting status like pair", err)
+	}
+
+	return nil
+}
+
+// InsertStatusCirclePair inserts (statusID, circleID) pair for sharing a status with a circle
+func (s *Store) InsertStatusCirclePair(statusID string, circleID string) error {
+
+	_, err := s.db.Exec(
+		"INSERT INTO status_circle_pairs (status_id, circle_id) VALUES ($1, $2)",
+		statusID, circleID,
+	)
+	if err != nil {
+		return dbError("Error inserting status circle pair", err)
 	}
 
 	return nil
@@ -0,0 +1,263 @@
+package store
+
+import "time"
+
+// RefreshToken is a single-use token for getting new access tokens
+//
+// Each login starts a family of refresh tokens. Refreshing uses up the presented token
+// and issues the next one in the same family.
+type RefreshToken struct {
+	ID               string
+	UserID           string
+	FamilyID         string
+	TokenHash        string
+	CreatedTimestamp time.Time
+	ExpiresTimestamp time.Time
+	IsUsed           bool
+	IsRevoked        bool
+}
+
+// InsertRefreshToken inserts refresh token
+func (s *Store) InsertRefreshToken(token RefreshToken) error {
+
+	_, err := s.db.Exec(
+		`INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, created_timestamp, expires_timestamp, is_used, is_revoked)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		token.ID, token.UserID, token.FamilyID, token.TokenHash, token.CreatedTimestamp, token.ExpiresTimestamp, token.IsUsed, token.IsRevoked,
+	)
+	if err != nil {
+		return dbError("Error inserting refresh token", err)
+	}
+
+	return nil
+}
+
+// GetRefreshTokenByHash gets refresh token by hash
+func (s *Store) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+
+	row := s.db.QueryRow(
+		`SELECT id, user_id, family_id, token_hash, created_timestamp, expires_timestamp, is_used, is_revoked
+		FROM refresh_tokens WHERE token_hash=$1`,
+		tokenHash,
+	)
+
+	token := RefreshToken{}
+	if err := row.Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.CreatedTimestamp, &token.ExpiresTimestamp, &token.IsUsed, &token.IsRevoked); err != nil {
+		return nil, scanError("No refresh token found", err)
+	}
+
+	return &token, nil
+}
+
+// UseRefreshToken marks refresh token as used
+//
+// Returns false if the token was already used so concurrent refreshes cannot both succeed.
+func (s *Store) UseRefreshToken(tokenID string) (bool, error) {
+
+	res, err := s.db.Exec("UPDATE refresh_tokens SET is_used=TRUE WHERE id=$1 AND is_used=FALSE", tokenID)
+	if err != nil {
+		return false, dbError("Error updating refresh token", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, dbError("Error updating refresh token", err)
+	}
+
+	return count > 0, nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token in a family
+func (s *Store) RevokeRefreshTokenFamily(familyID string) error {
+
+	_, err := s.db.Exec("UPDATE refresh_tokens SET is_revoked=TRUE WHERE family_id=$1", familyID)
+	if err != nil {
+		return dbError("Error revoking refresh tokens", err)
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token belonging to user
+func (s *Store) RevokeUserRefreshTokens(userID string) error {
+
+	_, err := s.db.Exec("UPDATE refresh_tokens SET is_revoked=TRUE WHERE user_id=$1", userID)
+	if err != nil {
+		return dbError("Error revoking refresh tokens", err)
+	}
+
+	return nil
+}
+
+// PasswordResetToken is a single-use token for setting a new password without logging in
+type PasswordResetToken struct {
+	ID               string
+	UserID           string
+	TokenHash        string
+	CreatedTimestamp time.Time
+	ExpiresTimestamp time.Time
+	IsUsed           bool
+}
+
+// InsertPasswordResetToken inserts password reset token
+func (s *Store) InsertPasswordResetToken(token PasswordResetToken) error {
+
+	_, err := s.db.Exec(
+		`INSERT INTO password_reset_tokens (id, user_id, token_hash, created_timestamp, expires_timestamp, is_used)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		token.ID, token.UserID, token.TokenHash, token.CreatedTimestamp, token.ExpiresTimestamp, token.IsUsed,
+	)
+	if err != nil {
+		return dbError("Error inserting password reset token", err)
+	}
+
+	return nil
+}
+
+// GetPasswordResetTokenByHash gets password reset token by hash
+func (s *Store) GetPasswordResetTokenByHash(tokenHash string) (*PasswordResetToken, error) {
+
+	row := s.db.QueryRow(
+		`SELECT id, user_id, token_hash, created_timestamp, expires_timestamp, is_used
+		FROM password_reset_tokens WHERE token_hash=$1`,
+		tokenHash,
+	)
+
+	token := PasswordResetToken{}
+	if err := row.Scan(&token.ID, &token.UserID, &token.TokenHash, &token.CreatedTimestamp, &token.ExpiresTimestamp, &token.IsUsed); err != nil {
+		return nil, scanError("No password reset token found", err)
+	}
+
+	return &token, nil
+}
+
+// UsePasswordResetToken marks password reset token as used
+//
+// Returns false if the token was already used so it cannot reset the password twice.
+func (s *Store) UsePasswordResetToken(tokenID string) (bool, error) {
+
+	res, err := s.db.Exec("UPDATE password_reset_tokens SET is_used=TRUE WHERE id=$1 AND is_used=FALSE", tokenID)
+	if err != nil {
+		return false, dbError("Error updating password reset token", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, dbError("Error updating password reset token", err)
+	}
+
+	return count > 0, nil
+}
+
+// DeleteUserPasswordResetTokens deletes every password reset token belonging to user
+func (s *Store) DeleteUserPasswordResetTokens(userID string) error {
+
+	_, err := s.db.Exec("DELETE FROM password_reset_tokens WHERE user_id=$1", userID)
+	if err != nil {
+		return dbError("Error deleting password reset tokens", err)
+	}
+
+	return nil
+}
+
+// EmailVerificationToken is a token mailed to an address to prove the user owns it
+//
+// Tokens are only good for the address they were sent to.
+type EmailVerificationToken struct {
+	ID               string
+	UserID           string
+	Email            string
+	TokenHash        string
+	CreatedTimestamp time.Time
+	ExpiresTimestamp time.Time
+}
+
+// InsertEmailVerificationToken inserts email verification token
+func (s *Store) InsertEmailVerificationToken(token EmailVerificationToken) error {
+
+	_, err := s.db.Exec(
+		`INSERT INTO email_verification_tokens (id, user_id, email, token_hash, created_timestamp, expires_timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		token.ID, token.UserID, token.Email, token.TokenHash, token.CreatedTimestamp, token.ExpiresTimestamp,
+	)
+	if err != nil {
+		return dbError("Error inserting email verification token", err)
+	}
+
+	return nil
+}
+
+// GetEmailVerificationTokenByHash gets email verification token by hash
+func (s *Store) GetEmailVerificationTokenByHash(tokenHash string) (*EmailVerificationToken, error) {
+
+	row := s.db.QueryRow(
+		`SELECT id, user_id, email, token_hash, created_timestamp, expires_timestamp
+		FROM email_verification_tokens WHERE token_hash=$1`,
+		tokenHash,
+	)
+
+	token := EmailVerificationToken{}
+	if err := row.Scan(&token.ID, &token.UserID, &token.Email, &token.TokenHash, &token.CreatedTimestamp, &token.ExpiresTimestamp); err != nil {
+		return nil, scanError("No email verification token found", err)
+	}
+
+	return &token, nil
+}
+
+// DeleteUserEmailVerificationTokens deletes every email verification token belonging to user
+func (s *Store) DeleteUserEmailVerificationTokens(userID string) error {
+
+	_, err := s.db.Exec("DELETE FROM email_verification_tokens WHERE user_id=$1", userID)
+	if err != nil {
+		return dbError("Error deleting email verification tokens", err)
+	}
+
+	return nil
+}
+
+// UsedMFAToken is an MFA token that finished a login
+//
+// MFA tokens are not stored when issued, only remembered once used until they would have expired anyway.
+type UsedMFAToken struct {
+	ID               string
+	UserID           string
+	ExpiresTimestamp time.Time
+}
+
+// UseMFAToken records MFA token as used
+//
+// Returns false if the token was already used so it cannot finish more than one login.
+func (s *Store) UseMFAToken(token UsedMFAToken) (bool, error) {
+
+	res, err := s.db.Exec(
+		`INSERT INTO used_mfa_tokens (id, user_id, expires_timestamp) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO NOTHING`,
+		token.ID, token.UserID, token.ExpiresTimestamp,
+	)
+	if err != nil {
+		return false, dbError("Error using MFA token", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, dbError("Error using MFA token", err)
+	}
+
+	return count > 0, nil
+}
+
+// DeleteExpiredMFATokens deletes used MFA tokens that expired at or before time, returning how many were deleted
+func (s *Store) DeleteExpiredMFATokens(before time.Time) (int, error) {
+
+	res, err := s.db.Exec("DELETE FROM used_mfa_tokens WHERE expires_timestamp<=$1", before)
+	if err != nil {
+		return 0, dbError("Error deleting MFA tokens", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, dbError("Error deleting MFA tokens", err)
+	}
+
+	return int(count), nil
+}
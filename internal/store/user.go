@@ -1,16 +1,69 @@
 package store
 
 import (
-	"errors"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Deleted users' surviving comments are moved to a placeholder user so threads stay intact
+//
+// Real usernames cannot contain brackets so the placeholder's cannot be taken.
+const (
+	DeletedUserID   = "00000000-0000-0000-0000-000000000000"
+	DeletedUsername = "[deleted]"
 )
 
 // User is a site user
+//
+// Deactivated users are kept for a grace period and restored if they log in again before
+// they are purged.
 type User struct {
-	ID            string
-	Username      string
-	PasswordHash  string
-	Description   string
-	ProfileImgURL string
+	ID              string
+	Username        string
+	PasswordHash    string
+	Description     string
+	ProfileImgURL   string
+	Email           string
+	IsEmailVerified bool
+	TOTPSecret      string
+	IsTOTPEnabled   bool
+
+	DeactivatedTimestamp sql.NullTime
+}
+
+// userColumns are the users columns scanned by scanUser
+const userColumns = "id, username, password, description, profile_img_url, email, is_email_verified, totp_secret, is_totp_enabled, deactivated_timestamp"
+
+// rowScanner is a single row or the current row of many
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser scans user from row selected with userColumns
+func scanUser(row rowScanner) (*User, error) {
+
+	user := User{}
+	err := row.Scan(
+		&user.ID, &user.Username, &user.PasswordHash, &user.Description, &user.ProfileImgURL,
+		&user.Email, &user.IsEmailVerified, &user.TOTPSecret, &user.IsTOTPEnabled, &user.DeactivatedTimestamp,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// userConflict reports unique violation err on users as a conflict on the username or email it duplicated
+func userConflict(err error) error {
+
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == "users_email_idx" {
+		return conflict("Email already in use", err)
+	}
+
+	return conflict("User already exists", err)
 }
 
 // InsertUser inserts user into db
@@ -20,19 +73,33 @@ func (s *Store) InsertUser(user User) error {
 	row := s.db.QueryRow("SELECT COUNT(username) FROM users WHERE username=$1", user.Username)
 	var count int
 	if err := row.Scan(&count); err != nil {
-		return errors.New("Error with database")
+		return dbError("Error with database", err)
 	}
 	if count > 0 {
-		return errors.New("User already exists")
+		return conflict("User already exists", nil)
+	}
+
+	// Check for duplicate email
+	if len(user.Email) > 0 {
+		row := s.db.QueryRow("SELECT COUNT(email) FROM users WHERE email=$1", user.Email)
+		if err := row.Scan(&count); err != nil {
+			return dbError("Error with database", err)
+		}
+		if count > 0 {
+			return conflict("Email already in use", nil)
+		}
 	}
 
 	// Insert user
 	_, err := s.db.Exec(
-		"INSERT INTO users (id, username, password, description, profile_img_url) VALUES ($1, $2, $3, '', '')",
-		user.ID, user.Username, user.PasswordHash,
+		"INSERT INTO users (id, username, password, description, profile_img_url, email) VALUES ($1, $2, $3, '', '', $4)",
+		user.ID, user.Username, user.PasswordHash, user.Email,
 	)
+	if isViolation(err, uniqueViolation) {
+		return userConflict(err)
+	}
 	if err != nil {
-		return errors.New("Error creating user")
+		return dbError("Error creating user", err)
 	}
 
 	return nil
@@ -41,50 +108,225 @@ func (s *Store) InsertUser(user User) error {
 // GetUserByID gets user by id from db
 func (s *Store) GetUserByID(userID string) (*User, error) {
 
-	row := s.db.QueryRow("SELECT id, username, password, description, profile_img_url FROM users WHERE id=$1", userID)
+	row := s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id=$1", userID)
 
-	user := User{}
-	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Description, &user.ProfileImgURL); err != nil {
-		return nil, errors.New("No user found")
+	user, err := scanUser(row)
+	if err != nil {
+		return nil, scanError("No user found", err)
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// GetUsersByIDs gets users with the given ids keyed by id
+func (s *Store) GetUsersByIDs(userIDs []string) (map[string]User, error) {
+
+	users := make(map[string]User)
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+
+	rows, err := s.db.Query("SELECT "+userColumns+" FROM users WHERE id=ANY($1)", pq.Array(userIDs))
+	if err != nil {
+		return nil, dbError("Error retrieving users", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, dbError("Error retrieving users", err)
+		}
+		users[user.ID] = *user
+	}
+
+	return users, nil
 }
 
 // GetUserByUsername gets user by username from db
 func (s *Store) GetUserByUsername(username string) (*User, error) {
 
-	row := s.db.QueryRow("SELECT id, username, password, description, profile_img_url FROM users WHERE username=$1", username)
+	row := s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username=$1", username)
 
-	user := User{}
-	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Description, &user.ProfileImgURL); err != nil {
-		return nil, errors.New("No user found")
+	user, err := scanUser(row)
+	if err != nil {
+		return nil, scanError("No user found", err)
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// GetUserByEmail gets user by email from db
+func (s *Store) GetUserByEmail(email string) (*User, error) {
+
+	row := s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE email=$1 AND email<>''", email)
+
+	user, err := scanUser(row)
+	if err != nil {
+		return nil, scanError("No user found", err)
+	}
+
+	return user, nil
+}
+
+// GetDeactivatedUsers gets users deactivated at or before time
+func (s *Store) GetDeactivatedUsers(before time.Time) ([]User, error) {
+
+	rows, err := s.db.Query(
+		"SELECT "+userColumns+" FROM users WHERE deactivated_timestamp<=$1 ORDER BY deactivated_timestamp",
+		before,
+	)
+	if err != nil {
+		return nil, dbError("Error retrieving users", err)
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, dbError("Error retrieving users", err)
+		}
+		users = append(users, *user)
+	}
+
+	return users, nil
 }
 
 // UpdateUser udpates user
+//
+// Passwords are only changed through SetUserPassword, two-factor settings through SetUserTOTP
+// and deactivation through DeactivateUser and RestoreUser.
 func (s *Store) UpdateUser(user User) error {
 
 	_, err := s.db.Exec(
-		"UPDATE users SET username=$2, password=$3, description=$4, profile_img_url=$5 WHERE id=$1",
-		user.ID, user.Username, user.PasswordHash, user.Description, user.ProfileImgURL,
+		"UPDATE users SET username=$2, description=$3, profile_img_url=$4, email=$5, is_email_verified=$6 WHERE id=$1",
+		user.ID, user.Username, user.Description, user.ProfileImgURL, user.Email, user.IsEmailVerified,
+	)
+	if isViolation(err, uniqueViolation) {
+		return userConflict(err)
+	}
+	if err != nil {
+		return dbError("Error updating user", err)
+	}
+
+	return nil
+}
+
+// DeactivateUser marks user as deactivated at time
+func (s *Store) DeactivateUser(userID string, at time.Time) error {
+
+	_, err := s.db.Exec("UPDATE users SET deactivated_timestamp=$2 WHERE id=$1", userID, at)
+	if err != nil {
+		return dbError("Error updating user", err)
+	}
+
+	return nil
+}
+
+// RestoreUser clears deactivation of user
+func (s *Store) RestoreUser(userID string) error {
+
+	_, err := s.db.Exec("UPDATE users SET deactivated_timestamp=NULL WHERE id=$1", userID)
+	if err != nil {
+		return dbError("Error updating user", err)
+	}
+
+	return nil
+}
+
+// SetUserPassword sets user's password hash
+func (s *Store) SetUserPassword(userID string, passwordHash string) error {
+
+	_, err := s.db.Exec("UPDATE users SET password=$2 WHERE id=$1", userID, passwordHash)
+	if err != nil {
+		return dbError("Error updating user", err)
+	}
+
+	return nil
+}
+
+// SetUserTOTP sets user's TOTP secret and whether it is required at login
+func (s *Store) SetUserTOTP(userID string, secret string, enabled bool) error {
+
+	_, err := s.db.Exec(
+		"UPDATE users SET totp_secret=$2, is_totp_enabled=$3, totp_last_step=0 WHERE id=$1",
+		userID, secret, enabled,
 	)
 	if err != nil {
-		return errors.New("Error updating user")
+		return dbError("Error updating user", err)
 	}
 
 	return nil
 }
 
+// UseTOTPStep records TOTP time step as used
+//
+// Returns false if the step or a later one was already used so a code cannot be replayed.
+func (s *Store) UseTOTPStep(userID string, step int64) (bool, error) {
+
+	res, err := s.db.Exec("UPDATE users SET totp_last_step=$2 WHERE id=$1 AND totp_last_step<$2", userID, step)
+	if err != nil {
+		return false, dbError("Error updating user", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, dbError("Error updating user", err)
+	}
+
+	return count > 0, nil
+}
+
 // DeleteUserByID deletes user by userID
-// TODO: change delete to set default
+//
+// Their statuses go with them, along with reshares of and comments on those statuses.
+// Their comments elsewhere are moved to the placeholder user.
 func (s *Store) DeleteUserByID(userID string) error {
 
-	_, err := s.db.Exec("DELETE FROM users WHERE id=$1", userID)
+	if userID == DeletedUserID {
+		return forbidden("Cannot delete placeholder user", nil)
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return dbError("Error with database", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`WITH RECURSIVE deleted_statuses AS (
+			SELECT id FROM statuses WHERE user_id=$1
+			UNION
+			SELECT statuses.id FROM statuses JOIN deleted_statuses ON statuses.reshared_status_id=deleted_statuses.id
+		)
+		DELETE FROM comments WHERE status_id IN (SELECT id FROM deleted_statuses)`,
+		userID,
+	)
+	if err != nil {
+		return dbError("Error deleting user", err)
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO users (id, username, password, description, profile_img_url, email) VALUES ($1, $2, '', '', '', '') ON CONFLICT DO NOTHING",
+		DeletedUserID, DeletedUsername,
+	)
+	if err != nil {
+		return dbError("Error deleting user", err)
+	}
+
+	_, err = tx.Exec("UPDATE comments SET user_id=$2 WHERE user_id=$1", userID, DeletedUserID)
 	if err != nil {
-		return errors.New("Error deleting user")
+		return dbError("Error deleting user", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM users WHERE id=$1", userID)
+	if err != nil {
+		return dbError("Error deleting user", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return dbError("Error deleting user", err)
 	}
 
 	return nil
@@ -1,10 +1,12 @@
 package store_test
 
 import (
+	"database/sql"
+	"errors"
 	"testing"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/jasmaa/galt/internal/store"
 )
@@ -20,7 +22,7 @@ func TestInsertUser(t *testing.T) {
 		WithArgs("bowser").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 	mock.ExpectExec("INSERT INTO users").
-		WithArgs("12345", "bowser", "coolPasswordHash").
+		WithArgs("12345", "bowser", "coolPasswordHash", "").
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
 	user := store.User{
@@ -35,3 +37,65 @@ func TestInsertUser(t *testing.T) {
 		t.Errorf("error inserting user: %v", err)
 	}
 }
+
+func TestUpdateUserConflicts(t *testing.T) {
+
+	// Setup db
+	s := store.Store{}
+	mock := s.OpenMock()
+	defer s.Close()
+
+	mock.ExpectExec("UPDATE users").
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "users_username_idx"})
+	mock.ExpectExec("UPDATE users").
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "users_email_idx"})
+
+	user := store.User{ID: "12345", Username: "bowser", Email: "bowser@example.com"}
+
+	// Duplicate usernames and emails are told apart by the index they violate
+	err := s.UpdateUser(user)
+	if !errors.Is(err, store.ErrConflict) || err.Error() != "User already exists" {
+		t.Errorf("expected username conflict, got: %v", err)
+	}
+	err = s.UpdateUser(user)
+	if !errors.Is(err, store.ErrConflict) || err.Error() != "Email already in use" {
+		t.Errorf("expected email conflict, got: %v", err)
+	}
+}
+
+func TestGetUserByIDErrors(t *testing.T) {
+
+	// Setup db
+	s := store.Store{}
+	mock := s.OpenMock()
+	defer s.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM users").
+		WithArgs("12345").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT (.+) FROM users").
+		WithArgs("12345").
+		WillReturnError(&pq.Error{Code: "22P02"})
+	mock.ExpectQuery("SELECT (.+) FROM users").
+		WithArgs("12345").
+		WillReturnError(errors.New("connection refused"))
+
+	// Missing rows are not found, and neither are malformed ids
+	_, err := s.GetUserByID("12345")
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+	_, err = s.GetUserByID("12345")
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected not found error for malformed id, got: %v", err)
+	}
+
+	// Database failures are not, but keep the cause
+	_, err = s.GetUserByID("12345")
+	if errors.Is(err, store.ErrNotFound) || err.Error() != "Error with database" {
+		t.Errorf("expected database error, got: %v", err)
+	}
+	if errors.Unwrap(err) == nil || errors.Unwrap(err).Error() != "connection refused" {
+		t.Errorf("expected wrapped cause, got: %v", errors.Unwrap(err))
+	}
+}
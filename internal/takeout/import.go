@@ -0,0 +1,352 @@
+package takeout
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// maxDataSize is the most archive data that will be read, guarding against zip bombs
+const maxDataSize = 64 << 20
+
+// Errors reading archives
+var (
+	ErrInvalidArchive     = errors.New("Invalid archive")
+	ErrUnsupportedVersion = errors.New("Unsupported archive version")
+)
+
+// Report describes what was imported and what could not be
+//
+// Skipped ids are ids in the archive of things that referenced data outside of it, like comments on
+// other users' statuses. Unmatched users are circle members with no active user of the same username.
+type Report struct {
+	Statuses          int      `json:"statuses"`
+	Comments          int      `json:"comments"`
+	Circles           int      `json:"circles"`
+	Likes             int      `json:"likes"`
+	SkippedStatusIDs  []string `json:"skippedStatusIDs"`
+	SkippedCommentIDs []string `json:"skippedCommentIDs"`
+	UnmatchedUsers    []Member `json:"unmatchedUsers"`
+}
+
+// String summarizes report
+func (r Report) String() string {
+	return fmt.Sprintf(
+		"imported %d statuses, %d comments, %d circles and %d likes; skipped %d statuses and %d comments; %d users not matched",
+		r.Statuses, r.Comments, r.Circles, r.Likes, len(r.SkippedStatusIDs), len(r.SkippedCommentIDs), len(r.UnmatchedUsers),
+	)
+}
+
+// Read reads archive data from zip written by Write
+func Read(r io.ReaderAt, size int64) (*Archive, error) {
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+
+	for _, f := range zr.File {
+		if f.Name != DataFile {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, ErrInvalidArchive
+		}
+		defer rc.Close()
+
+		var archive Archive
+		if err := json.NewDecoder(io.LimitReader(rc, maxDataSize)).Decode(&archive); err != nil {
+			return nil, ErrInvalidArchive
+		}
+		if archive.Version != Version {
+			return nil, ErrUnsupportedVersion
+		}
+
+		return &archive, nil
+	}
+
+	return nil, ErrInvalidArchive
+}
+
+// importer tracks new ids given to archived data while importing it
+type importer struct {
+	s        store.Repository
+	userID   string
+	archive  *Archive
+	report   *Report
+	circles  map[string]string
+	statuses map[string]string
+	comments map[string]string
+}
+
+// Import adds archived data to user under new ids, keeping when it was posted
+//
+// The profile description and image are replaced but the username and email are left alone. Archives
+// are checked with Validate first, and nothing is imported if they are invalid or any part fails.
+func Import(s store.Repository, userID string, archive *Archive) (*Report, error) {
+
+	if err := Validate(archive); err != nil {
+		return nil, err
+	}
+
+	var report *Report
+	err := s.WithTx(func(tx store.Repository) error {
+		var err error
+		report, err = importArchive(tx, userID, archive)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// importArchive adds archived data to user
+func importArchive(s store.Repository, userID string, archive *Archive) (*Report, error) {
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	im := &importer{
+		s:       s,
+		userID:  userID,
+		archive: archive,
+		report: &Report{
+			SkippedStatusIDs:  make([]string, 0),
+			SkippedCommentIDs: make([]string, 0),
+			UnmatchedUsers:    make([]Member, 0),
+		},
+		circles:  make(map[string]string),
+		statuses: make(map[string]string),
+		comments: make(map[string]string),
+	}
+
+	user.Description = archive.Profile.Description
+	user.ProfileImgURL = archive.Profile.ProfileImgURL
+	if err := s.UpdateUser(*user); err != nil {
+		return nil, err
+	}
+
+	if err := im.importCircles(); err != nil {
+		return nil, err
+	}
+	if err := im.importStatuses(); err != nil {
+		return nil, err
+	}
+	if err := im.importComments(); err != nil {
+		return nil, err
+	}
+	if err := im.importLikes(); err != nil {
+		return nil, err
+	}
+
+	return im.report, nil
+}
+
+// importCircles imports circles, adding members found by username
+func (im *importer) importCircles() error {
+
+	for _, circle := range im.archive.Circles {
+		circleID := uuid.New().String()
+		err := im.s.InsertCircle(store.Circle{
+			ID:          circleID,
+			UserID:      im.userID,
+			Name:        circle.Name,
+			Description: circle.Description,
+		})
+		if err != nil {
+			return err
+		}
+		im.circles[circle.ID] = circleID
+		im.report.Circles++
+
+		for _, member := range circle.Members {
+			user, err := im.s.GetUserByUsername(member.Username)
+			if err != nil || user.DeactivatedTimestamp.Valid || user.ID == store.DeletedUserID {
+				im.report.UnmatchedUsers = append(im.report.UnmatchedUsers, member)
+				continue
+			}
+			if err := im.s.InsertCircleUserPair(user.ID, circleID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// importStatuses imports statuses, skipping reshares of statuses not in the archive
+func (im *importer) importStatuses() error {
+
+	archived := make(map[string]Status)
+	for _, status := range im.archive.Statuses {
+		archived[status.ID] = status
+	}
+
+	var insert func(status Status, seen map[string]bool) (bool, error)
+	insert = func(status Status, seen map[string]bool) (bool, error) {
+
+		if _, ok := im.statuses[status.ID]; ok {
+			return true, nil
+		}
+		if seen[status.ID] || !store.IsValidVisibility(status.Visibility) {
+			return false, nil
+		}
+		seen[status.ID] = true
+
+		// Reshared status must be imported first
+		resharedStatusID := sql.NullString{}
+		if len(status.ResharedStatusID) > 0 {
+			original, ok := archived[status.ResharedStatusID]
+			if !ok {
+				return false, nil
+			}
+			if ok, err := insert(original, seen); !ok || err != nil {
+				return false, err
+			}
+			resharedStatusID = sql.NullString{String: im.statuses[original.ID], Valid: true}
+		}
+
+		statusID := uuid.New().String()
+		err := im.s.InsertStatus(store.Status{
+			ID:               statusID,
+			UserID:           im.userID,
+			Content:          status.Content,
+			PostedTimestamp:  status.PostedTimestamp,
+			IsEdited:         status.IsEdited,
+			Visibility:       status.Visibility,
+			ResharedStatusID: resharedStatusID,
+		})
+		if err != nil {
+			return false, err
+		}
+		im.statuses[status.ID] = statusID
+		im.report.Statuses++
+
+		for _, circleID := range status.CircleIDs {
+			newCircleID, ok := im.circles[circleID]
+			if !ok {
+				continue
+			}
+			if err := im.s.InsertStatusCirclePair(statusID, newCircleID); err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	}
+
+	for _, status := range im.archive.Statuses {
+		ok, err := insert(status, make(map[string]bool))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			im.report.SkippedStatusIDs = append(im.report.SkippedStatusIDs, status.ID)
+		}
+	}
+
+	return nil
+}
+
+// importComments imports comments, skipping those on statuses or replying to comments not imported
+func (im *importer) importComments() error {
+
+	archived := make(map[string]Comment)
+	for _, comment := range im.archive.Comments {
+		archived[comment.ID] = comment
+	}
+
+	var insert func(comment Comment, seen map[string]bool) (bool, error)
+	insert = func(comment Comment, seen map[string]bool) (bool, error) {
+
+		if _, ok := im.comments[comment.ID]; ok {
+			return true, nil
+		}
+		statusID, ok := im.statuses[comment.StatusID]
+		if !ok || seen[comment.ID] {
+			return false, nil
+		}
+		seen[comment.ID] = true
+
+		// Parent comment must be imported first
+		parentCommentID := sql.NullString{}
+		if len(comment.ParentCommentID) > 0 {
+			parent, ok := archived[comment.ParentCommentID]
+			if !ok || parent.StatusID != comment.StatusID {
+				return false, nil
+			}
+			if ok, err := insert(parent, seen); !ok || err != nil {
+				return false, err
+			}
+			parentCommentID = sql.NullString{String: im.comments[parent.ID], Valid: true}
+		}
+
+		commentID := uuid.New().String()
+		err := im.s.InsertComment(store.Comment{
+			ID:              commentID,
+			UserID:          im.userID,
+			StatusID:        statusID,
+			ParentCommentID: parentCommentID,
+			Content:         comment.Content,
+			PostedTimestamp: comment.PostedTimestamp,
+			IsEdited:        comment.IsEdited,
+		})
+		if err != nil {
+			return false, err
+		}
+		im.comments[comment.ID] = commentID
+		im.report.Comments++
+
+		return true, nil
+	}
+
+	for _, comment := range im.archive.Comments {
+		ok, err := insert(comment, make(map[string]bool))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			im.report.SkippedCommentIDs = append(im.report.SkippedCommentIDs, comment.ID)
+		}
+	}
+
+	return nil
+}
+
+// importLikes imports likes of imported statuses and comments
+//
+// Likes of anything else refer to data on the old instance and are dropped.
+func (im *importer) importLikes() error {
+
+	for _, statusID := range im.archive.Likes.StatusIDs {
+		if newStatusID, ok := im.statuses[statusID]; ok {
+			if err := im.s.InsertStatusLikePair(im.userID, newStatusID); err != nil {
+				return err
+			}
+			im.report.Likes++
+		}
+	}
+	for _, commentID := range im.archive.Likes.CommentIDs {
+		if newCommentID, ok := im.comments[commentID]; ok {
+			if err := im.s.InsertCommentLikePair(im.userID, newCommentID); err != nil {
+				return err
+			}
+			im.report.Likes++
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package takeout
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/jasmaa/galt/internal/store"
+)
+
+// Version is bumped whenever the layout of the archive data changes
+const Version = 1
+
+// Files in the archive
+const (
+	DataFile  = "data.json"
+	IndexFile = "index.html"
+)
+
+// Archive is everything a user has posted, liked or organized
+type Archive struct {
+	Version           int       `json:"version"`
+	ExportedTimestamp time.Time `json:"exportedTimestamp"`
+	Profile           Profile   `json:"profile"`
+	Statuses          []Status  `json:"statuses"`
+	Comments          []Comment `json:"comments"`
+	Likes             Likes     `json:"likes"`
+	Circles           []Circle  `json:"circles"`
+}
+
+// Profile is the user's own profile
+type Profile struct {
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Description   string `json:"description"`
+	ProfileImgURL string `json:"profileImgURL"`
+	Email         string `json:"email"`
+}
+
+// Status is a status posted by the user
+type Status struct {
+	ID               string    `json:"id"`
+	Content          string    `json:"content"`
+	PostedTimestamp  time.Time `json:"postedTimestamp"`
+	IsEdited         bool      `json:"isEdited"`
+	Visibility       string    `json:"visibility"`
+	CircleIDs        []string  `json:"circleIDs"`
+	ResharedStatusID string    `json:"resharedStatusID,omitempty"`
+}
+
+// Comment is a comment posted by the user
+type Comment struct {
+	ID              string    `json:"id"`
+	StatusID        string    `json:"statusID"`
+	ParentCommentID string    `json:"parentCommentID,omitempty"`
+	Content         string    `json:"content"`
+	PostedTimestamp time.Time `json:"postedTimestamp"`
+	IsEdited        bool      `json:"isEdited"`
+}
+
+// Likes are ids of statuses and comments liked by the user
+type Likes struct {
+	StatusIDs  []string `json:"statusIDs"`
+	CommentIDs []string `json:"commentIDs"`
+}
+
+// Circle is a circle owned by the user
+type Circle struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Members     []Member `json:"members"`
+}
+
+// Member is a user in a circle
+//
+// Usernames are kept so members can be found again if ids change.
+type Member struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// Build collects data of user into archive
+func Build(s store.Repository, userID string, now time.Time) (*Archive, error) {
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &Archive{
+		Version:           Version,
+		ExportedTimestamp: now,
+		Profile: Profile{
+			ID:            user.ID,
+			Username:      user.Username,
+			Description:   user.Description,
+			ProfileImgURL: user.ProfileImgURL,
+			Email:         user.Email,
+		},
+		Statuses: make([]Status, 0),
+		Comments: make([]Comment, 0),
+		Circles:  make([]Circle, 0),
+	}
+
+	// Statuses
+	statuses, err := s.GetUserStatuses(userID)
+	if err != nil {
+		return nil, err
+	}
+	statusIDs := make([]string, len(statuses))
+	for i, status := range statuses {
+		statusIDs[i] = status.ID
+	}
+	circleIDs, err := s.GetStatusCircleIDs(statusIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		ids := circleIDs[status.ID]
+		if ids == nil {
+			ids = make([]string, 0)
+		}
+		archive.Statuses = append(archive.Statuses, Status{
+			ID:               status.ID,
+			Content:          status.Content,
+			PostedTimestamp:  status.PostedTimestamp,
+			IsEdited:         status.IsEdited,
+			Visibility:       status.Visibility,
+			CircleIDs:        ids,
+			ResharedStatusID: status.ResharedStatusID.String,
+		})
+	}
+
+	// Comments
+	comments, err := s.GetUserComments(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, comment := range comments {
+		archive.Comments = append(archive.Comments, Comment{
+			ID:              comment.ID,
+			StatusID:        comment.StatusID,
+			ParentCommentID: comment.ParentCommentID.String,
+			Content:         comment.Content,
+			PostedTimestamp: comment.PostedTimestamp,
+			IsEdited:        comment.IsEdited,
+		})
+	}
+
+	// Likes
+	archive.Likes.StatusIDs, err = s.GetUserStatusLikes(userID)
+	if err != nil {
+		return nil, err
+	}
+	archive.Likes.CommentIDs, err = s.GetUserCommentLikes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Circles
+	circles, err := s.GetUserCircles(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, circle := range circles {
+		memberIDs, err := s.GetCircleUserIDs(circle.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		members := make([]Member, 0, len(memberIDs))
+		for _, memberID := range memberIDs {
+			member, err := s.GetUserByID(memberID)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, Member{ID: member.ID, Username: member.Username})
+		}
+
+		archive.Circles = append(archive.Circles, Circle{
+			ID:          circle.ID,
+			Name:        circle.Name,
+			Description: circle.Description,
+			Members:     members,
+		})
+	}
+
+	return archive, nil
+}
+
+// Write writes archive as zip of its data and an index to read it in a browser
+func Write(w io.Writer, archive *Archive) error {
+
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create(DataFile)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(archive); err != nil {
+		return err
+	}
+
+	f, err = zw.Create(IndexFile)
+	if err != nil {
+		return err
+	}
+	if err := indexTemplate.Execute(f, archive); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// indexTemplate renders archive as a single page
+var indexTemplate = template.Must(template.New(IndexFile).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Galt export for {{.Profile.Username}}</title>
+</head>
+<body>
+<h1>{{.Profile.Username}}</h1>
+<p>Exported {{.ExportedTimestamp.Format "2006-01-02 15:04 MST"}}. The full data is in data.json.</p>
+
+<h2>Profile</h2>
+<dl>
+<dt>Username</dt><dd>{{.Profile.Username}}</dd>
+<dt>Email</dt><dd>{{.Profile.Email}}</dd>
+<dt>Description</dt><dd>{{.Profile.Description}}</dd>
+<dt>Profile image</dt><dd>{{.Profile.ProfileImgURL}}</dd>
+</dl>
+
+<h2>Statuses ({{len .Statuses}})</h2>
+{{range .Statuses}}<article id="status-{{.ID}}">
+<p>{{.Content}}</p>
+<small>{{.PostedTimestamp.Format "2006-01-02 15:04 MST"}} &middot; {{.Visibility}}{{if .IsEdited}} &middot; edited{{end}}{{if .ResharedStatusID}} &middot; reshare of {{.ResharedStatusID}}{{end}}</small>
+</article>
+{{else}}<p>None</p>
+{{end}}
+<h2>Comments ({{len .Comments}})</h2>
+{{range .Comments}}<article id="comment-{{.ID}}">
+<p>{{.Content}}</p>
+<small>{{.PostedTimestamp.Format "2006-01-02 15:04 MST"}} &middot; on status {{.StatusID}}{{if .IsEdited}} &middot; edited{{end}}</small>
+</article>
+{{else}}<p>None</p>
+{{end}}
+<h2>Likes</h2>
+<p>{{len .Likes.StatusIDs}} statuses and {{len .Likes.CommentIDs}} comments</p>
+
+<h2>Circles ({{len .Circles}})</h2>
+{{range .Circles}}<section id="circle-{{.ID}}">
+<h3>{{.Name}}</h3>
+<p>{{.Description}}</p>
+<ul>
+{{range .Members}}<li>{{.Username}}</li>
+{{else}}<li>No members</li>
+{{end}}</ul>
+</section>
+{{else}}<p>None</p>
+{{end}}
+</body>
+</html>
+`))
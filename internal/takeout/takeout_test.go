@@ -0,0 +1,228 @@
+package takeout_test
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/store"
+	"github.com/jasmaa/galt/internal/takeout"
+)
+
+var baseTime = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// setupSource sets up store where alice has posted, commented, liked and made a circle with bob and carol
+func setupSource(t *testing.T) *store.MemoryStore {
+
+	s := store.NewMemoryStore()
+	for _, user := range []store.User{
+		{ID: "alice", Username: "alice", PasswordHash: "hash"},
+		{ID: "bob", Username: "bob", PasswordHash: "hash"},
+		{ID: "carol", Username: "carol", PasswordHash: "hash"},
+	} {
+		if err := s.InsertUser(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, err := range []error{
+		s.UpdateUser(store.User{ID: "alice", Username: "alice", Description: "hi"}),
+		s.InsertCircle(store.Circle{ID: "circle1", UserID: "alice", Name: "Friends"}),
+		s.InsertCircleUserPair("bob", "circle1"),
+		s.InsertCircleUserPair("carol", "circle1"),
+		s.InsertStatus(store.Status{ID: "status1", UserID: "alice", Content: "first", PostedTimestamp: baseTime, Visibility: store.VisibilityPublic}),
+		s.InsertStatus(store.Status{ID: "status2", UserID: "alice", Content: "friends only", PostedTimestamp: baseTime.Add(time.Minute), Visibility: store.VisibilityCircles}),
+		s.InsertStatusCirclePair("status2", "circle1"),
+		s.InsertStatus(store.Status{ID: "status3", UserID: "bob", Content: "bob", PostedTimestamp: baseTime.Add(2 * time.Minute), Visibility: store.VisibilityPublic}),
+		s.InsertStatus(store.Status{ID: "status4", UserID: "alice", PostedTimestamp: baseTime.Add(3 * time.Minute), Visibility: store.VisibilityPublic, ResharedStatusID: sql.NullString{String: "status3", Valid: true}}),
+		s.InsertStatus(store.Status{ID: "status5", UserID: "alice", PostedTimestamp: baseTime.Add(4 * time.Minute), Visibility: store.VisibilityPublic, ResharedStatusID: sql.NullString{String: "status1", Valid: true}}),
+		s.InsertComment(store.Comment{ID: "comment1", UserID: "alice", StatusID: "status1", Content: "top", PostedTimestamp: baseTime.Add(5 * time.Minute)}),
+		s.InsertComment(store.Comment{ID: "comment2", UserID: "alice", StatusID: "status1", ParentCommentID: sql.NullString{String: "comment1", Valid: true}, Content: "reply", PostedTimestamp: baseTime.Add(6 * time.Minute)}),
+		s.InsertComment(store.Comment{ID: "comment3", UserID: "alice", StatusID: "status3", Content: "on bob", PostedTimestamp: baseTime.Add(7 * time.Minute)}),
+		s.InsertStatusLikePair("alice", "status1"),
+		s.InsertStatusLikePair("alice", "status3"),
+		s.InsertCommentLikePair("alice", "comment1"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s
+}
+
+// roundTrip builds archive of user, writes it and reads it back
+func roundTrip(t *testing.T, s store.Repository, userID string) *takeout.Archive {
+
+	archive, err := takeout.Build(s, userID, baseTime.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := takeout.Write(&buf, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := takeout.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return read
+}
+
+func TestBuild(t *testing.T) {
+
+	s := setupSource(t)
+	archive := roundTrip(t, s, "alice")
+
+	assert.Equal(t, takeout.Version, archive.Version)
+	assert.Equal(t, "alice", archive.Profile.Username)
+	assert.Len(t, archive.Statuses, 4)
+	assert.Len(t, archive.Comments, 3)
+	assert.Equal(t, []string{"status1", "status3"}, archive.Likes.StatusIDs)
+	assert.Equal(t, []string{"comment1"}, archive.Likes.CommentIDs)
+	if assert.Len(t, archive.Circles, 1) {
+		assert.Equal(t, []takeout.Member{{ID: "bob", Username: "bob"}, {ID: "carol", Username: "carol"}}, archive.Circles[0].Members)
+	}
+}
+
+func TestImport(t *testing.T) {
+
+	archive := roundTrip(t, setupSource(t), "alice")
+
+	// Destination only has alice and bob, under different ids
+	d := store.NewMemoryStore()
+	for _, user := range []store.User{
+		{ID: "alice2", Username: "alice", PasswordHash: "hash"},
+		{ID: "bob2", Username: "bob", PasswordHash: "hash"},
+	} {
+		if err := d.InsertUser(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := takeout.Import(d, "alice2", archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 3, report.Statuses)
+	assert.Equal(t, 2, report.Comments)
+	assert.Equal(t, 1, report.Circles)
+	assert.Equal(t, 2, report.Likes)
+	assert.Equal(t, []string{"status4"}, report.SkippedStatusIDs)
+	assert.Equal(t, []string{"comment3"}, report.SkippedCommentIDs)
+	assert.Equal(t, []takeout.Member{{ID: "carol", Username: "carol"}}, report.UnmatchedUsers)
+
+	user, _ := d.GetUserByID("alice2")
+	assert.Equal(t, "hi", user.Description)
+
+	// Statuses get new ids but keep when they were posted
+	statuses, err := d.GetUserStatuses("alice2")
+	if err != nil || !assert.Len(t, statuses, 3) {
+		t.FailNow()
+	}
+	byContent := make(map[string]store.Status)
+	for _, status := range statuses {
+		assert.NotContains(t, []string{"status1", "status2", "status5"}, status.ID)
+		byContent[status.Content] = status
+	}
+	first := byContent["first"]
+	assert.True(t, baseTime.Equal(first.PostedTimestamp))
+	assert.Equal(t, first.ID, byContent[""].ResharedStatusID.String)
+
+	// Circle is remapped with matched members
+	circles, _ := d.GetUserCircles("alice2")
+	if assert.Len(t, circles, 1) {
+		members, _ := d.GetCircleUserIDs(circles[0].ID)
+		assert.Equal(t, []string{"bob2"}, members)
+		circleIDs, _ := d.GetStatusCircleIDs([]string{byContent["friends only"].ID})
+		assert.Equal(t, []string{circles[0].ID}, circleIDs[byContent["friends only"].ID])
+	}
+
+	// Replies point at remapped parents
+	comments, _ := d.GetUserComments("alice2")
+	if assert.Len(t, comments, 2) {
+		reply, top := comments[0], comments[1]
+		assert.Equal(t, "reply", reply.Content)
+		assert.Equal(t, top.ID, reply.ParentCommentID.String)
+		assert.Equal(t, first.ID, top.StatusID)
+		assert.True(t, baseTime.Add(5*time.Minute).Equal(top.PostedTimestamp))
+	}
+
+	likes, _ := d.GetUserStatusLikes("alice2")
+	assert.Equal(t, []string{first.ID}, likes)
+}
+
+// setupDestination sets up store with alice to import into
+func setupDestination(t *testing.T) *store.MemoryStore {
+
+	d := store.NewMemoryStore()
+	if err := d.InsertUser(store.User{ID: "alice2", Username: "alice", PasswordHash: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+// failingStore fails to insert comments, partway through importing
+type failingStore struct {
+	store.Repository
+}
+
+func (s failingStore) InsertComment(comment store.Comment) error {
+	return errors.New("failed")
+}
+
+func (s failingStore) WithTx(fn func(store.Repository) error) error {
+	return s.Repository.WithTx(func(tx store.Repository) error {
+		return fn(failingStore{tx})
+	})
+}
+
+func TestImportFailInvalid(t *testing.T) {
+
+	archive := roundTrip(t, setupSource(t), "alice")
+	archive.Comments[0].Content = ""
+	archive.Circles[0].Name = " "
+	d := setupDestination(t)
+
+	_, err := takeout.Import(d, "alice2", archive)
+
+	var invalid *takeout.ValidationError
+	if assert.True(t, errors.As(err, &invalid)) {
+		assert.Len(t, invalid.Fields, 2)
+		assert.Equal(t, "Required", invalid.Fields["circles[0].name"])
+	}
+	circles, _ := d.GetUserCircles("alice2")
+	assert.Empty(t, circles)
+}
+
+func TestImportRollsBack(t *testing.T) {
+
+	archive := roundTrip(t, setupSource(t), "alice")
+	d := setupDestination(t)
+
+	_, err := takeout.Import(failingStore{d}, "alice2", archive)
+
+	// Nothing before the failure is kept
+	assert.Error(t, err)
+	user, _ := d.GetUserByID("alice2")
+	assert.Empty(t, user.Description)
+	statuses, _ := d.GetUserStatuses("alice2")
+	assert.Empty(t, statuses)
+	circles, _ := d.GetUserCircles("alice2")
+	assert.Empty(t, circles)
+}
+
+func TestReadFailInvalid(t *testing.T) {
+
+	_, err := takeout.Read(bytes.NewReader([]byte("not a zip")), 9)
+	assert.Equal(t, takeout.ErrInvalidArchive, err)
+}
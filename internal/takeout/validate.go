@@ -0,0 +1,47 @@
+package takeout
+
+import (
+	"fmt"
+
+	"github.com/jasmaa/galt/internal/validate"
+)
+
+// ValidationError maps archive fields to why they could not be posted as they are
+type ValidationError struct {
+	Fields validate.Errors
+}
+
+// Error gets message
+func (e *ValidationError) Error() string {
+	return "Invalid archive content"
+}
+
+// Validate checks archived text against the same limits as posting it
+//
+// Returns a *ValidationError listing every invalid field, if there are any.
+func Validate(archive *Archive) error {
+
+	errs := validate.Errors{}
+	validate.Text(errs, "profile.description", archive.Profile.Description, false)
+	if len(archive.Profile.ProfileImgURL) > 0 {
+		validate.URL(errs, "profile.profileImgURL", archive.Profile.ProfileImgURL)
+	}
+	for i, status := range archive.Statuses {
+		// Reshares can be posted without content
+		required := len(status.ResharedStatusID) == 0
+		validate.Text(errs, fmt.Sprintf("statuses[%d].content", i), status.Content, required)
+	}
+	for i, comment := range archive.Comments {
+		validate.Text(errs, fmt.Sprintf("comments[%d].content", i), comment.Content, true)
+	}
+	for i, circle := range archive.Circles {
+		validate.Text(errs, fmt.Sprintf("circles[%d].name", i), circle.Name, true)
+		validate.Text(errs, fmt.Sprintf("circles[%d].description", i), circle.Description, false)
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Fields: errs}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package totp_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/totp"
+)
+
+// rfcSecret is the RFC 6238 SHA1 test key "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeMatchesRFCVectors(t *testing.T) {
+
+	// Last 6 digits of the RFC 6238 SHA1 test vectors
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, expected := range vectors {
+		code, err := totp.Code(rfcSecret, totp.Step(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, "time %d", unix)
+	}
+}
+
+func TestValidateWithSkew(t *testing.T) {
+
+	now := time.Unix(1111111109, 0)
+	previous, _ := totp.Code(rfcSecret, totp.Step(now)-1)
+	old, _ := totp.Code(rfcSecret, totp.Step(now)-2)
+
+	step, ok := totp.Validate(rfcSecret, previous, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, totp.Step(now)-1, step)
+
+	_, ok = totp.Validate(rfcSecret, old, now, 1)
+	assert.False(t, ok)
+
+	_, ok = totp.Validate(rfcSecret, "12345", now, 1)
+	assert.False(t, ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = totp.Code(secret, 1)
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+}
+
+func TestURI(t *testing.T) {
+
+	uri, err := url.Parse(totp.URI("Galt", "testuser", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Galt:testuser", uri.Path)
+	assert.Equal(t, rfcSecret, uri.Query().Get("secret"))
+	assert.Equal(t, "Galt", uri.Query().Get("issuer"))
+}
@@ -0,0 +1,108 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Field limits, most text is stored in VARCHAR(255) columns
+const (
+	MaxTextLength     = 255
+	MinUsernameLength = 3
+	MaxUsernameLength = 32
+	MinPasswordLength = 8
+
+	// MaxPasswordLength is in bytes since bcrypt ignores anything past 72
+	MaxPasswordLength = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]*$`)
+
+// Errors maps invalid fields to what is wrong with them
+type Errors map[string]string
+
+// Add records problem with field unless it already has one
+func (errs Errors) Add(field string, message string) {
+	if _, ok := errs[field]; !ok {
+		errs[field] = message
+	}
+}
+
+// Text checks text fits its column and is not blank if required
+func Text(errs Errors, field string, text string, required bool) {
+
+	if required && len(strings.TrimSpace(text)) == 0 {
+		errs.Add(field, "Required")
+	}
+	if utf8.RuneCountInString(text) > MaxTextLength {
+		errs.Add(field, fmt.Sprintf("Must be at most %d characters", MaxTextLength))
+	}
+}
+
+// Username checks username length and charset
+func Username(errs Errors, field string, username string) {
+
+	if len(username) == 0 {
+		errs.Add(field, "Required")
+	}
+	if len(username) < MinUsernameLength || len(username) > MaxUsernameLength || !usernamePattern.MatchString(username) {
+		errs.Add(field, fmt.Sprintf("Must be %d to %d letters, digits or underscores", MinUsernameLength, MaxUsernameLength))
+	}
+}
+
+// Password checks password is long enough to be hard to guess and short enough to hash
+//
+// Username is optional and rejected as the password if given.
+func Password(errs Errors, field string, password string, username string) {
+
+	if len(password) == 0 {
+		errs.Add(field, "Required")
+	}
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		errs.Add(field, fmt.Sprintf("Must be at least %d characters", MinPasswordLength))
+	}
+	if len(password) > MaxPasswordLength {
+		errs.Add(field, fmt.Sprintf("Must be at most %d bytes", MaxPasswordLength))
+	}
+	if len(username) > 0 && strings.EqualFold(password, username) {
+		errs.Add(field, "Must not be the username")
+	}
+}
+
+// Email checks email is a single address that fits its column
+func Email(errs Errors, field string, email string) {
+
+	normalized, err := NormalizeEmail(email)
+	if err != nil {
+		errs.Add(field, "Invalid email")
+		return
+	}
+	if len(normalized) > MaxTextLength {
+		errs.Add(field, fmt.Sprintf("Must be at most %d characters", MaxTextLength))
+	}
+}
+
+// URL checks url is absolute http or https that fits its column
+func URL(errs Errors, field string, rawURL string) {
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		errs.Add(field, "Must be an http or https URL")
+	}
+	Text(errs, field, rawURL, false)
+}
+
+// NormalizeEmail parses email address and lowercases it so the same address always matches
+func NormalizeEmail(email string) (string, error) {
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(addr.Address), nil
+}
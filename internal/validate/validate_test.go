@@ -0,0 +1,46 @@
+package validate_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jasmaa/galt/internal/validate"
+)
+
+func TestText(t *testing.T) {
+
+	errs := validate.Errors{}
+	validate.Text(errs, "blank", " ", true)
+	validate.Text(errs, "optional", "", false)
+	validate.Text(errs, "fits", strings.Repeat("é", validate.MaxTextLength), true)
+	validate.Text(errs, "long", strings.Repeat("a", validate.MaxTextLength+1), false)
+
+	assert.Equal(t, validate.Errors{
+		"blank": "Required",
+		"long":  "Must be at most 255 characters",
+	}, errs)
+}
+
+func TestURL(t *testing.T) {
+
+	errs := validate.Errors{}
+	validate.URL(errs, "ok", "https://example.com/a.png")
+	validate.URL(errs, "scheme", "javascript:alert(1)")
+	validate.URL(errs, "relative", "/a.png")
+
+	assert.Equal(t, validate.Errors{
+		"scheme":   "Must be an http or https URL",
+		"relative": "Must be an http or https URL",
+	}, errs)
+}
+
+func TestAddKeepsFirstMessage(t *testing.T) {
+
+	errs := validate.Errors{}
+	errs.Add("field", "first")
+	errs.Add("field", "second")
+
+	assert.Equal(t, "first", errs["field"])
+}